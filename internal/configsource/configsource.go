@@ -0,0 +1,152 @@
+// Package configsource reads the settings of a service from the command line
+// flags, the environment, a YAML config file and the file ../.env.
+package configsource
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is a configuration value. Its name is the environment variable,
+// e.g. DB_NAME, which is db_name in the config file and -db-name on the
+// command line.
+type Setting struct {
+	Name  string
+	Usage string
+}
+
+func (s Setting) key() string  { return strings.ToLower(s.Name) }
+func (s Setting) flag() string { return strings.ReplaceAll(s.key(), "_", "-") }
+
+// Source looks up settings in the command line flags, the environment, the
+// config file and ../.env, in this order.
+type Source struct {
+	flags  map[string]string
+	file   map[string]string
+	dotenv map[string]string
+}
+
+// New parses the command line arguments and reads the config file
+// given with -config or CONFIG_FILE and the file ../.env if it exists. It
+// returns the arguments after the flags.
+func New(name string, settings []Setting, args []string) (*Source, []string, error) {
+	dotenv, err := godotenv.Read("../.env")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("read ../.env: %w", err)
+	}
+
+	defaultConfigFile, ok := os.LookupEnv("CONFIG_FILE")
+	if !ok {
+		defaultConfigFile = dotenv["CONFIG_FILE"]
+	}
+
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flagSet.String("config", defaultConfigFile, "YAML config file, also CONFIG_FILE")
+	values := make(map[string]*string, len(settings))
+	names := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.flag()] = flagSet.String(s.flag(), "", s.Usage+", also "+s.Name)
+		names[s.key()] = s.Name
+	}
+	if err = flagSet.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	source := &Source{
+		flags:  make(map[string]string),
+		file:   make(map[string]string),
+		dotenv: dotenv,
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok {
+			source.flags[strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))] = *value
+		}
+	})
+
+	if *configFile != "" {
+		content, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read config file: %w", err)
+		}
+		var file map[string]string
+		if err = yaml.Unmarshal(content, &file); err != nil {
+			return nil, nil, fmt.Errorf("parse config file %s: %w", *configFile, err)
+		}
+		var unknown []string
+		for key, value := range file {
+			name, ok := names[key]
+			if !ok {
+				unknown = append(unknown, key)
+				continue
+			}
+			source.file[name] = value
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, nil, fmt.Errorf("config file %s: unknown settings %s", *configFile, strings.Join(unknown, ", "))
+		}
+	}
+
+	return source, flagSet.Args(), nil
+}
+
+// Lookup returns the value of a setting and whether it is set.
+func (s *Source) Lookup(name string) (string, bool) {
+	if value, ok := s.flags[name]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	if value, ok := s.file[name]; ok {
+		return value, true
+	}
+	value, ok := s.dotenv[name]
+	return value, ok
+}
+
+// Get returns the value of a setting or an empty string.
+func (s *Source) Get(name string) string {
+	value, _ := s.Lookup(name)
+	return value
+}
+
+// Duration parses a setting that must not be negative into value, which keeps
+// its default if the setting is not set.
+func (s *Source) Duration(name string, value *time.Duration) error {
+	str, ok := s.Lookup(name)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%s must be a duration of at least 0, got %q", name, str)
+	}
+	*value = d
+	return nil
+}
+
+// Integer parses a setting that must not be negative into value, which keeps
+// its default if the setting is not set.
+func (s *Source) Integer(name string, value *int) error {
+	str, ok := s.Lookup(name)
+	if !ok {
+		return nil
+	}
+	i, err := strconv.Atoi(str)
+	if err != nil || i < 0 {
+		return fmt.Errorf("%s must be an integer of at least 0, got %q", name, str)
+	}
+	*value = i
+	return nil
+}
@@ -0,0 +1,64 @@
+package configsource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupPrecedence(t *testing.T) {
+	// New reads ../.env relative to the working directory of the service
+	dir := t.TempDir()
+	serviceDir := filepath.Join(dir, "main")
+	if err := os.Mkdir(serviceDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	dotenv := "DB_NAME=dotenv\nHOST=dotenv\nPORT=5432\nDB_USER_NAME=dotenv\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotenv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configFile, []byte("db_name: file\nhost: file\nport: \"5433\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(serviceDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(workDir) })
+
+	for _, name := range []string{"DB_NAME", "HOST", "PORT", "DB_USER_NAME"} {
+		t.Setenv(name, "")
+		_ = os.Unsetenv(name)
+	}
+	t.Setenv("HOST", "env")
+
+	settings := []Setting{
+		{Name: "DB_NAME", Usage: "database name"},
+		{Name: "HOST", Usage: "database host"},
+		{Name: "PORT", Usage: "database port"},
+		{Name: "DB_USER_NAME", Usage: "database user"},
+	}
+	source, _, err := New("test", settings, []string{"-config", configFile, "-db-name", "flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"DB_NAME":      "flag",
+		"HOST":         "env",
+		"PORT":         "5433",
+		"DB_USER_NAME": "dotenv",
+	} {
+		if got := source.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := os.LookupEnv("DB_USER_NAME"); ok {
+		t.Error("../.env was loaded into the environment")
+	}
+}
@@ -0,0 +1,76 @@
+// Package health answers the liveness and readiness probes of the services.
+// The services only decide which components their readiness depends on.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	// ReadinessTimeout bounds the checks of the dependencies, so a probe
+	// fails instead of hanging if the database does not answer.
+	ReadinessTimeout = 2 * time.Second
+)
+
+// Response reports the status of the service and, for readiness, of the
+// components it depends on.
+type Response struct {
+	Status     string                     `json:"status"` // "ok" or "unavailable"
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Healthz reports that the process is alive. It does not check any
+// dependency, so a broken database does not get the service restarted.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, nil)
+}
+
+// Write writes the status of the components, the result of their checks, as
+// JSON. The service is unavailable if any component failed.
+func Write(w http.ResponseWriter, r *http.Request, components map[string]error) {
+	ctx := r.Context()
+
+	response := Response{Status: StatusOK}
+	status := http.StatusOK
+	if len(components) > 0 {
+		response.Components = make(map[string]ComponentStatus, len(components))
+	}
+	for name, err := range components {
+		if err != nil {
+			slog.DebugContext(ctx, "component not ready", "component", name, "error", err)
+			response.Components[name] = ComponentStatus{Status: StatusUnavailable, Error: err.Error()}
+			response.Status = StatusUnavailable
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Components[name] = ComponentStatus{Status: StatusOK}
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		err = fmt.Errorf("health: marshal response: %w", err)
+		slog.ErrorContext(ctx, err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if _, err = w.Write(responseBytes); err != nil {
+		err = fmt.Errorf("health: write to http writer: %w", err)
+		slog.ErrorContext(ctx, err.Error())
+	}
+}
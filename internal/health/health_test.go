@@ -0,0 +1,64 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		components map[string]error
+		wantStatus int
+		want       Response
+	}{
+		{
+			name:       "alive",
+			wantStatus: http.StatusOK,
+			want:       Response{Status: StatusOK},
+		},
+		{
+			name:       "ready",
+			components: map[string]error{"database": nil},
+			wantStatus: http.StatusOK,
+			want:       Response{Status: StatusOK, Components: map[string]ComponentStatus{"database": {Status: StatusOK}}},
+		},
+		{
+			name:       "component failed",
+			components: map[string]error{"database": nil, "tables": errors.New("table missing")},
+			wantStatus: http.StatusServiceUnavailable,
+			want: Response{Status: StatusUnavailable, Components: map[string]ComponentStatus{
+				"database": {Status: StatusOK},
+				"tables":   {Status: StatusUnavailable, Error: "table missing"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Write(w, httptest.NewRequest(http.MethodGet, "/readyz", nil), tt.components)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+
+			var got Response
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want.Status || len(got.Components) != len(tt.want.Components) {
+				t.Fatalf("response = %+v, want %+v", got, tt.want)
+			}
+			for name, component := range tt.want.Components {
+				if got.Components[name] != component {
+					t.Errorf("component %q = %+v, want %+v", name, got.Components[name], component)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package logging sets up the structured logs of the services and passes the
+// ID of a request on between them.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request between the services, so the
+// logs of both sides can be matched.
+const RequestIDHeader = "X-Request-ID"
+
+// Config configures the logger of a service.
+type Config struct {
+	Level slog.Level
+	// Output is stdout, stderr or the path of a file the logs are appended to.
+	Output string
+}
+
+type requestIDContextKey struct{}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(levelStr string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", levelStr)
+	}
+	return level, nil
+}
+
+// NewLogger returns a JSON logger that adds the request ID of the context to
+// every record. The returned closer closes the log file, if there is one.
+func NewLogger(config Config) (*slog.Logger, io.Closer, error) {
+	var output io.WriteCloser
+	switch config.Output {
+	case "stdout":
+		output = nopCloser{os.Stdout}
+	case "stderr":
+		output = nopCloser{os.Stderr}
+	default:
+		file, err := os.OpenFile(config.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open log file: %w", err)
+		}
+		output = file
+	}
+
+	handler := slog.NewJSONHandler(output, &slog.HandlerOptions{Level: config.Level})
+	return slog.New(requestIDHandler{handler}), output, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// requestIDHandler adds the request ID of the context to the records.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := RequestID(ctx); ok {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ContextWithRequestID returns a context that carries the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the request ID of the context, if it has one.
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok
+}
+
+// SetRequestID passes the request ID of the context on to another service.
+func SetRequestID(ctx context.Context, r *http.Request) {
+	if id, ok := RequestID(ctx); ok {
+		r.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// ValidRequestID only accepts short IDs of printable characters, so clients
+// cannot flood the logs through the header.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool { return r <= ' ' || r > '~' })
+}
+
+// WithRequestID takes the request ID from the X-Request-ID header or creates
+// one, stores it in the request context and returns it in the response. Every
+// request is logged on debug level when it is done.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := ContextWithRequestID(r.Context(), id)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		slog.DebugContext(ctx, "request done",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// statusRecorder remembers the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Fatal logs an error and exits, like log.Fatal.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
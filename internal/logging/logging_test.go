@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(requestIDHandler{slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	defaultLogger := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	handler := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.ErrorContext(r.Context(), "handler failed", "boat", "Bluebird")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "propagated", header: "website-backend-1", want: "website-backend-1"},
+		{name: "generated", header: ""},
+		{name: "invalid", header: "line\nbreak"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+
+			r := httptest.NewRequest(http.MethodPost, "/readposition", nil)
+			if tt.header != "" {
+				r.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.want != "" && id != tt.want {
+				t.Errorf("request ID = %q, want %q", id, tt.want)
+			}
+			if !ValidRequestID(id) || id == tt.header && tt.want == "" {
+				t.Errorf("request ID = %q, want a new one", id)
+			}
+
+			var records []map[string]any
+			for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+				var record map[string]any
+				if err := json.Unmarshal(line, &record); err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, record)
+			}
+			if len(records) != 2 {
+				t.Fatalf("got %d log records, want 2", len(records))
+			}
+			for _, record := range records {
+				if record["request_id"] != id {
+					t.Errorf("request_id of %q = %v, want %q", record["msg"], record["request_id"], id)
+				}
+			}
+			if records[0]["boat"] != "Bluebird" {
+				t.Errorf("boat = %v, want Bluebird", records[0]["boat"])
+			}
+			if records[1]["status"] != float64(http.StatusBadRequest) {
+				t.Errorf("status = %v, want %d", records[1]["status"], http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"time"
 
@@ -9,6 +10,9 @@ import (
 )
 
 func main() {
+	dataset := flag.String("dataset", "testdata", "name of the replay dataset to write")
+	flag.Parse()
+
 	c, err := loadConfig()
 	if err != nil {
 		log.Fatal("error loading config: ", err)
@@ -16,7 +20,7 @@ func main() {
 
 	ctx := context.Background()
 
-	dbClient, err := NewDatabaseClient(c.DBConfig, "positions_data_server_test")
+	dbClient, err := NewDatabaseClient(c.DBConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -60,12 +64,12 @@ func main() {
 		SendTime:  time.Now(),
 	}
 
-	err = dbClient.TruncateTable(ctx)
+	err = dbClient.DeleteDataset(ctx, *dataset)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = dbClient.InsertPositions(ctx, pushMessageRequest)
+	err = dbClient.InsertPositions(ctx, *dataset, pushMessageRequest)
 	if err != nil {
 		log.Fatal(err)
 	}
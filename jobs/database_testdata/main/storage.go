@@ -10,7 +10,6 @@ import (
 
 type DatabaseClient struct {
 	Database       *sql.DB
-	Table          string
 	defaultTimeout time.Duration
 }
 
@@ -22,7 +21,7 @@ type DatabaseConfig struct {
 	UserPassword string
 }
 
-func NewDatabaseClient(config DatabaseConfig, table string) (*DatabaseClient, error) {
+func NewDatabaseClient(config DatabaseConfig) (*DatabaseClient, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
 		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
 	db, err := sql.Open("pgx", dsn)
@@ -31,31 +30,32 @@ func NewDatabaseClient(config DatabaseConfig, table string) (*DatabaseClient, er
 	}
 	return &DatabaseClient{
 		Database:       db,
-		Table:          table,
 		defaultTimeout: time.Minute,
 	}, nil
 }
 
-func (c *DatabaseClient) TruncateTable(ctx context.Context) error {
-	query := fmt.Sprintf(`TRUNCATE TABLE "%s";`, c.Table)
+// DeleteDataset deletes all positions of a replay dataset.
+func (c *DatabaseClient) DeleteDataset(ctx context.Context, dataset string) error {
+	query := `DELETE FROM replay_positions WHERE dataset = $1;`
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	_, err := c.Database.ExecContext(ctx, query)
+	_, err := c.Database.ExecContext(ctx, query, dataset)
 	if err != nil {
-		return fmt.Errorf("truncate table: %w", err)
+		return fmt.Errorf("delete dataset: %w", err)
 	}
 
 	return nil
 }
 
-func (c *DatabaseClient) InsertPositions(ctx context.Context, position *PushMessageRequest) error {
+// InsertPositions adds positions to a replay dataset.
+func (c *DatabaseClient) InsertPositions(ctx context.Context, dataset string, position *PushMessageRequest) error {
 	if position == nil {
 		return errors.New("position is set to nil")
 	}
 
-	query := fmt.Sprintf(`INSERT INTO "%s"(boat, longitude, latitude, measure_time, send_time) VALUES ($1, $2, $3, $4, $5);`, c.Table)
+	query := `INSERT INTO replay_positions(dataset, boat, longitude, latitude, measure_time) VALUES ($1, $2, $3, $4, $5);`
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
@@ -64,11 +64,11 @@ func (c *DatabaseClient) InsertPositions(ctx context.Context, position *PushMess
 		_, err := c.Database.ExecContext(
 			ctx,
 			query,
+			dataset,
 			position.Positions[i].Boat,
 			position.Positions[i].Longitude,
 			position.Positions[i].Latitude,
 			position.Positions[i].MeasureTime,
-			position.SendTime,
 		)
 
 		if err != nil {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"github.com/joho/godotenv"
+	"os"
+	"strconv"
+)
+
+type config struct {
+	DBConfig   DatabaseConfig
+	SQLitePath string // the tokens are stored in this file instead, if set
+}
+
+func loadConfig() (*config, error) {
+	err := godotenv.Load("../.env")
+	if err != nil {
+		return nil, errors.New("error loading .env file")
+	}
+
+	// the storage of the data server, see its STORAGE
+	switch os.Getenv("STORAGE") {
+	case "", "postgres":
+	case "sqlite":
+		sqlitePath, ok := os.LookupEnv("SQLITE_PATH")
+		if !ok || sqlitePath == "" {
+			return nil, errors.New("SQLITE_PATH was not defined")
+		}
+		return &config{SQLitePath: sqlitePath}, nil
+	case "memory":
+		return nil, errors.New("the memory storage keeps no tokens, configure them with DEVICE_TOKENS of the data server")
+	default:
+		return nil, errors.New("STORAGE must be postgres or sqlite")
+	}
+
+	host, ok := os.LookupEnv("HOST")
+	if !ok {
+		return nil, errors.New("HOST was not defined")
+	}
+
+	portStr, ok := os.LookupEnv("PORT")
+	if !ok {
+		return nil, errors.New("PORT was not defined")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	dbName, ok := os.LookupEnv("DB_NAME")
+	if !ok {
+		return nil, errors.New("DB_NAME was not defined")
+	}
+
+	dbUserName, ok := os.LookupEnv("DB_USER_NAME")
+	if !ok {
+		return nil, errors.New("DB_USER_NAME was not defined")
+	}
+
+	dbUserPassword, ok := os.LookupEnv("DB_USER_PASSWORD")
+	if !ok {
+		return nil, errors.New("DB_USER_PASSWORD was not defined")
+	}
+
+	dbConfig := DatabaseConfig{
+		Host:         host,
+		Port:         port,
+		DatabaseName: dbName,
+		UserName:     dbUserName,
+		UserPassword: dbUserPassword,
+	}
+
+	return &config{
+		DBConfig: dbConfig,
+	}, nil
+}
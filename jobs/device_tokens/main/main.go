@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"regatta-watch/services/data-server/compact"
+)
+
+const usage = `usage:
+  go run . issue <device> [class]  issue a new token for a device, the class
+                                   selects the rate limit, default "default"
+  go run . revoke <device>         revoke all tokens of a device
+  go run . list                    list all tokens`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	ctx := context.Background()
+
+	var dbClient *DatabaseClient
+	if c.SQLitePath != "" {
+		dbClient, err = NewSQLiteClient(c.SQLitePath)
+	} else {
+		dbClient, err = NewDatabaseClient(c.DBConfig)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case os.Args[1] == "issue" && (len(os.Args) == 3 || len(os.Args) == 4):
+		deviceClass := "default"
+		if len(os.Args) == 4 {
+			deviceClass = os.Args[3]
+		}
+
+		token, err := newToken()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = dbClient.InsertCredential(ctx, os.Args[2], deviceClass, hashToken(token), hex.EncodeToString(compact.Key(token)))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("token for device %q: %s\n", os.Args[2], token)
+		fmt.Println("The token is not stored and cannot be shown again.")
+
+	case os.Args[1] == "revoke" && len(os.Args) == 3:
+		revoked, err := dbClient.RevokeCredentials(ctx, os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("revoked %d token(s) of device %q\n", revoked, os.Args[2])
+
+	case os.Args[1] == "list" && len(os.Args) == 2:
+		credentials, err := dbClient.GetCredentials(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, credential := range credentials {
+			status := "active"
+			if credential.RevokedTime != nil {
+				status = "revoked " + credential.RevokedTime.Format(time.RFC3339)
+			}
+			fmt.Printf("%-24s %-12s issued %s, %s\n", credential.DeviceID, credential.DeviceClass, credential.CreatedTime.Format(time.RFC3339), status)
+		}
+
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// newToken returns a random token with 256 bits of entropy.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken has to match the hashing of the data server.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
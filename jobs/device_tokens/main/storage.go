@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+type DatabaseClient struct {
+	Database       *sql.DB
+	defaultTimeout time.Duration
+	sqlite         bool // times are stored as unix microseconds
+}
+
+type DatabaseConfig struct {
+	Host         string
+	Port         int
+	DatabaseName string
+	UserName     string
+	UserPassword string
+}
+
+type Credential struct {
+	DeviceID    string
+	DeviceClass string
+	CreatedTime time.Time
+	RevokedTime *time.Time
+}
+
+func NewDatabaseClient(config DatabaseConfig) (*DatabaseClient, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
+		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database 'regatta': %w", err)
+	}
+	return &DatabaseClient{
+		Database:       db,
+		defaultTimeout: time.Minute,
+	}, nil
+}
+
+// NewSQLiteClient opens the SQLite file of the data server. The data server
+// creates the file and its tables, so it has to have been started once.
+func NewSQLiteClient(path string) (*DatabaseClient, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open sqlite database, start the data server once to create it: %w", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=rw&_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database %s: %w", path, err)
+	}
+	return &DatabaseClient{
+		Database:       db,
+		defaultTimeout: time.Minute,
+		sqlite:         true,
+	}, nil
+}
+
+// InsertCredential stores a token by its hash together with the key the
+// device signs compact packets with.
+func (c *DatabaseClient) InsertCredential(ctx context.Context, deviceID, deviceClass, tokenHash, compactKey string) error {
+	query := `INSERT INTO device_credentials(device_id, device_class, token_hash, compact_key) VALUES ($1, $2, $3, $4);`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.Database.ExecContext(ctx, query, deviceID, deviceClass, tokenHash, compactKey)
+	if err != nil {
+		return fmt.Errorf("insert credential: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeCredentials revokes all tokens of a device and returns how many
+// tokens were revoked.
+func (c *DatabaseClient) RevokeCredentials(ctx context.Context, deviceID string) (int64, error) {
+	query := `UPDATE device_credentials SET revoked_time = CURRENT_TIMESTAMP WHERE device_id = $1 AND revoked_time IS NULL;`
+	if c.sqlite {
+		query = `UPDATE device_credentials SET revoked_time = CAST(unixepoch('subsec') * 1000000 AS integer) WHERE device_id = $1 AND revoked_time IS NULL;`
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	result, err := c.Database.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return 0, fmt.Errorf("revoke credentials: %w", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (c *DatabaseClient) GetCredentials(ctx context.Context) ([]Credential, error) {
+	query := `SELECT device_id, device_class, created_time, revoked_time FROM device_credentials ORDER BY device_id, created_time;`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query credentials: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var credentials []Credential
+	for rows.Next() {
+		var credential Credential
+		if c.sqlite {
+			var createdTime int64
+			var revokedTime sql.NullInt64
+			err = rows.Scan(&credential.DeviceID, &credential.DeviceClass, &createdTime, &revokedTime)
+			credential.CreatedTime = time.UnixMicro(createdTime)
+			if revokedTime.Valid {
+				revoked := time.UnixMicro(revokedTime.Int64)
+				credential.RevokedTime = &revoked
+			}
+		} else {
+			err = rows.Scan(&credential.DeviceID, &credential.DeviceClass, &credential.CreatedTime, &credential.RevokedTime)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
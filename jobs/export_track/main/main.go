@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"regatta-watch/services/data-server/track"
+)
+
+func main() {
+	boat := flag.String("boat", "", "boat to export")
+	startRaw := flag.String("start", "", "start of the time range in RFC 3339, e.g. 2025-06-01T12:00:00Z")
+	endRaw := flag.String("end", "", "end of the time range in RFC 3339, default now")
+	format := flag.String("format", "", "gpx, kml or geojson, default taken from the output file or gpx")
+	output := flag.String("o", "", "output file, default stdout")
+	flag.Parse()
+
+	if *boat == "" || *startRaw == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	startTime, err := time.Parse(time.RFC3339, *startRaw)
+	if err != nil {
+		log.Fatal("error parsing start: ", err)
+	}
+	endTime := time.Now()
+	if *endRaw != "" {
+		endTime, err = time.Parse(time.RFC3339, *endRaw)
+		if err != nil {
+			log.Fatal("error parsing end: ", err)
+		}
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+		if *format == "" {
+			*format = track.FormatGPX
+		}
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	ctx := context.Background()
+
+	dbClient, err := NewDatabaseClient(c.DBConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+	}
+
+	trackWriter, err := track.NewWriter(*format, out, *boat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	points := 0
+	err = dbClient.ForEachPosition(ctx, *boat, startTime, endTime, func(position Position) error {
+		points++
+		return trackWriter.WritePoint(track.Point{
+			Latitude:  position.Latitude,
+			Longitude: position.Longitude,
+			Time:      position.MeasureTime,
+		})
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = trackWriter.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *output != "" {
+		fmt.Printf("exported %d positions of boat %q to %s\n", points, *boat, *output)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type DatabaseClient struct {
+	Database       *sql.DB
+	defaultTimeout time.Duration
+}
+
+type DatabaseConfig struct {
+	Host         string
+	Port         int
+	DatabaseName string
+	UserName     string
+	UserPassword string
+}
+
+type Position struct {
+	Longitude   float64
+	Latitude    float64
+	MeasureTime time.Time
+}
+
+func NewDatabaseClient(config DatabaseConfig) (*DatabaseClient, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
+		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database 'regatta': %w", err)
+	}
+	return &DatabaseClient{
+		Database:       db,
+		defaultTimeout: time.Hour,
+	}, nil
+}
+
+// ForEachPosition calls fn for every position of a boat in the time range
+// ordered by measure time.
+func (c *DatabaseClient) ForEachPosition(ctx context.Context, boat string, start, end time.Time, fn func(position Position) error) error {
+	query := `
+       SELECT longitude, latitude, measure_time
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, start, end)
+	if err != nil {
+		return fmt.Errorf("query position: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var position Position
+		err = rows.Scan(&position.Longitude, &position.Latitude, &position.MeasureTime)
+		if err != nil {
+			return fmt.Errorf("parse row: %w", err)
+		}
+		if err = fn(position); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"regatta-watch/services/data-server/track"
+)
+
+type DataServerConfig struct {
+	URL        string
+	AdminToken string
+}
+
+// DataServerClient imports positions through the /importpositions endpoint of
+// the data server, so they are validated, deduplicated and streamed like the
+// positions of all other ingest paths.
+type DataServerClient struct {
+	url        string
+	adminToken string
+	client     *http.Client
+}
+
+func NewDataServerClient(config DataServerConfig) *DataServerClient {
+	return &DataServerClient{
+		url:        config.URL,
+		adminToken: config.AdminToken,
+		client:     &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// pointsPerRequest limits the positions of a request, so it stays well below
+// the BULK_MAX_BYTES of the data server.
+const pointsPerRequest = 10000
+
+// importPosition is a position as the data server decodes it.
+type importPosition struct {
+	Boat        string    `json:"boat"`
+	DeviceID    string    `json:"device_id"`
+	Longitude   float64   `json:"longitude"`
+	Latitude    float64   `json:"latitude"`
+	MeasureTime time.Time `json:"measure_time"`
+}
+
+// ImportResult counts the positions of an import like the data server does.
+// Rejected are the inserted positions that failed the validation.
+type ImportResult struct {
+	Positions  int `json:"positions"`
+	Unassigned int `json:"unassigned"`
+	Inserted   int `json:"inserted"`
+	Duplicates int `json:"duplicates"`
+	Conflicts  int `json:"conflicts"`
+	Rejected   int `json:"rejected"`
+}
+
+func (r *ImportResult) add(other ImportResult) {
+	r.Positions += other.Positions
+	r.Unassigned += other.Unassigned
+	r.Inserted += other.Inserted
+	r.Duplicates += other.Duplicates
+	r.Conflicts += other.Conflicts
+	r.Rejected += other.Rejected
+}
+
+type importResponse struct {
+	Total ImportResult `json:"total"`
+	Error string       `json:"error"`
+}
+
+// ImportPositions imports the points of a track as positions of a boat.
+// Points with the measure time of a stored position of the boat are skipped.
+// The points are sent in requests of pointsPerRequest, the ones of requests
+// before an error stay stored, so the import can simply be repeated.
+func (c *DataServerClient) ImportPositions(ctx context.Context, boat, deviceID string, points []track.Point) (ImportResult, error) {
+	var result ImportResult
+	for start := 0; start < len(points); start += pointsPerRequest {
+		chunk := points[start:min(start+pointsPerRequest, len(points))]
+
+		total, err := c.importChunk(ctx, boat, deviceID, chunk)
+		result.add(total)
+		if err != nil {
+			return result, fmt.Errorf("import positions after %d: %w", result.Positions, err)
+		}
+	}
+	return result, nil
+}
+
+func (c *DataServerClient) importChunk(ctx context.Context, boat, deviceID string, points []track.Point) (ImportResult, error) {
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(gzipWriter)
+	for _, p := range points {
+		err := encoder.Encode(importPosition{
+			Boat:        boat,
+			DeviceID:    deviceID,
+			Longitude:   p.Longitude,
+			Latitude:    p.Latitude,
+			MeasureTime: p.Time,
+		})
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("encode position: %w", err)
+		}
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return ImportResult{}, fmt.Errorf("compress positions: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	request.Header.Set("Content-Encoding", "gzip")
+	request.Header.Set("Authorization", "Bearer "+c.adminToken)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("send request: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	// errors of the endpoint itself are answered with a summary, the ones of
+	// the authentication with plain text
+	var summary importResponse
+	if err = json.NewDecoder(response.Body).Decode(&summary); err != nil {
+		return ImportResult{}, fmt.Errorf("data server answered %s", response.Status)
+	}
+	if response.StatusCode != http.StatusOK {
+		return summary.Total, fmt.Errorf("data server answered %s: %s", response.Status, summary.Error)
+	}
+
+	return summary.Total, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"github.com/joho/godotenv"
+	"os"
+)
+
+type config struct {
+	DataServerConfig DataServerConfig
+}
+
+func loadConfig() (*config, error) {
+	err := godotenv.Load("../.env")
+	if err != nil {
+		return nil, errors.New("error loading .env file")
+	}
+
+	dataServerURL, ok := os.LookupEnv("DATA_SERVER_URL")
+	if !ok {
+		return nil, errors.New("DATA_SERVER_URL was not defined")
+	}
+
+	adminToken, ok := os.LookupEnv("ADMIN_TOKEN")
+	if !ok {
+		return nil, errors.New("ADMIN_TOKEN was not defined")
+	}
+
+	return &config{
+		DataServerConfig: DataServerConfig{
+			URL:        dataServerURL,
+			AdminToken: adminToken,
+		},
+	}, nil
+}
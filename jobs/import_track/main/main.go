@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"regatta-watch/services/data-server/track"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: go run . -boat <boat> [flags] <file>...")
+		flag.PrintDefaults()
+	}
+	boat := flag.String("boat", "", "boat the positions belong to")
+	deviceID := flag.String("device", "import", "device ID stored with the positions")
+	format := flag.String("format", "", "gpx or nmea, default gpx for .gpx files and nmea otherwise")
+	dateRaw := flag.String("date", "", "UTC date of NMEA logs without RMC sentences, e.g. 2024-06-01")
+	startRaw := flag.String("start", "", "skip positions before this time in RFC 3339")
+	endRaw := flag.String("end", "", "skip positions after this time in RFC 3339")
+	flag.Parse()
+
+	if *boat == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var date, startTime, endTime time.Time
+	var err error
+	if *dateRaw != "" {
+		if date, err = time.Parse(time.DateOnly, *dateRaw); err != nil {
+			log.Fatal("error parsing date: ", err)
+		}
+	}
+	if *startRaw != "" {
+		if startTime, err = time.Parse(time.RFC3339, *startRaw); err != nil {
+			log.Fatal("error parsing start: ", err)
+		}
+	}
+	if *endRaw != "" {
+		if endTime, err = time.Parse(time.RFC3339, *endRaw); err != nil {
+			log.Fatal("error parsing end: ", err)
+		}
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	ctx := context.Background()
+
+	dataServer := NewDataServerClient(c.DataServerConfig)
+
+	for _, path := range flag.Args() {
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = "nmea"
+			if strings.EqualFold(filepath.Ext(path), ".gpx") {
+				fileFormat = "gpx"
+			}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var points []track.Point
+		invalid := 0
+		switch fileFormat {
+		case "gpx":
+			points, err = readGPX(file)
+		case "nmea":
+			points, invalid, err = readNMEA(file, date)
+		default:
+			err = fmt.Errorf("unknown format %q", fileFormat)
+		}
+		_ = file.Close()
+		if err != nil {
+			log.Fatalf("error reading %s: %v", path, err)
+		}
+
+		read := len(points)
+		points = slices.DeleteFunc(points, func(p track.Point) bool {
+			return p.Time.IsZero() ||
+				(!startTime.IsZero() && p.Time.Before(startTime)) ||
+				(!endTime.IsZero() && p.Time.After(endTime))
+		})
+		outside := read - len(points)
+
+		result, err := dataServer.ImportPositions(ctx, *boat, *deviceID, points)
+		if err != nil {
+			log.Fatalf("error importing %s: %v", path, err)
+		}
+
+		fmt.Printf("%s: %d positions read, %d inserted of which %d rejected by the validation, %d skipped as already stored, %d skipped without time or outside the time range, %d invalid lines\n",
+			path, read, result.Inserted, result.Rejected, result.Duplicates, outside, invalid)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"regatta-watch/services/data-server/nmea"
+	"regatta-watch/services/data-server/track"
+)
+
+// readGPX returns the track points of a GPX file.
+func readGPX(r io.Reader) ([]track.Point, error) {
+	var points []track.Point
+	err := track.ReadGPX(r, func(p track.Point) error {
+		points = append(points, p)
+		return nil
+	})
+	return points, err
+}
+
+// readNMEA returns the fixes of an NMEA log and the number of lines that are
+// not valid sentences. Fixes are taken from RMC sentences. GGA sentences are
+// only used if the log has no RMC, they do not carry a date, so the log has
+// to start on the given date then.
+func readNMEA(r io.Reader, date time.Time) ([]track.Point, int, error) {
+	var rmcPoints, ggaPoints []track.Point
+	invalid := 0
+
+	day := date
+	var lastTimeOfDay time.Duration
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		sentence, err := nmea.Parse(scanner.Text())
+		if err != nil {
+			if !errors.Is(err, nmea.ErrUnsupported) {
+				invalid++
+			}
+			continue
+		}
+
+		switch sentence := sentence.(type) {
+		case nmea.RMC:
+			if sentence.Valid {
+				rmcPoints = append(rmcPoints, track.Point{Latitude: sentence.Latitude, Longitude: sentence.Longitude, Time: sentence.Time})
+			}
+		case nmea.GGA:
+			if sentence.FixQuality == 0 {
+				continue
+			}
+			// the log continues after midnight
+			if sentence.TimeOfDay < lastTimeOfDay {
+				day = day.AddDate(0, 0, 1)
+			}
+			lastTimeOfDay = sentence.TimeOfDay
+			ggaPoints = append(ggaPoints, track.Point{Latitude: sentence.Latitude, Longitude: sentence.Longitude, Time: day.Add(sentence.TimeOfDay)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, invalid, fmt.Errorf("read nmea log: %w", err)
+	}
+
+	if len(rmcPoints) > 0 || len(ggaPoints) == 0 {
+		return rmcPoints, invalid, nil
+	}
+	if date.IsZero() {
+		return nil, invalid, errors.New("the log only has GGA sentences without date, set -date")
+	}
+	return ggaPoints, invalid, nil
+}
@@ -14,7 +14,7 @@ func main() {
 		log.Fatal("error loading config: ", err)
 	}
 
-	dbClient, err := NewDatabaseClient(c.DBConfig, "positions_data_server_test")
+	dbClient, err := NewDatabaseClient(c.DBConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -24,6 +24,11 @@ func main() {
 		log.Fatal(err)
 	}
 
+	err = dbClient.CreateCourseTables(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = dbClient.CreateRegattaTable(ctx)
 	if err != nil {
 		log.Fatal(err)
@@ -48,4 +53,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	err = dbClient.CreateDataServerCursorTable(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -9,7 +9,6 @@ import (
 
 type DatabaseClient struct {
 	Database       *sql.DB
-	Table          string
 	defaultTimeout time.Duration
 }
 
@@ -21,7 +20,7 @@ type DatabaseConfig struct {
 	UserPassword string
 }
 
-func NewDatabaseClient(config DatabaseConfig, table string) (*DatabaseClient, error) {
+func NewDatabaseClient(config DatabaseConfig) (*DatabaseClient, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
 		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
 	db, err := sql.Open("pgx", dsn)
@@ -30,7 +29,6 @@ func NewDatabaseClient(config DatabaseConfig, table string) (*DatabaseClient, er
 	}
 	return &DatabaseClient{
 		Database:       db,
-		Table:          table,
 		defaultTimeout: time.Minute,
 	}, nil
 }
@@ -54,6 +52,42 @@ func (c *DatabaseClient) CreateBoatTable(ctx context.Context) error {
 	return err
 }
 
+// CreateCourseTables creates the courses and their marks in the order they
+// are rounded. The last mark is the start and finish line.
+func (c *DatabaseClient) CreateCourseTables(ctx context.Context) error {
+	query := fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS courses (
+            id text PRIMARY KEY
+        );
+        CREATE TABLE IF NOT EXISTS course_marks (
+            course_id text NOT NULL,
+            position int NOT NULL,
+            buoy_id text NOT NULL,
+
+            PRIMARY KEY (course_id, position),
+
+            CONSTRAINT fk_course
+                FOREIGN KEY (course_id)
+                REFERENCES courses (id)
+                ON DELETE CASCADE
+                ON UPDATE CASCADE
+        );
+        INSERT INTO courses (id) VALUES ('ASV.24h') ON CONFLICT DO NOTHING;
+        INSERT INTO course_marks (course_id, position, buoy_id) VALUES ('ASV.24h', 1, 'Schwanenwik bridge') ON CONFLICT DO NOTHING;
+        INSERT INTO course_marks (course_id, position, buoy_id) VALUES ('ASV.24h', 2, 'Kennedy bridge')     ON CONFLICT DO NOTHING;
+        INSERT INTO course_marks (course_id, position, buoy_id) VALUES ('ASV.24h', 3, 'Langer Zug')         ON CONFLICT DO NOTHING;
+        INSERT INTO course_marks (course_id, position, buoy_id) VALUES ('ASV.24h', 4, 'Pier')               ON CONFLICT DO NOTHING;
+    `)
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.Database.ExecContext(ctx, query)
+	return err
+}
+
+// CreateRegattaTable creates the regattas, each sailed on a course. Regattas of
+// databases created before courses existed get the course 'ASV.24h'.
 func (c *DatabaseClient) CreateRegattaTable(ctx context.Context) error {
 	query := fmt.Sprintf(`
         CREATE TABLE IF NOT EXISTS regattas (
@@ -61,9 +95,12 @@ func (c *DatabaseClient) CreateRegattaTable(ctx context.Context) error {
             start_time timestamptz NOT NULL,
             end_time timestamptz NOT NULL
         );
-        INSERT INTO regattas (id, start_time, end_time) VALUES ('ASV.24h.2024', '2024-08-03 13:00:00+02', '2024-08-04 14:00:00+02') ON CONFLICT DO NOTHING;
-        INSERT INTO regattas (id, start_time, end_time) VALUES ('ASV.24h.2025', '2025-08-02 13:00:00+02', '2025-08-03 14:00:00+02') ON CONFLICT DO NOTHING;
-        INSERT INTO regattas (id, start_time, end_time) VALUES ('Test',         '2025-05-31 00:00:00+00', '2025-08-01 00:00:00+00') ON CONFLICT DO NOTHING;
+        ALTER TABLE regattas ADD COLUMN IF NOT EXISTS course_id text REFERENCES courses (id) ON UPDATE CASCADE;
+        UPDATE regattas SET course_id = 'ASV.24h' WHERE course_id IS NULL;
+        ALTER TABLE regattas ALTER COLUMN course_id SET NOT NULL;
+        INSERT INTO regattas (id, start_time, end_time, course_id) VALUES ('ASV.24h.2024', '2024-08-03 13:00:00+02', '2024-08-04 14:00:00+02', 'ASV.24h') ON CONFLICT DO NOTHING;
+        INSERT INTO regattas (id, start_time, end_time, course_id) VALUES ('ASV.24h.2025', '2025-08-02 13:00:00+02', '2025-08-03 14:00:00+02', 'ASV.24h') ON CONFLICT DO NOTHING;
+        INSERT INTO regattas (id, start_time, end_time, course_id) VALUES ('Test',         '2025-05-31 00:00:00+00', '2025-08-01 00:00:00+00', 'ASV.24h') ON CONFLICT DO NOTHING;
     `)
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
@@ -221,3 +258,18 @@ func (c *DatabaseClient) CreateGPSDataTable(ctx context.Context) error {
 	_, err := c.Database.ExecContext(ctx, query)
 	return err
 }
+
+func (c *DatabaseClient) CreateDataServerCursorTable(ctx context.Context) error {
+	query := fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS data_server_cursors (
+            name text PRIMARY KEY,
+            cursor bigint NOT NULL
+        );
+        `)
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.Database.ExecContext(ctx, query)
+	return err
+}
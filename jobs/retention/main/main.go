@@ -0,0 +1,128 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func main() {
+	keep := flag.Duration("keep", 30*24*time.Hour, "keep positions of this age at full resolution")
+	interval := flag.Duration("interval", 30*time.Second, "keep one position per boat and interval of older positions")
+	archiveDir := flag.String("archive-dir", "archive", "directory for the archives of finished regattas")
+	dryRun := flag.Bool("dry-run", false, "only report what would be archived and deleted")
+	flag.Parse()
+
+	if flag.NArg() > 0 || *keep <= 0 || *interval <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	ctx := context.Background()
+
+	dbClient, err := NewDatabaseClient(c.DBConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = dbClient.Database.Close() }()
+
+	now := time.Now()
+
+	// archive before pruning, so a failed archive leaves the database as is
+	regattas, err := dbClient.GetFinishedRegattas(ctx, now)
+	if err != nil {
+		log.Fatal("error getting finished regattas: ", err)
+	}
+	archived := 0
+	for _, r := range regattas {
+		path, err := archivePath(*archiveDir, r.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err = os.Stat(path); err == nil {
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("would archive regatta %s to %s\n", r.ID, path)
+			archived++
+			continue
+		}
+
+		counts, err := archiveRegatta(ctx, dbClient, r, path)
+		if err != nil {
+			log.Fatalf("error archiving regatta %s: %v", r.ID, err)
+		}
+		fmt.Printf("archived regatta %s to %s: %d positions, %d gps data, %d rounds, %d sections\n",
+			r.ID, path, counts["positions_data_server"], counts["gps_data"], counts["rounds"], counts["sections"])
+		archived++
+	}
+
+	result, err := dbClient.Prune(ctx, now.Add(-*keep), *interval, *dryRun)
+	if err != nil {
+		log.Fatal("error pruning positions: ", err)
+	}
+
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	fmt.Printf("%d regattas archived, %s %d downsampled and %d rejected positions and %d downsampled gps data before %s\n",
+		archived, verb, result.PositionsDownsampled, result.RejectedDeleted, result.GPSDataDownsampled,
+		now.Add(-*keep).Format(time.RFC3339))
+}
+
+// archivePath returns the path of the archive of a regatta.
+func archivePath(dir, regattaID string) (string, error) {
+	if regattaID == "" || strings.ContainsAny(regattaID, `/\`) || regattaID == "." || regattaID == ".." {
+		return "", fmt.Errorf("regatta id %q is not a valid file name", regattaID)
+	}
+	return filepath.Join(dir, regattaID+".ndjson.gz"), nil
+}
+
+// archiveRegatta writes the gzipped archive of a regatta. The archive is
+// written to a temporary file first, so an existing archive is always
+// complete.
+func archiveRegatta(ctx context.Context, dbClient *DatabaseClient, r Regatta, path string) (map[string]int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create archive: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+
+	zw := gzip.NewWriter(f)
+	zw.Name = strings.TrimSuffix(filepath.Base(path), ".gz")
+	zw.ModTime = r.EndTime
+
+	counts, err := dbClient.ArchiveRegatta(ctx, r, zw)
+	if err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress archive: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return nil, fmt.Errorf("close archive: %w", err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return nil, fmt.Errorf("rename archive: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type DatabaseClient struct {
+	Database       *sql.DB
+	defaultTimeout time.Duration
+}
+
+type DatabaseConfig struct {
+	Host         string
+	Port         int
+	DatabaseName string
+	UserName     string
+	UserPassword string
+}
+
+func NewDatabaseClient(config DatabaseConfig) (*DatabaseClient, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
+		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database 'regatta': %w", err)
+	}
+	return &DatabaseClient{
+		Database:       db,
+		defaultTimeout: time.Hour,
+	}, nil
+}
+
+type Regatta struct {
+	ID        string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// GetFinishedRegattas returns the regattas that ended before the time.
+func (c *DatabaseClient) GetFinishedRegattas(ctx context.Context, before time.Time) ([]Regatta, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	query := `
+           SELECT id, start_time, end_time FROM regattas
+           WHERE end_time < $1
+           ORDER BY start_time;
+           `
+
+	rows, err := c.Database.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("query regattas: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var regattas []Regatta
+	for rows.Next() {
+		var r Regatta
+		if err = rows.Scan(&r.ID, &r.StartTime, &r.EndTime); err != nil {
+			return nil, fmt.Errorf("scan regatta: %w", err)
+		}
+		regattas = append(regattas, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate regattas: %w", err)
+	}
+
+	return regattas, nil
+}
+
+// archiveQueries select the rows of a regatta by table. Positions belong to a
+// regatta by their measure time, since the data server does not know
+// regattas.
+var archiveQueries = []struct {
+	table string
+	query string
+}{
+	{"positions_data_server", `SELECT * FROM positions_data_server WHERE measure_time BETWEEN $2 AND $3 ORDER BY boat, measure_time;`},
+	{"gps_data", `SELECT * FROM gps_data WHERE regatta_id = $1 OR measure_time BETWEEN $2 AND $3 ORDER BY boat_id, measure_time;`},
+	{"rounds", `SELECT * FROM rounds WHERE regatta_id = $1 ORDER BY boat_id, id;`},
+	{"sections", `SELECT * FROM sections WHERE regatta_id = $1 ORDER BY boat_id, round_id, id;`},
+}
+
+// ArchiveRegatta writes all rows of a regatta to w, one JSON object per line
+// with the table in "table" and the columns in "row". The rows are read in
+// one snapshot. It returns the number of rows by table.
+func (c *DatabaseClient) ArchiveRegatta(ctx context.Context, r Regatta, w io.Writer) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	encoder := json.NewEncoder(w)
+	counts := make(map[string]int)
+	for _, q := range archiveQueries {
+		n, err := archiveRows(ctx, tx, encoder, q.table, q.query, r.ID, r.StartTime, r.EndTime)
+		if err != nil {
+			return nil, fmt.Errorf("archive %s: %w", q.table, err)
+		}
+		counts[q.table] = n
+	}
+
+	return counts, nil
+}
+
+// archiveRow is a line of an archive.
+type archiveRow struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+func archiveRows(ctx context.Context, tx *sql.Tx, encoder *json.Encoder, table, query string, args ...any) (int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("query rows: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("get columns: %w", err)
+	}
+
+	n := 0
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return 0, fmt.Errorf("scan row: %w", err)
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		if err = encoder.Encode(archiveRow{Table: table, Row: row}); err != nil {
+			return 0, fmt.Errorf("write row: %w", err)
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return n, nil
+}
+
+// outsideRegattas restricts a query of a table aliased as t to rows measured
+// outside of every regatta, whose data is used for the results.
+const outsideRegattas = `
+           NOT EXISTS (
+               SELECT 1 FROM regattas r
+               WHERE t.measure_time BETWEEN r.start_time AND r.end_time
+           )`
+
+// PruneResult counts the rows deleted by Prune.
+type PruneResult struct {
+	PositionsDownsampled int
+	RejectedDeleted      int
+	GPSDataDownsampled   int
+}
+
+// Prune downsamples the positions measured before the time outside of every
+// regatta to the first position per boat and interval and deletes the old
+// rejected positions. Conflicts of deleted positions are deleted with them.
+// With dryRun the rows are counted but not deleted.
+func (c *DatabaseClient) Prune(ctx context.Context, before time.Time, interval time.Duration, dryRun bool) (PruneResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var result PruneResult
+	steps := []struct {
+		name  string
+		query string
+		args  []any
+		count *int
+	}{
+		{
+			name: "downsample positions",
+			query: `
+           DELETE FROM positions_data_server
+           WHERE id IN (
+               SELECT id FROM (
+                   SELECT id, row_number() OVER (
+                       PARTITION BY boat, floor(extract(epoch FROM measure_time) / $2::float8)
+                       ORDER BY measure_time, id
+                   ) AS n
+                   FROM positions_data_server t
+                   WHERE measure_time < $1 AND reject_reason IS NULL AND` + outsideRegattas + `
+               ) AS buckets
+               WHERE n > 1
+           );
+           `,
+			args:  []any{before, interval.Seconds()},
+			count: &result.PositionsDownsampled,
+		},
+		{
+			name: "delete rejected positions",
+			query: `
+           DELETE FROM positions_data_server t
+           WHERE measure_time < $1 AND reject_reason IS NOT NULL AND` + outsideRegattas + `;
+           `,
+			args:  []any{before},
+			count: &result.RejectedDeleted,
+		},
+		{
+			name: "downsample gps data",
+			query: `
+           DELETE FROM gps_data
+           WHERE id IN (
+               SELECT id FROM (
+                   SELECT id, row_number() OVER (
+                       PARTITION BY boat_id, floor(extract(epoch FROM measure_time) / $2::float8)
+                       ORDER BY measure_time, id
+                   ) AS n
+                   FROM gps_data t
+                   WHERE measure_time < $1 AND regatta_id IS NULL AND` + outsideRegattas + `
+               ) AS buckets
+               WHERE n > 1
+           );
+           `,
+			args:  []any{before, interval.Seconds()},
+			count: &result.GPSDataDownsampled,
+		},
+	}
+
+	for _, step := range steps {
+		res, err := tx.ExecContext(ctx, step.query, step.args...)
+		if err != nil {
+			return PruneResult{}, fmt.Errorf("%s: %w", step.name, err)
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return PruneResult{}, fmt.Errorf("%s: count rows: %w", step.name, err)
+		}
+		*step.count = int(rows)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return PruneResult{}, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return result, nil
+}
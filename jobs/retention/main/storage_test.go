@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestDatabaseClient connects to the database given by the DSN in
+// TEST_DATABASE_DSN, e.g. "host=localhost port=5432 user=regatta
+// password=1234 dbname=regatta_test", and skips if it is not set. The tables
+// of both services have to exist.
+func newTestDatabaseClient(tb testing.TB) *DatabaseClient {
+	tb.Helper()
+
+	dsn, ok := os.LookupEnv("TEST_DATABASE_DSN")
+	if !ok {
+		tb.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = db.Close() })
+
+	return &DatabaseClient{
+		Database:       db,
+		defaultTimeout: time.Minute,
+	}
+}
+
+// TestPrune prunes everything measured before 2002 in the test database.
+func TestPrune(t *testing.T) {
+	c := newTestDatabaseClient(t)
+	ctx := context.Background()
+
+	cleanUp := func() {
+		_, err := c.Database.ExecContext(ctx, `
+           DELETE FROM positions_data_server WHERE boat = 'retention';
+           DELETE FROM gps_data WHERE boat_id = 'retention';
+           DELETE FROM regattas WHERE id = 'retention.2001';
+           DELETE FROM courses WHERE id = 'retention';
+           DELETE FROM boats WHERE id = 'retention';
+           `)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanUp()
+	t.Cleanup(cleanUp)
+
+	// the regatta is sailed from 10:00 to 12:00, the positions are three per
+	// 30 seconds before and during it
+	_, err := c.Database.ExecContext(ctx, `
+           INSERT INTO boats (id, class, yardstick) VALUES ('retention', 'retention', 100);
+           INSERT INTO courses (id) VALUES ('retention');
+           INSERT INTO regattas (id, start_time, end_time, course_id)
+           VALUES ('retention.2001', '2001-06-01 10:00:00+00', '2001-06-01 12:00:00+00', 'retention');
+           INSERT INTO positions_data_server (boat, latitude, longitude, measure_time, reject_reason) VALUES
+               ('retention', 53.5, 10.0, '2001-06-01 09:00:00+00', NULL),
+               ('retention', 53.5, 10.0, '2001-06-01 09:00:10+00', NULL),
+               ('retention', 53.5, 10.0, '2001-06-01 09:00:20+00', 'zero coordinates'),
+               ('retention', 53.5, 10.0, '2001-06-01 10:30:00+00', NULL),
+               ('retention', 53.5, 10.0, '2001-06-01 10:30:10+00', NULL),
+               ('retention', 53.5, 10.0, '2001-06-01 10:30:20+00', 'zero coordinates');
+           INSERT INTO gps_data (regatta_id, boat_id, latitude, longitude, measure_time) VALUES
+               (NULL, 'retention', 53.5, 10.0, '2001-06-01 09:00:00+00'),
+               (NULL, 'retention', 53.5, 10.0, '2001-06-01 09:00:10+00'),
+               (NULL, 'retention', 53.5, 10.0, '2001-06-01 09:00:20+00'),
+               ('retention.2001', 'retention', 53.5, 10.0, '2001-06-01 09:30:00+00'),
+               ('retention.2001', 'retention', 53.5, 10.0, '2001-06-01 09:30:10+00'),
+               (NULL, 'retention', 53.5, 10.0, '2001-06-01 10:30:00+00'),
+               (NULL, 'retention', 53.5, 10.0, '2001-06-01 10:30:10+00');
+           `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err = c.Prune(ctx, before, 30*time.Second, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := measureTimes(t, c, `SELECT measure_time FROM positions_data_server WHERE boat = 'retention' ORDER BY measure_time;`); len(got) != 6 {
+		t.Errorf("a dry run left %d of 6 positions", len(got))
+	}
+
+	if _, err = c.Prune(ctx, before, 30*time.Second, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// positions of the regatta are kept at full resolution, rejected ones as well
+	wantPositions := []string{"09:00:00", "10:30:00", "10:30:10", "10:30:20"}
+	got := measureTimes(t, c, `SELECT measure_time FROM positions_data_server WHERE boat = 'retention' ORDER BY measure_time;`)
+	if !slices.Equal(got, wantPositions) {
+		t.Errorf("positions at %v, want %v", got, wantPositions)
+	}
+
+	// gps data of a regatta is kept, whether by its time or its regatta ID
+	wantGPSData := []string{"09:00:00", "09:30:00", "09:30:10", "10:30:00", "10:30:10"}
+	got = measureTimes(t, c, `SELECT measure_time FROM gps_data WHERE boat_id = 'retention' ORDER BY measure_time;`)
+	if !slices.Equal(got, wantGPSData) {
+		t.Errorf("gps data at %v, want %v", got, wantGPSData)
+	}
+}
+
+// measureTimes returns the measure times a query selects as UTC clock times.
+func measureTimes(t *testing.T, c *DatabaseClient, query string) []string {
+	t.Helper()
+
+	rows, err := c.Database.QueryContext(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var times []string
+	for rows.Next() {
+		var measureTime time.Time
+		if err = rows.Scan(&measureTime); err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, measureTime.UTC().Format(time.TimeOnly))
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return times
+}
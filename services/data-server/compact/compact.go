@@ -0,0 +1,225 @@
+// Package compact encodes batches of GPS fixes of a tracker as small binary
+// packets for low-bandwidth links like LoRa or satellite. A packet carries
+// the first fix of a batch in full and every further fix as the difference
+// to the previous one, all as varints, so a fix usually takes 4 to 6 bytes.
+// Packets are signed with a truncated HMAC, so they can be sent without a
+// connection, e.g. over UDP.
+//
+// Version 1 of a packet is laid out as:
+//
+//	version      byte, 1
+//	device ID    uvarint length, UTF-8 bytes
+//	fix count    uvarint, at least 1
+//	first fix    uvarint Unix time in seconds, varint latitude, varint longitude
+//	further fix  uvarint seconds since the previous fix, varint latitude and
+//	             longitude difference to the previous fix
+//	MAC          first 8 bytes of the HMAC-SHA256 of everything before
+//
+// Coordinates are in units of 1e-5 degrees, about 1.1 m. The fixes of a
+// packet are in ascending order of time.
+package compact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Version1 is the version of the packet layout described above.
+const Version1 = 1
+
+const (
+	// MACSize is the size of the truncated HMAC at the end of a packet.
+	MACSize = 8
+	// coordinateScale is the number of coordinate units per degree.
+	coordinateScale = 1e5
+	// minFixSize is the smallest encoded size of a fix.
+	minFixSize = 3
+)
+
+var (
+	// ErrVersion is returned for packets of an unknown version.
+	ErrVersion = errors.New("compact: unsupported version")
+	// ErrMalformed is returned for packets that cannot be decoded.
+	ErrMalformed = errors.New("compact: malformed packet")
+)
+
+// Fix is a position of a tracker at a time.
+type Fix struct {
+	Time      time.Time // truncated to seconds
+	Latitude  float64
+	Longitude float64
+}
+
+// Packet is a decoded packet. Its MAC has to be checked with Verify before
+// the fixes are trusted.
+type Packet struct {
+	Version  int
+	DeviceID string
+	Fixes    []Fix
+
+	signed []byte
+	mac    []byte
+}
+
+// Key returns the key the packets of a device are signed with, derived from
+// the device token with HMAC-SHA256. It differs from the token hash the data
+// server looks up tokens with, so the hash cannot sign packets.
+func Key(token string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("compact-v1"))
+	return mac.Sum(nil)
+}
+
+// Encode returns the packet of the fixes of a device signed with the key.
+func Encode(deviceID string, key []byte, fixes []Fix) ([]byte, error) {
+	if len(fixes) == 0 {
+		return nil, errors.New("compact: no fixes")
+	}
+
+	b := []byte{Version1}
+	b = binary.AppendUvarint(b, uint64(len(deviceID)))
+	b = append(b, deviceID...)
+	b = binary.AppendUvarint(b, uint64(len(fixes)))
+
+	var previous Fix
+	var previousLat, previousLon int64
+	for i, fix := range fixes {
+		if fix.Latitude < -90 || fix.Latitude > 90 || fix.Longitude < -180 || fix.Longitude > 180 {
+			return nil, fmt.Errorf("compact: fix %d: coordinates %f, %f out of range", i, fix.Latitude, fix.Longitude)
+		}
+		lat := int64(math.Round(fix.Latitude * coordinateScale))
+		lon := int64(math.Round(fix.Longitude * coordinateScale))
+
+		if i == 0 {
+			if fix.Time.Unix() < 0 {
+				return nil, fmt.Errorf("compact: fix %d: time %s before 1970", i, fix.Time)
+			}
+			b = binary.AppendUvarint(b, uint64(fix.Time.Unix()))
+			b = binary.AppendVarint(b, lat)
+			b = binary.AppendVarint(b, lon)
+		} else {
+			delta := fix.Time.Unix() - previous.Time.Unix()
+			if delta < 0 {
+				return nil, fmt.Errorf("compact: fix %d: time %s before the previous fix", i, fix.Time)
+			}
+			b = binary.AppendUvarint(b, uint64(delta))
+			b = binary.AppendVarint(b, lat-previousLat)
+			b = binary.AppendVarint(b, lon-previousLon)
+		}
+
+		previous, previousLat, previousLon = fix, lat, lon
+	}
+
+	return append(b, sign(key, b)...), nil
+}
+
+// Decode decodes a packet without checking its MAC.
+func Decode(data []byte) (*Packet, error) {
+	if len(data) < 1+MACSize {
+		return nil, fmt.Errorf("%w: %d bytes are too short", ErrMalformed, len(data))
+	}
+	if data[0] != Version1 {
+		return nil, fmt.Errorf("%w %d", ErrVersion, data[0])
+	}
+
+	signed := data[:len(data)-MACSize]
+	d := decoder{b: signed[1:]}
+
+	deviceIDLen := d.uvarint()
+	if deviceIDLen > uint64(len(d.b)) {
+		return nil, fmt.Errorf("%w: device ID longer than the packet", ErrMalformed)
+	}
+	deviceID := string(d.b[:deviceIDLen])
+	d.b = d.b[deviceIDLen:]
+
+	count := d.uvarint()
+	if count == 0 || count > uint64(len(d.b)/minFixSize) {
+		return nil, fmt.Errorf("%w: invalid fix count %d", ErrMalformed, count)
+	}
+
+	fixes := make([]Fix, 0, count)
+	var unix, lat, lon int64
+	for i := uint64(0); i < count; i++ {
+		if i == 0 {
+			unix = int64(d.uvarint())
+			lat = d.varint()
+			lon = d.varint()
+		} else {
+			unix += int64(d.uvarint())
+			lat += d.varint()
+			lon += d.varint()
+		}
+		if d.err != nil {
+			return nil, fmt.Errorf("%w: fix %d: %w", ErrMalformed, i, d.err)
+		}
+
+		fix := Fix{
+			Time:      time.Unix(unix, 0).UTC(),
+			Latitude:  float64(lat) / coordinateScale,
+			Longitude: float64(lon) / coordinateScale,
+		}
+		if fix.Latitude < -90 || fix.Latitude > 90 || fix.Longitude < -180 || fix.Longitude > 180 {
+			return nil, fmt.Errorf("%w: fix %d: coordinates %f, %f out of range", ErrMalformed, i, fix.Latitude, fix.Longitude)
+		}
+		fixes = append(fixes, fix)
+	}
+	if len(d.b) > 0 {
+		return nil, fmt.Errorf("%w: %d bytes after the last fix", ErrMalformed, len(d.b))
+	}
+
+	return &Packet{
+		Version:  Version1,
+		DeviceID: deviceID,
+		Fixes:    fixes,
+		signed:   signed,
+		mac:      data[len(data)-MACSize:],
+	}, nil
+}
+
+// Verify reports if the packet was signed with the key.
+func (p *Packet) Verify(key []byte) bool {
+	return hmac.Equal(p.mac, sign(key, p.signed))
+}
+
+func sign(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)[:MACSize]
+}
+
+// decoder reads varints and keeps the first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errors.New("invalid uvarint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errors.New("invalid varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
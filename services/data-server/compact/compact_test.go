@@ -0,0 +1,105 @@
+package compact
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	start := time.Date(2024, 8, 2, 12, 0, 0, 0, time.UTC)
+	fixes := []Fix{
+		{Time: start, Latitude: 53.56550, Longitude: 10.00910},
+		{Time: start.Add(5 * time.Second), Latitude: 53.56562, Longitude: 10.00897},
+		{Time: start.Add(10 * time.Second), Latitude: 53.56571, Longitude: 10.00880},
+		{Time: start.Add(10 * time.Second), Latitude: -33.86785, Longitude: -151.20732},
+	}
+	key := Key("secret-token")
+
+	data, err := Encode("bluebird/lora", key, fixes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header, 11 bytes of the first fix, 3 small deltas, one large delta, MAC
+	if len(data) > 16+11+3*5+10+MACSize {
+		t.Errorf("packet has %d bytes, want it compact", len(data))
+	}
+
+	packet, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !packet.Verify(key) {
+		t.Error("packet not verified with its key")
+	}
+	if packet.Verify(Key("other-token")) {
+		t.Error("packet verified with another key")
+	}
+	if packet.DeviceID != "bluebird/lora" {
+		t.Errorf("device ID = %q, want %q", packet.DeviceID, "bluebird/lora")
+	}
+	if len(packet.Fixes) != len(fixes) {
+		t.Fatalf("got %d fixes, want %d", len(packet.Fixes), len(fixes))
+	}
+	for i, fix := range packet.Fixes {
+		if !fix.Time.Equal(fixes[i].Time) || fix.Latitude != fixes[i].Latitude || fix.Longitude != fixes[i].Longitude {
+			t.Errorf("fix %d = %+v, want %+v", i, fix, fixes[i])
+		}
+	}
+
+	// a flipped bit anywhere invalidates the MAC or the packet
+	for i := range data {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 0x01
+		packet, err := Decode(tampered)
+		if err == nil && packet.Verify(key) {
+			t.Errorf("packet with flipped bit in byte %d verified", i)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	start := time.Date(2024, 8, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		fixes []Fix
+	}{
+		{name: "no fixes"},
+		{name: "descending", fixes: []Fix{{Time: start}, {Time: start.Add(-time.Second)}}},
+		{name: "latitude out of range", fixes: []Fix{{Time: start, Latitude: 91}}},
+		{name: "before 1970", fixes: []Fix{{Time: time.Unix(-1, 0)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Encode("device", Key("token"), tt.fixes); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid, err := Encode("device", Key("token"), []Fix{{Time: time.Unix(1722600000, 0), Latitude: 53.5, Longitude: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "empty", data: nil, want: ErrMalformed},
+		{name: "version", data: append([]byte{2}, valid[1:]...), want: ErrVersion},
+		{name: "truncated", data: append(append([]byte(nil), valid[:len(valid)-MACSize-2]...), valid[len(valid)-MACSize:]...), want: ErrMalformed},
+		{name: "trailing bytes", data: append(append(append([]byte(nil), valid[:len(valid)-MACSize]...), 0, 0, 0), valid[len(valid)-MACSize:]...), want: ErrMalformed},
+		{name: "huge fix count", data: append([]byte{Version1, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}, valid[len(valid)-MACSize:]...), want: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
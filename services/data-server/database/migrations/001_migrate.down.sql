@@ -1,2 +0,0 @@
-DROP TABLE "position";
-DROP TABLE "battery";
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type deviceContextKey struct{}
+
+// hashToken returns the hash of a device token as it is stored in the
+// database. Tokens are long random strings, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// requestCredentials returns the user name and token of a request. OwnTracks
+// sends them with HTTP Basic authentication, other trackers can send the
+// token as bearer token.
+func requestCredentials(r *http.Request) (string, string, bool) {
+	if userName, password, ok := r.BasicAuth(); ok {
+		return userName, password, true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && token != "" {
+		return "", token, true
+	}
+
+	return "", "", false
+}
+
+// authenticatedDevice returns the device ID that was authenticated by
+// RequireDevice.
+func authenticatedDevice(ctx context.Context) (string, bool) {
+	deviceID, ok := ctx.Value(deviceContextKey{}).(string)
+	return deviceID, ok
+}
+
+// RequireDevice only passes requests with a valid device token to the next
+// handler. The ID of the device is stored in the request context. A Basic
+// authentication user name must either be the device ID or, as sent by
+// OwnTracks, its user part. If the request carries the OwnTracks
+// X-Limit-U/X-Limit-D headers, they have to name the same device. Requests
+// are rate limited by remote address before and by device after the
+// authentication.
+func (s *regattaService) RequireDevice(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if !s.allowRequest(w, r, s.ipLimiter, "ip", remoteIP(r.RemoteAddr)) {
+			return
+		}
+
+		userName, token, ok := requestCredentials(r)
+		if !ok {
+			s.rejectPush(w, r, userName, errors.New("no credentials"))
+			return
+		}
+
+		deviceID, deviceClass, err := s.storageClient.GetDeviceOfToken(ctx, hashToken(token))
+		if err != nil {
+			err = fmt.Errorf("authenticate device: %w", err)
+			s.LogError(ctx, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if deviceID == "" {
+			s.rejectPush(w, r, userName, errors.New("unknown or revoked token"))
+			return
+		}
+		if userName != "" && userName != deviceID && !strings.HasPrefix(deviceID, userName+"/") {
+			s.rejectPush(w, r, userName, fmt.Errorf("token belongs to device %q", deviceID))
+			return
+		}
+		if user, device := r.Header.Get("X-Limit-U"), r.Header.Get("X-Limit-D"); user != "" && device != "" && user+"/"+device != deviceID {
+			s.rejectPush(w, r, user+"/"+device, fmt.Errorf("token belongs to device %q", deviceID))
+			return
+		}
+
+		if !s.allowRequest(w, r, s.deviceLimiter(deviceClass), "device:"+deviceClass, deviceID) {
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(ctx, deviceContextKey{}, deviceID)))
+	}
+}
+
+// RequireAdmin only passes requests with the admin token, sent as bearer
+// token or as Basic authentication password, to the next handler. The routes
+// that manage devices use it, so spectators cannot move a device to another
+// boat. Requests are rate limited by remote address, so the token cannot be
+// guessed.
+func (s *regattaService) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowRequest(w, r, s.ipLimiter, "ip", remoteIP(r.RemoteAddr)) {
+			return
+		}
+
+		if s.adminTokenHash == "" {
+			http.Error(w, "Admin routes are disabled, set ADMIN_TOKEN", http.StatusForbidden)
+			return
+		}
+
+		_, token, ok := requestCredentials(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.adminTokenHash)) != 1 {
+			s.LogError(r.Context(), fmt.Errorf("reject admin request to %s", r.URL.Path), "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="regatta-watch admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *regattaService) rejectPush(w http.ResponseWriter, r *http.Request, deviceID string, reason error) {
+	rejected := s.rejectedPushes.Add(1)
+	rejectedPushesTotal.Inc()
+	s.LogError(r.Context(), fmt.Errorf("reject push to %s: %w", r.URL.Path, reason),
+		"device_id", deviceID, "remote_addr", r.RemoteAddr, "rejected_pushes", rejected)
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="regatta-watch"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
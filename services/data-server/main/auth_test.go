@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	const adminToken = "0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		wantStatus int
+	}{
+		{name: "disabled", token: adminToken, wantStatus: http.StatusForbidden},
+		{name: "no token", adminToken: adminToken, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: adminToken, token: "fedcba9876543210", wantStatus: http.StatusUnauthorized},
+		{name: "admin token", adminToken: adminToken, token: adminToken, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRegattaService(newMemoryStorage(), defaultValidationConfig(), 0, defaultLimitConfig(), tt.adminToken)
+			handler := s.RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/assigndevice", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRequireDeviceMemoryToken(t *testing.T) {
+	const token = "0123456789abcdef"
+
+	storage := newMemoryStorage()
+	storage.addToken("bluebird", token)
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+	handler := s.RequireDevice(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		token      string
+		wantStatus int
+	}{
+		{token: token, wantStatus: http.StatusNoContent},
+		{token: "fedcba9876543210", wantStatus: http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/pushposition", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("token %q: status = %d, want %d", tt.token, w.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// bulkChunkSize is the number of positions of a bulk upload that are
+// validated and stored together.
+const bulkChunkSize = 1000
+
+// decodeBulkPositions decodes positions given as JSON array or as NDJSON, one
+// position per line, and calls fn with chunks of at most chunkSize positions.
+func decodeBulkPositions(r io.Reader, chunkSize int, fn func(positions []Position) error) error {
+	reader := bufio.NewReader(r)
+
+	// an array starts with '[', NDJSON with the '{' of the first position
+	var first byte
+	for {
+		b, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			first = b
+			break
+		}
+	}
+	if err := reader.UnreadByte(); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	isArray := first == '['
+	if isArray {
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("decode array: %w", err)
+		}
+	}
+
+	chunk := make([]Position, 0, chunkSize)
+	for i := 0; ; i++ {
+		if isArray && !decoder.More() {
+			break
+		}
+
+		var position Position
+		err := decoder.Decode(&position)
+		if !isArray && errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decode position %d: %w", i, err)
+		}
+
+		chunk = append(chunk, position)
+		if len(chunk) == chunkSize {
+			if err = fn(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	if isArray {
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("decode array: %w", err)
+		}
+	}
+
+	if len(chunk) > 0 {
+		return fn(chunk)
+	}
+	return nil
+}
+
+// assignedBoat returns the boat a device was assigned to at the given time,
+// or "" if it was not assigned.
+func assignedBoat(assignments []DeviceAssignment, at time.Time) string {
+	for _, assignment := range assignments {
+		if !at.Before(assignment.StartTime) && (assignment.EndTime == nil || at.Before(*assignment.EndTime)) {
+			return assignment.Boat
+		}
+	}
+	return ""
+}
+
+// PushBulk stores the queued positions of a tracker that was offline. The body
+// is a JSON array or NDJSON of positions, optionally compressed with
+// Content-Encoding gzip. The positions are stored in chunks like the ones of
+// the other ingest paths, the response summarizes every chunk. Chunks that
+// were stored before an error stay stored, so the upload can simply be
+// repeated.
+func (s *regattaService) PushBulk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deviceID, _ := authenticatedDevice(ctx)
+
+	assignments, err := s.storageClient.GetAssignmentsOfDevice(ctx, deviceID)
+	if err != nil {
+		err = fmt.Errorf("push bulk: get assignments of device: %w", err)
+		s.LogError(ctx, err, "device_id", deviceID)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.storeBulk(w, r, "push bulk", []any{"device_id", deviceID}, func(position *Position) bool {
+		position.Boat = assignedBoat(assignments, position.MeasureTime)
+		position.DeviceID = deviceID
+		return position.Boat != ""
+	})
+}
+
+// ImportPositions stores the positions of logged tracks, e.g. of the
+// import_track job. The body is the one of PushBulk, but every position names
+// its boat and device. Positions without them are counted as unassigned. The
+// positions are validated, stored and streamed like the ones of all other
+// ingest paths.
+func (s *regattaService) ImportPositions(w http.ResponseWriter, r *http.Request) {
+	s.storeBulk(w, r, "import positions", nil, func(position *Position) bool {
+		return position.Boat != "" && position.DeviceID != ""
+	})
+}
+
+// storeBulk stores the positions in the body of a bulk request in chunks and
+// writes the summary of the chunks. assign sets the boat and device of a
+// position and reports whether it is assigned to a boat, unassigned positions
+// are skipped.
+func (s *regattaService) storeBulk(w http.ResponseWriter, r *http.Request, op string, logArgs []any, assign func(position *Position) bool) {
+	ctx := r.Context()
+
+	var body io.ReadCloser = http.MaxBytesReader(w, r.Body, s.bulkMaxBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			err = fmt.Errorf("%s: read gzip header: %w", op, err)
+			s.LogError(ctx, err, logArgs...)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = gzipReader.Close() }()
+
+		// limit the decompressed size as well
+		body = http.MaxBytesReader(w, gzipReader, s.bulkMaxBytes)
+	}
+
+	var response PushBulkResponse
+	var insertErr error
+	err := decodeBulkPositions(body, bulkChunkSize, func(positions []Position) error {
+		chunk := BulkChunkResult{Positions: len(positions)}
+
+		pmr := PushMessageRequest{SendTime: time.Now()}
+		for _, position := range positions {
+			if !assign(&position) {
+				chunk.Unassigned++
+				continue
+			}
+			pmr.Positions = append(pmr.Positions, position)
+		}
+
+		if len(pmr.Positions) > 0 {
+			chunk.InsertResult, insertErr = s.insertPositions(ctx, &pmr)
+			if insertErr != nil {
+				return insertErr
+			}
+		}
+
+		response.Chunks = append(response.Chunks, chunk)
+		response.Total.add(chunk)
+		return nil
+	})
+
+	status := http.StatusOK
+	if err != nil {
+		err = fmt.Errorf("%s after %d positions: %w", op, response.Total.Positions, err)
+		s.LogError(ctx, err, logArgs...)
+		response.Error = err.Error()
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case insertErr != nil:
+			status = http.StatusInternalServerError
+		case errors.As(err, &maxBytesErr):
+			oversizedBodiesTotal.Inc()
+			status = http.StatusRequestEntityTooLarge
+		default:
+			status = http.StatusBadRequest
+		}
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		err = fmt.Errorf("%s: marshal response: %w", op, err)
+		s.LogError(ctx, err, logArgs...)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(responseBytes); err != nil {
+		err = fmt.Errorf("%s: write to http writer: %w", op, err)
+		s.LogError(ctx, err, logArgs...)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeBulkPositions(t *testing.T) {
+	ndjson := `{"latitude": 53.1, "longitude": 10.1, "measure_time": "2025-06-01T12:00:00Z"}
+{"latitude": 53.2, "longitude": 10.2, "measure_time": "2025-06-01T12:00:01Z", "accuracy": 5}
+
+{"latitude": 53.3, "longitude": 10.3, "measure_time": "2025-06-01T12:00:02Z"}
+`
+	array := ` [{"latitude": 53.1, "longitude": 10.1, "measure_time": "2025-06-01T12:00:00Z"},
+ {"latitude": 53.2, "longitude": 10.2, "measure_time": "2025-06-01T12:00:01Z", "accuracy": 5},
+ {"latitude": 53.3, "longitude": 10.3, "measure_time": "2025-06-01T12:00:02Z"}]`
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, _ = gzipWriter.Write([]byte(ndjson))
+	_ = gzipWriter.Close()
+	gzipReader, err := gzip.NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body func() *strings.Reader
+	}{
+		{name: "NDJSON", body: func() *strings.Reader { return strings.NewReader(ndjson) }},
+		{name: "array", body: func() *strings.Reader { return strings.NewReader(array) }},
+	}
+
+	check := func(t *testing.T, chunks [][]Position) {
+		t.Helper()
+		if len(chunks) != 2 || len(chunks[0]) != 2 || len(chunks[1]) != 1 {
+			t.Fatalf("got chunks %v, want two chunks of 2 and 1 positions", chunks)
+		}
+		if chunks[1][0].Latitude != 53.3 || !chunks[1][0].MeasureTime.Equal(time.Date(2025, time.June, 1, 12, 0, 2, 0, time.UTC)) {
+			t.Errorf("last position = %+v", chunks[1][0])
+		}
+		if chunks[0][1].Accuracy == nil || *chunks[0][1].Accuracy != 5 {
+			t.Errorf("accuracy of second position = %v, want 5", chunks[0][1].Accuracy)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks [][]Position
+			err := decodeBulkPositions(tt.body(), 2, func(positions []Position) error {
+				chunks = append(chunks, append([]Position(nil), positions...))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, chunks)
+		})
+	}
+
+	t.Run("gzip NDJSON", func(t *testing.T) {
+		var chunks [][]Position
+		err := decodeBulkPositions(gzipReader, 2, func(positions []Position) error {
+			chunks = append(chunks, append([]Position(nil), positions...))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, chunks)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		chunks := 0
+		body := strings.NewReader(`{"latitude": 53.1, "longitude": 10.1, "measure_time": "2025-06-01T12:00:00Z"}
+{"latitude": 53.2, "longitude": 10.2, "measure_time": "2025-06-01T12:00:01Z"}
+{"latitude": "north"}`)
+		err := decodeBulkPositions(body, 2, func(positions []Position) error {
+			chunks++
+			return nil
+		})
+		if err == nil {
+			t.Fatal("decodeBulkPositions() error = nil")
+		}
+		if chunks != 1 {
+			t.Errorf("%d chunks before the malformed position, want 1", chunks)
+		}
+	})
+}
+
+func TestAssignedBoat(t *testing.T) {
+	start := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	assignments := []DeviceAssignment{
+		{Boat: "Bluebird", StartTime: start, EndTime: &end},
+		{Boat: "Vivace", StartTime: end},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{at: start.Add(-time.Second), want: ""},
+		{at: start, want: "Bluebird"},
+		{at: end, want: "Vivace"},
+		{at: end.Add(24 * time.Hour), want: "Vivace"},
+	}
+	for _, tt := range tests {
+		if got := assignedBoat(assignments, tt.at); got != tt.want {
+			t.Errorf("assignedBoat(%s) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestImportPositions(t *testing.T) {
+	const adminToken = "0123456789abcdef"
+	now := time.Now().UTC().Truncate(time.Second)
+
+	storage := newMemoryStorage()
+	s := newRegattaService(storage, defaultValidationConfig(), 1<<20, defaultLimitConfig(), adminToken)
+
+	// the third fix is 1 km from the second one after a second
+	var body strings.Builder
+	for i, position := range []struct {
+		boat      string
+		latitude  float64
+		longitude float64
+	}{
+		{boat: "Bluebird", latitude: 53.5, longitude: 10},
+		{boat: "Bluebird", latitude: 53.5001, longitude: 10},
+		{boat: "Bluebird", latitude: 53.5091, longitude: 10},
+		{boat: "Bluebird"},
+		{latitude: 53.5, longitude: 10},
+	} {
+		fmt.Fprintf(&body, `{"boat": %q, "device_id": "import", "latitude": %v, "longitude": %v, "measure_time": %q}`+"\n",
+			position.boat, position.latitude, position.longitude, now.Add(time.Duration(i-10)*time.Second).Format(time.RFC3339))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/importpositions", strings.NewReader(body.String()))
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+	w := httptest.NewRecorder()
+	s.RequireAdmin(s.ImportPositions)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var response PushBulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	want := BulkChunkResult{Positions: 5, Unassigned: 1, InsertResult: InsertResult{Inserted: 4, Rejected: 2}}
+	if response.Total != want {
+		t.Errorf("total = %+v, want %+v", response.Total, want)
+	}
+
+	positions, err := storage.GetPositions(context.Background(), "Bluebird", now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 2 {
+		t.Errorf("positions = %+v, want the 2 plausible ones", positions)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"regatta-watch/services/data-server/compact"
+)
+
+// compactMaxBytes limits the size of a compact packet. Links that need the
+// compact encoding send far smaller packets.
+const compactMaxBytes = 64 << 10
+
+// errCompactMAC is returned for packets that are not signed with a token of
+// their device.
+var errCompactMAC = errors.New("packet not signed with a token of the device")
+
+type compactConfig struct {
+	UDPAddress string // e.g. ":5683", empty if disabled
+}
+
+// compactHandler processes a compact packet received over UDP from addr.
+type compactHandler func(ctx context.Context, addr net.Addr, data []byte) (InsertResult, error)
+
+// handleCompactPacket stores the fixes of a compact packet. The packet has to
+// be signed with a token of the device it names, which has to be the
+// authenticated device, if the packet was received over HTTP. Fixes the
+// device was not assigned to a boat for are dropped.
+func (s *regattaService) handleCompactPacket(ctx context.Context, data []byte, authenticatedDeviceID string) (InsertResult, error) {
+	packet, err := compact.Decode(data)
+	if err != nil {
+		return InsertResult{}, err
+	}
+	if authenticatedDeviceID != "" && packet.DeviceID != authenticatedDeviceID {
+		return InsertResult{}, fmt.Errorf("packet of device %q sent by device %q", packet.DeviceID, authenticatedDeviceID)
+	}
+
+	compactKeys, err := s.storageClient.GetCompactKeysOfDevice(ctx, packet.DeviceID)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("get compact keys of device: %w", err)
+	}
+	verified := false
+	for _, compactKey := range compactKeys {
+		key, err := hex.DecodeString(compactKey)
+		if err == nil && packet.Verify(key) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		rejectedPushesTotal.Inc()
+		return InsertResult{}, fmt.Errorf("device %q: %w", packet.DeviceID, errCompactMAC)
+	}
+
+	assignments, err := s.storageClient.GetAssignmentsOfDevice(ctx, packet.DeviceID)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("get assignments of device: %w", err)
+	}
+
+	pmr := PushMessageRequest{SendTime: time.Now()}
+	for _, fix := range packet.Fixes {
+		boat := assignedBoat(assignments, fix.Time)
+		if boat == "" {
+			s.LogDebug(ctx, "drop fix of unassigned device", "device_id", packet.DeviceID, "measure_time", fix.Time)
+			continue
+		}
+		pmr.Positions = append(pmr.Positions, Position{
+			Boat:        boat,
+			DeviceID:    packet.DeviceID,
+			Latitude:    fix.Latitude,
+			Longitude:   fix.Longitude,
+			MeasureTime: fix.Time,
+		})
+	}
+	if len(pmr.Positions) == 0 {
+		return InsertResult{}, nil
+	}
+
+	return s.insertPositions(ctx, &pmr)
+}
+
+// handleCompactDatagram stores the fixes of a compact packet received over
+// UDP. Senders are rate limited by address before the packet is verified,
+// dropped packets are only logged and counted.
+func (s *regattaService) handleCompactDatagram(ctx context.Context, addr net.Addr, data []byte) (InsertResult, error) {
+	if ok, _ := s.allow(ctx, s.ipLimiter, "ip", remoteIP(addr.String()), "remote_addr", addr.String()); !ok {
+		return InsertResult{}, nil
+	}
+	return s.handleCompactPacket(ctx, data, "")
+}
+
+// PushCompact stores the fixes of a compact packet, see package compact. The
+// insert result is reported in the X-Positions-* headers, the response has no
+// body to save bandwidth.
+func (s *regattaService) PushCompact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deviceID, _ := authenticatedDevice(ctx)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, compactMaxBytes))
+	if err != nil {
+		err = fmt.Errorf("push compact: read http body: %w", err)
+		s.LogError(ctx, err, "device_id", deviceID)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.handleCompactPacket(ctx, data, deviceID)
+	if err != nil {
+		err = fmt.Errorf("push compact: %w", err)
+		s.LogError(ctx, err, "device_id", deviceID)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	setInsertResultHeaders(w, result)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// compactListener receives compact packets over UDP, one per datagram. There
+// is no acknowledgement, trackers send a packet again if they are not sure it
+// arrived, repeated fixes are stored once.
+type compactListener struct {
+	config         compactConfig
+	handle         compactHandler
+	logError       func(err error)
+	defaultTimeout time.Duration
+
+	conn net.PacketConn
+	wg   sync.WaitGroup
+}
+
+func newCompactListener(config compactConfig, handle compactHandler, logError func(err error)) *compactListener {
+	return &compactListener{
+		config:         config,
+		handle:         handle,
+		logError:       logError,
+		defaultTimeout: time.Minute,
+	}
+}
+
+// Start listens on the configured address and serves it in the background.
+func (l *compactListener) Start() error {
+	conn, err := net.ListenPacket("udp", l.config.UDPAddress)
+	if err != nil {
+		return fmt.Errorf("compact: listen on udp %s: %w", l.config.UDPAddress, err)
+	}
+	l.conn = conn
+
+	l.wg.Add(1)
+	go l.serve()
+
+	return nil
+}
+
+func (l *compactListener) Stop() {
+	if l.conn != nil {
+		_ = l.conn.Close()
+	}
+	l.wg.Wait()
+}
+
+func (l *compactListener) serve() {
+	defer l.wg.Done()
+
+	buffer := make([]byte, compactMaxBytes)
+	for {
+		n, addr, err := l.conn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logError(fmt.Errorf("compact: read udp datagram: %w", err))
+			}
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.defaultTimeout)
+		if _, err = l.handle(ctx, addr, buffer[:n]); err != nil {
+			l.logError(fmt.Errorf("compact: handle packet from %s: %w", addr, err))
+		}
+		cancel()
+	}
+}
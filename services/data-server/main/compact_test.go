@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestCompactListener(t *testing.T) {
+	var mu sync.Mutex
+	var received [][]byte
+	handle := func(_ context.Context, _ net.Addr, data []byte) (InsertResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, append([]byte(nil), data...))
+		return InsertResult{Inserted: 1}, nil
+	}
+
+	listener := newCompactListener(compactConfig{UDPAddress: "127.0.0.1:0"}, handle, func(err error) { t.Error(err) })
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Stop()
+
+	conn, err := net.Dial("udp", listener.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	packets := [][]byte{{1, 2, 3}, {4, 5}}
+	for _, packet := range packets {
+		if _, err = conn.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == len(packets)
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, packet := range packets {
+		if !bytes.Equal(received[i], packet) {
+			t.Errorf("packet %d = %v, want %v", i, received[i], packet)
+		}
+	}
+}
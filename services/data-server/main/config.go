@@ -1,50 +1,294 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
-	"os"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"regatta-watch/internal/configsource"
+	"regatta-watch/internal/logging"
 )
 
 type config struct {
-	DBConfig databaseConfig
+	Server       serverConfig
+	Logging      logging.Config
+	Storage      storageConfig
+	DBConfig     databaseConfig // only set for Postgres
+	MQTTConfig   *mqttConfig    // nil if MQTT is disabled
+	ReplayConfig *replayConfig  // nil if no dataset is replayed
+	NMEAConfig   nmeaConfig
+	// CompactConfig configures the UDP listener of compact packets, the HTTP
+	// endpoint is always available.
+	CompactConfig compactConfig
+	Validation    validationConfig
+	Limits        limitConfig
+	// BulkMaxBytes limits the body of a bulk upload, compressed and
+	// decompressed.
+	BulkMaxBytes int64
+	// AdminToken authenticates the admin routes, they are disabled if it is
+	// empty.
+	AdminToken string
+	// MigrateOnStart applies pending migrations on startup, otherwise the
+	// schema is only verified.
+	MigrateOnStart bool
 }
 
-func loadConfig() (*config, error) {
-	err := godotenv.Load("../.env")
+// settings lists everything loadConfig reads.
+var settings = []configsource.Setting{
+	{Name: "LISTEN_ADDRESS", Usage: "address of the HTTP server (default :8090)"},
+	{Name: "TLS_CERT_FILE", Usage: "certificate file, serves HTTPS together with TLS_KEY_FILE"},
+	{Name: "TLS_KEY_FILE", Usage: "private key file of TLS_CERT_FILE"},
+	{Name: "HTTP_READ_HEADER_TIMEOUT", Usage: "time to read the request headers (default 10s)"},
+	{Name: "HTTP_READ_TIMEOUT", Usage: "time to read a request, 0 for none (default 0)"},
+	{Name: "HTTP_WRITE_TIMEOUT", Usage: "time to write a response, 0 for none (default 0)"},
+	{Name: "HTTP_IDLE_TIMEOUT", Usage: "time to keep idle connections (default 2m)"},
+	{Name: "ADMIN_TOKEN", Usage: "token of the admin routes /assigndevice and /readdevices, disabled if empty"},
+	{Name: "STORAGE", Usage: "postgres, sqlite or memory (default postgres)"},
+	{Name: "SQLITE_PATH", Usage: "database file of the sqlite storage (default regatta.db)"},
+	{Name: "DEVICE_TOKENS", Usage: "device tokens of the memory storage, <device>=<token>,..."},
+	{Name: "HOST", Usage: "host of Postgres"},
+	{Name: "PORT", Usage: "port of Postgres"},
+	{Name: "DB_NAME", Usage: "name of the Postgres database"},
+	{Name: "DB_USER_NAME", Usage: "user of the Postgres database"},
+	{Name: "DB_USER_PASSWORD", Usage: "password of DB_USER_NAME"},
+	{Name: "DB_MAX_OPEN_CONNS", Usage: "maximum open database connections, 0 for no limit (default 0)"},
+	{Name: "DB_MAX_IDLE_CONNS", Usage: "maximum idle database connections (default 2)"},
+	{Name: "DB_CONN_MAX_LIFETIME", Usage: "maximum age of a database connection, 0 for none (default 0)"},
+	{Name: "DB_TIMEOUT", Usage: "timeout of a database query (default 1m)"},
+	{Name: "MIGRATE_ON_START", Usage: "apply pending migrations on startup (default true)"},
+	{Name: "MQTT_BROKER_URL", Usage: "URL of the MQTT broker, enables MQTT"},
+	{Name: "MQTT_TOPIC", Usage: "topic of the OwnTracks messages (default owntracks/+/+)"},
+	{Name: "MQTT_CLIENT_ID", Usage: "MQTT client ID (default regatta-data-server)"},
+	{Name: "MQTT_USER_NAME", Usage: "MQTT user"},
+	{Name: "MQTT_USER_PASSWORD", Usage: "password of MQTT_USER_NAME"},
+	{Name: "NMEA_TCP_ADDRESS", Usage: "TCP address of the NMEA listener"},
+	{Name: "NMEA_UDP_ADDRESS", Usage: "UDP address of the NMEA listener"},
+	{Name: "COMPACT_UDP_ADDRESS", Usage: "UDP address of the compact packet listener"},
+	{Name: "REPLAY_DATASET", Usage: "replay dataset, enables the replay"},
+	{Name: "REPLAY_SPEED", Usage: "speed of the replay (default 1)"},
+	{Name: "REPLAY_LOOP", Usage: "restart the replay at its end (default true)"},
+	{Name: "REPLAY_START_OFFSET", Usage: "start of the replay in the dataset"},
+	{Name: "VALIDATION_BOUNDS", Usage: "<min latitude>,<min longitude>,<max latitude>,<max longitude>"},
+	{Name: "VALIDATION_MAX_AGE", Usage: "maximum age of a position"},
+	{Name: "VALIDATION_MAX_FUTURE", Usage: "maximum time a position may be in the future"},
+	{Name: "VALIDATION_MAX_SPEED", Usage: "maximum speed in m/s"},
+	{Name: "VALIDATION_MAX_ACCURACY", Usage: "maximum accuracy in meters"},
+	{Name: "RATE_LIMITS", Usage: "rate limits of device classes, <class>=<rate>:<burst>,..."},
+	{Name: "RATE_LIMIT_IP", Usage: "rate limit per address, <rate>:<burst>"},
+	{Name: "MAX_BODY_BYTES", Usage: "maximum size of a request body"},
+	{Name: "BULK_MAX_BYTES", Usage: "maximum size of a bulk upload (default 32 MiB)"},
+	{Name: "LOG_LEVEL", Usage: "debug, info, warn or error (default info)"},
+	{Name: "LOG_OUTPUT", Usage: "stdout, stderr or a file (default logs.txt)"},
+}
+
+// loadConfig reads the settings from the command line arguments, the
+// environment and the config file and returns the arguments after the flags.
+func loadConfig(args []string) (*config, []string, error) {
+	src, args, err := configsource.New("data-server", settings, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server, err := loadServerConfig(src, ":8090")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storageConf := storageConfig{
+		Backend:    storagePostgres,
+		SQLitePath: "regatta.db",
+	}
+	if backend, ok := src.Lookup("STORAGE"); ok && backend != "" {
+		storageConf.Backend = backend
+	}
+	if sqlitePath, ok := src.Lookup("SQLITE_PATH"); ok && sqlitePath != "" {
+		storageConf.SQLitePath = sqlitePath
+	}
+
+	var dbConfig databaseConfig
+	switch storageConf.Backend {
+	case storagePostgres:
+		dbConfig, err = loadDatabaseConfig(src)
+		if err != nil {
+			return nil, nil, err
+		}
+	case storageSQLite, storageMemory:
+	default:
+		return nil, nil, fmt.Errorf("STORAGE must be %s, %s or %s, got %q", storagePostgres, storageSQLite, storageMemory, storageConf.Backend)
+	}
+	if deviceTokensStr := src.Get("DEVICE_TOKENS"); deviceTokensStr != "" {
+		if storageConf.Backend != storageMemory {
+			return nil, nil, fmt.Errorf("DEVICE_TOKENS only applies to the %s storage, issue tokens with jobs/device_tokens", storageMemory)
+		}
+		storageConf.DeviceTokens = make(map[string]string)
+		for _, deviceToken := range strings.Split(deviceTokensStr, ",") {
+			deviceID, token, ok := strings.Cut(strings.TrimSpace(deviceToken), "=")
+			if !ok || deviceID == "" || len(token) < 16 {
+				return nil, nil, errors.New("DEVICE_TOKENS must be <device>=<token>,... with tokens of at least 16 characters")
+			}
+			storageConf.DeviceTokens[deviceID] = token
+		}
+	}
+
+	var mqttConf *mqttConfig
+	if mqttBrokerURL, ok := src.Lookup("MQTT_BROKER_URL"); ok && mqttBrokerURL != "" {
+		mqttConf = &mqttConfig{
+			BrokerURL:    mqttBrokerURL,
+			Topic:        "owntracks/+/+",
+			ClientID:     "regatta-data-server",
+			UserName:     src.Get("MQTT_USER_NAME"),
+			UserPassword: src.Get("MQTT_USER_PASSWORD"),
+		}
+		if topic, ok := src.Lookup("MQTT_TOPIC"); ok {
+			mqttConf.Topic = topic
+		}
+		if clientID, ok := src.Lookup("MQTT_CLIENT_ID"); ok {
+			mqttConf.ClientID = clientID
+		}
+	}
+
+	var replayConf *replayConfig
+	if dataset, ok := src.Lookup("REPLAY_DATASET"); ok && dataset != "" {
+		replayConf = &replayConfig{
+			Dataset: dataset,
+			Speed:   1,
+			Loop:    true,
+		}
+		if speedStr, ok := src.Lookup("REPLAY_SPEED"); ok {
+			replayConf.Speed, err = strconv.ParseFloat(speedStr, 64)
+			if err != nil || replayConf.Speed <= 0 {
+				return nil, nil, fmt.Errorf("REPLAY_SPEED must be a positive number, got %q", speedStr)
+			}
+		}
+		if loopStr, ok := src.Lookup("REPLAY_LOOP"); ok {
+			replayConf.Loop, err = strconv.ParseBool(loopStr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parse REPLAY_LOOP: %w", err)
+			}
+		}
+		if startOffsetStr, ok := src.Lookup("REPLAY_START_OFFSET"); ok {
+			replayConf.StartOffset, err = time.ParseDuration(startOffsetStr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parse REPLAY_START_OFFSET: %w", err)
+			}
+		}
+	}
+
+	nmeaConf := nmeaConfig{
+		TCPAddress: src.Get("NMEA_TCP_ADDRESS"),
+		UDPAddress: src.Get("NMEA_UDP_ADDRESS"),
+	}
+
+	compactConf := compactConfig{
+		UDPAddress: src.Get("COMPACT_UDP_ADDRESS"),
+	}
+
+	validation, err := loadValidationConfig(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limits, err := loadLimitConfig(src)
 	if err != nil {
-		return nil, errors.New("error loading .env file")
+		return nil, nil, err
 	}
 
-	host, ok := os.LookupEnv("HOST")
+	bulkMaxBytes := int64(32 << 20)
+	if bulkMaxBytesStr, ok := src.Lookup("BULK_MAX_BYTES"); ok {
+		bulkMaxBytes, err = strconv.ParseInt(bulkMaxBytesStr, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse BULK_MAX_BYTES: %w", err)
+		}
+		if bulkMaxBytes <= 0 {
+			return nil, nil, fmt.Errorf("BULK_MAX_BYTES must be positive, got %q", bulkMaxBytesStr)
+		}
+	}
+
+	migrateOnStart := true
+	if migrateOnStartStr, ok := src.Lookup("MIGRATE_ON_START"); ok {
+		migrateOnStart, err = strconv.ParseBool(migrateOnStartStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse MIGRATE_ON_START: %w", err)
+		}
+	}
+
+	adminToken := src.Get("ADMIN_TOKEN")
+	if adminToken != "" && len(adminToken) < 16 {
+		return nil, nil, errors.New("ADMIN_TOKEN must have at least 16 characters")
+	}
+
+	logConfig := logging.Config{Level: slog.LevelInfo, Output: "logs.txt"}
+	if levelStr, ok := src.Lookup("LOG_LEVEL"); ok {
+		logConfig.Level, err = logging.ParseLevel(levelStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse LOG_LEVEL: %w", err)
+		}
+	}
+	if output, ok := src.Lookup("LOG_OUTPUT"); ok && output != "" {
+		logConfig.Output = output
+	}
+
+	/*
+	   Host:         "localhost",
+	   	Port:         5432,
+	   		DatabaseName: "regatta",
+	   		UserName:     "regatta",
+	   		Password:     "1234"
+	*/
+
+	return &config{
+		Server:         server,
+		Logging:        logConfig,
+		Storage:        storageConf,
+		DBConfig:       dbConfig,
+		MQTTConfig:     mqttConf,
+		ReplayConfig:   replayConf,
+		NMEAConfig:     nmeaConf,
+		CompactConfig:  compactConf,
+		Validation:     validation,
+		Limits:         limits,
+		BulkMaxBytes:   bulkMaxBytes,
+		MigrateOnStart: migrateOnStart,
+		AdminToken:     adminToken,
+	}, args, nil
+}
+
+// loadDatabaseConfig reads the connection settings of Postgres, all of them
+// are required.
+func loadDatabaseConfig(src *configsource.Source) (databaseConfig, error) {
+	host, ok := src.Lookup("HOST")
 	if !ok {
-		return nil, errors.New("HOST was not defined")
+		return databaseConfig{}, errors.New("HOST was not defined")
 	}
 
-	portStr, ok := os.LookupEnv("PORT")
+	portStr, ok := src.Lookup("PORT")
 	if !ok {
-		return nil, errors.New("PORT was not defined")
+		return databaseConfig{}, errors.New("PORT was not defined")
 	}
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		return nil, err
+		return databaseConfig{}, err
 	}
 
-	dbName, ok := os.LookupEnv("DB_NAME")
+	dbName, ok := src.Lookup("DB_NAME")
 	if !ok {
-		return nil, errors.New("DB_NAME was not defined")
+		return databaseConfig{}, errors.New("DB_NAME was not defined")
 	}
 
-	dbUserName, ok := os.LookupEnv("DB_USER_NAME")
+	dbUserName, ok := src.Lookup("DB_USER_NAME")
 	if !ok {
-		return nil, errors.New("DB_USER_NAME was not defined")
+		return databaseConfig{}, errors.New("DB_USER_NAME was not defined")
 	}
 
-	dbUserPassword, ok := os.LookupEnv("DB_USER_PASSWORD")
+	dbUserPassword, ok := src.Lookup("DB_USER_PASSWORD")
 	if !ok {
-		return nil, errors.New("DB_USER_PASSWORD was not defined")
+		return databaseConfig{}, errors.New("DB_USER_PASSWORD was not defined")
 	}
 
 	dbConfig := databaseConfig{
@@ -53,17 +297,221 @@ func loadConfig() (*config, error) {
 		DatabaseName: dbName,
 		UserName:     dbUserName,
 		UserPassword: dbUserPassword,
+		MaxIdleConns: 2,
+		Timeout:      time.Minute,
+	}
+	if err = src.Integer("DB_MAX_OPEN_CONNS", &dbConfig.MaxOpenConns); err != nil {
+		return dbConfig, err
+	}
+	if err = src.Integer("DB_MAX_IDLE_CONNS", &dbConfig.MaxIdleConns); err != nil {
+		return dbConfig, err
+	}
+	if err = src.Duration("DB_CONN_MAX_LIFETIME", &dbConfig.ConnMaxLifetime); err != nil {
+		return dbConfig, err
+	}
+	if err = src.Duration("DB_TIMEOUT", &dbConfig.Timeout); err != nil {
+		return dbConfig, err
+	}
+	if dbConfig.Timeout == 0 {
+		return dbConfig, errors.New("DB_TIMEOUT must be greater than 0")
 	}
 
-	/*
-	   Host:         "localhost",
-	   	Port:         5432,
-	   		DatabaseName: "regatta",
-	   		UserName:     "regatta",
-	   		Password:     "1234"
-	*/
+	return dbConfig, nil
+}
 
-	return &config{
-		DBConfig: dbConfig,
-	}, nil
+type serverConfig struct {
+	ListenAddress string
+	// TLSCertFile and TLSKeyFile are empty to serve plain HTTP.
+	TLSCertFile       string
+	TLSKeyFile        string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// newServer returns a server of the handler, nil serves
+// http.DefaultServeMux.
+func (c serverConfig) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.ListenAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+	}
+}
+
+// listenAndServe serves with HTTPS if a certificate is configured, otherwise
+// with HTTP.
+func (c serverConfig) listenAndServe(server *http.Server) error {
+	if c.TLSCertFile != "" {
+		return server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+	}
+	return server.ListenAndServe()
+}
+
+// loadServerConfig reads the settings of the HTTP server, all of them are
+// optional. A TLS certificate is loaded once to report a broken pair on
+// startup.
+func loadServerConfig(src *configsource.Source, defaultAddress string) (serverConfig, error) {
+	server := serverConfig{
+		ListenAddress:     defaultAddress,
+		TLSCertFile:       src.Get("TLS_CERT_FILE"),
+		TLSKeyFile:        src.Get("TLS_KEY_FILE"),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if address, ok := src.Lookup("LISTEN_ADDRESS"); ok && address != "" {
+		server.ListenAddress = address
+	}
+	if _, _, err := net.SplitHostPort(server.ListenAddress); err != nil {
+		return server, fmt.Errorf("parse LISTEN_ADDRESS: %w", err)
+	}
+
+	if (server.TLSCertFile == "") != (server.TLSKeyFile == "") {
+		return server, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if server.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(server.TLSCertFile, server.TLSKeyFile); err != nil {
+			return server, fmt.Errorf("load TLS_CERT_FILE and TLS_KEY_FILE: %w", err)
+		}
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"HTTP_READ_HEADER_TIMEOUT": &server.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":        &server.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":       &server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &server.IdleTimeout,
+	} {
+		if err := src.Duration(name, value); err != nil {
+			return server, err
+		}
+	}
+
+	return server, nil
+}
+
+// loadValidationConfig reads the validation settings, all of them are
+// optional.
+func loadValidationConfig(src *configsource.Source) (validationConfig, error) {
+	validation := defaultValidationConfig()
+
+	if boundsStr, ok := src.Lookup("VALIDATION_BOUNDS"); ok {
+		var bounds []float64
+		for _, boundStr := range strings.Split(boundsStr, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(boundStr), 64)
+			if err != nil {
+				return validation, fmt.Errorf("parse VALIDATION_BOUNDS: %w", err)
+			}
+			bounds = append(bounds, bound)
+		}
+		if len(bounds) != 4 {
+			return validation, errors.New("VALIDATION_BOUNDS must be <min latitude>,<min longitude>,<max latitude>,<max longitude>")
+		}
+		validation.MinLatitude, validation.MinLongitude = bounds[0], bounds[1]
+		validation.MaxLatitude, validation.MaxLongitude = bounds[2], bounds[3]
+		if validation.MinLatitude < -90 || validation.MaxLatitude > 90 || validation.MinLatitude >= validation.MaxLatitude ||
+			validation.MinLongitude < -180 || validation.MaxLongitude > 180 || validation.MinLongitude >= validation.MaxLongitude {
+			return validation, fmt.Errorf("VALIDATION_BOUNDS must be an area on earth with the minimums below the maximums, got %q", boundsStr)
+		}
+	}
+
+	var err error
+	if maxAgeStr, ok := src.Lookup("VALIDATION_MAX_AGE"); ok {
+		validation.MaxAge, err = time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return validation, fmt.Errorf("parse VALIDATION_MAX_AGE: %w", err)
+		}
+		if validation.MaxAge <= 0 {
+			return validation, fmt.Errorf("VALIDATION_MAX_AGE must be positive, got %q", maxAgeStr)
+		}
+	}
+	if maxFutureStr, ok := src.Lookup("VALIDATION_MAX_FUTURE"); ok {
+		validation.MaxFuture, err = time.ParseDuration(maxFutureStr)
+		if err != nil {
+			return validation, fmt.Errorf("parse VALIDATION_MAX_FUTURE: %w", err)
+		}
+		if validation.MaxFuture < 0 {
+			return validation, fmt.Errorf("VALIDATION_MAX_FUTURE must not be negative, got %q", maxFutureStr)
+		}
+	}
+	if maxSpeedStr, ok := src.Lookup("VALIDATION_MAX_SPEED"); ok {
+		validation.MaxSpeed, err = strconv.ParseFloat(maxSpeedStr, 64)
+		if err != nil {
+			return validation, fmt.Errorf("parse VALIDATION_MAX_SPEED: %w", err)
+		}
+		if !(validation.MaxSpeed > 0) {
+			return validation, fmt.Errorf("VALIDATION_MAX_SPEED must be positive, got %q", maxSpeedStr)
+		}
+	}
+	if maxAccuracyStr, ok := src.Lookup("VALIDATION_MAX_ACCURACY"); ok {
+		validation.MaxAccuracy, err = strconv.ParseFloat(maxAccuracyStr, 64)
+		if err != nil {
+			return validation, fmt.Errorf("parse VALIDATION_MAX_ACCURACY: %w", err)
+		}
+		if !(validation.MaxAccuracy > 0) {
+			return validation, fmt.Errorf("VALIDATION_MAX_ACCURACY must be positive, got %q", maxAccuracyStr)
+		}
+	}
+
+	return validation, nil
+}
+
+// loadLimitConfig reads the rate and size limits, all of them are optional.
+// RATE_LIMITS lists the limits of device classes as
+// <class>=<requests per second>:<burst>, separated by commas.
+func loadLimitConfig(src *configsource.Source) (limitConfig, error) {
+	limits := defaultLimitConfig()
+
+	if rateLimitsStr, ok := src.Lookup("RATE_LIMITS"); ok {
+		for _, classStr := range strings.Split(rateLimitsStr, ",") {
+			class, limitStr, ok := strings.Cut(strings.TrimSpace(classStr), "=")
+			if !ok || class == "" {
+				return limits, fmt.Errorf("parse RATE_LIMITS: %q is not <class>=<rate>:<burst>", classStr)
+			}
+			limit, err := parseRateLimit(limitStr)
+			if err != nil {
+				return limits, fmt.Errorf("parse RATE_LIMITS of class %q: %w", class, err)
+			}
+			limits.DeviceClasses[class] = limit
+		}
+	}
+
+	var err error
+	if ipLimitStr, ok := src.Lookup("RATE_LIMIT_IP"); ok {
+		limits.IP, err = parseRateLimit(ipLimitStr)
+		if err != nil {
+			return limits, fmt.Errorf("parse RATE_LIMIT_IP: %w", err)
+		}
+	}
+	if maxBodyBytesStr, ok := src.Lookup("MAX_BODY_BYTES"); ok {
+		limits.MaxBodyBytes, err = strconv.ParseInt(maxBodyBytesStr, 10, 64)
+		if err != nil {
+			return limits, fmt.Errorf("parse MAX_BODY_BYTES: %w", err)
+		}
+		if limits.MaxBodyBytes <= 0 {
+			return limits, fmt.Errorf("MAX_BODY_BYTES must be positive, got %q", maxBodyBytesStr)
+		}
+	}
+
+	return limits, nil
+}
+
+// parseRateLimit parses a rate limit as <requests per second>:<burst>.
+func parseRateLimit(s string) (rateLimit, error) {
+	rateStr, burstStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("%q is not <rate>:<burst>", s)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+	if err != nil || rate < 0 {
+		return rateLimit{}, fmt.Errorf("invalid rate %q", rateStr)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+	if err != nil || burst < 1 {
+		return rateLimit{}, fmt.Errorf("invalid burst %q", burstStr)
+	}
+	return rateLimit{Rate: rate, Burst: burst}, nil
 }
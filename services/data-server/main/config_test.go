@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+listen_address: ":9000"
+storage: postgres
+host: localhost
+port: 5432
+db_name: file
+db_user_name: regatta
+db_user_password: "1234"
+db_timeout: 5s
+log_level: debug
+`)
+	t.Setenv("DB_NAME", "env")
+	t.Setenv("LOG_OUTPUT", "stdout")
+
+	c, args, err := loadConfig([]string{"-config", path, "-db-name", "flag", "-log-output", "stderr", "migrate", "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DBConfig.DatabaseName != "flag" {
+		t.Errorf("database name = %q, want the flag", c.DBConfig.DatabaseName)
+	}
+	if c.Logging.Output != "stderr" {
+		t.Errorf("log output = %q, want the flag", c.Logging.Output)
+	}
+	if c.Server.ListenAddress != ":9000" || c.DBConfig.Timeout != 5*time.Second || c.Logging.Level != slog.LevelDebug {
+		t.Errorf("config = %+v, want the values of the file", c)
+	}
+	if c.Server.ReadHeaderTimeout != 10*time.Second || c.DBConfig.MaxIdleConns != 2 {
+		t.Errorf("config = %+v, want the defaults", c)
+	}
+	if !slices.Equal(args, []string{"migrate", "status"}) {
+		t.Errorf("args = %v, want the subcommand", args)
+	}
+
+	t.Setenv("DB_NAME", "")
+	t.Setenv("LISTEN_ADDRESS", ":9001")
+	c, _, err = loadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DBConfig.DatabaseName != "" || c.Server.ListenAddress != ":9001" {
+		t.Errorf("database name = %q, address = %q, want the environment", c.DBConfig.DatabaseName, c.Server.ListenAddress)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "unknown setting", file: "listen_adress: \":9000\"\n", wantErr: "unknown settings listen_adress"},
+		{name: "nested value", file: "rate_limits:\n  default: 1:5\n", wantErr: "parse config file"},
+		{name: "listen address", env: map[string]string{"LISTEN_ADDRESS": "9000"}, wantErr: "LISTEN_ADDRESS"},
+		{name: "certificate without key", env: map[string]string{"TLS_CERT_FILE": "cert.pem"}, wantErr: "TLS_KEY_FILE"},
+		{name: "missing certificate", env: map[string]string{"TLS_CERT_FILE": "missing.pem", "TLS_KEY_FILE": "missing.pem"}, wantErr: "load TLS_CERT_FILE"},
+		{name: "pool size", env: map[string]string{
+			"STORAGE": storagePostgres, "HOST": "localhost", "PORT": "5432", "DB_NAME": "regatta",
+			"DB_USER_NAME": "regatta", "DB_USER_PASSWORD": "1234", "DB_MAX_OPEN_CONNS": "-1",
+		}, wantErr: "DB_MAX_OPEN_CONNS"},
+		{name: "timeout", env: map[string]string{"HTTP_IDLE_TIMEOUT": "1"}, wantErr: "HTTP_IDLE_TIMEOUT"},
+		{name: "storage", env: map[string]string{"STORAGE": "mysql"}, wantErr: "STORAGE"},
+		{name: "bulk size", env: map[string]string{"BULK_MAX_BYTES": "0"}, wantErr: "BULK_MAX_BYTES"},
+		{name: "body size", env: map[string]string{"MAX_BODY_BYTES": "-1"}, wantErr: "MAX_BODY_BYTES"},
+		{name: "device tokens without memory", env: map[string]string{"STORAGE": storageSQLite, "DEVICE_TOKENS": "bluebird=0123456789abcdef"}, wantErr: "DEVICE_TOKENS only applies"},
+		{name: "short device token", env: map[string]string{"DEVICE_TOKENS": "bluebird=1234"}, wantErr: "DEVICE_TOKENS must be"},
+		{name: "swapped bounds", env: map[string]string{"VALIDATION_BOUNDS": "54,11,53,9"}, wantErr: "VALIDATION_BOUNDS"},
+		{name: "max age", env: map[string]string{"VALIDATION_MAX_AGE": "0s"}, wantErr: "VALIDATION_MAX_AGE"},
+		{name: "max speed", env: map[string]string{"VALIDATION_MAX_SPEED": "0"}, wantErr: "VALIDATION_MAX_SPEED"},
+		{name: "max accuracy", env: map[string]string{"VALIDATION_MAX_ACCURACY": "-5"}, wantErr: "VALIDATION_MAX_ACCURACY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STORAGE", storageMemory)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			var args []string
+			if tt.file != "" {
+				args = []string{"-config", writeConfigFile(t, tt.file)}
+			}
+			_, _, err := loadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"regatta-watch/services/data-server/track"
+)
+
+// ExportTrack returns the track of a boat in a time range as a file for
+// navigation apps. The query parameters are boat, start_time and end_time in
+// RFC 3339 and format, which is gpx (default), kml or geojson. The track is
+// streamed while it is read from the database.
+func (s *regattaService) ExportTrack(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query := r.URL.Query()
+	boat := query.Get("boat")
+	if boat == "" {
+		s.LogError(ctx, errors.New("export track: boat is missing"))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, query.Get("start_time"))
+	if err != nil {
+		err = fmt.Errorf("export track: parse start time: %w", err)
+		s.LogError(ctx, err, "boat", boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, query.Get("end_time"))
+	if err != nil {
+		err = fmt.Errorf("export track: parse end time: %w", err)
+		s.LogError(ctx, err, "boat", boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = track.FormatGPX
+	}
+
+	trackWriter, err := track.NewWriter(format, w, boat)
+	if err != nil {
+		err = fmt.Errorf("export track: %w", err)
+		s.LogError(ctx, err, "boat", boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", track.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", boat+"."+format))
+
+	// the response may already be sent, so errors can only be logged
+	err = s.positionStorage.ForEachPosition(ctx, boat, startTime, endTime, func(position PositionAtTime) error {
+		return trackWriter.WritePoint(track.Point{
+			Latitude:  position.Latitude,
+			Longitude: position.Longitude,
+			Time:      position.MeasureTime,
+		})
+	})
+	if err != nil {
+		s.LogError(ctx, fmt.Errorf("export track: %w", err), "boat", boat, "format", format)
+		return
+	}
+
+	if err = trackWriter.Close(); err != nil {
+		s.LogError(ctx, fmt.Errorf("export track: %w", err), "boat", boat, "format", format)
+	}
+}
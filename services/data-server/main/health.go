@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"regatta-watch/internal/health"
+)
+
+// Readyz reports if the service can handle requests: the storage is
+// reachable and its schema is up to date.
+func (s *regattaService) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), health.ReadinessTimeout)
+	defer cancel()
+
+	components := map[string]error{
+		"database":   s.storageClient.Ping(ctx),
+		"migrations": s.storageClient.CheckSchema(ctx),
+	}
+
+	health.Write(w, r, components)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"regatta-watch/internal/health"
+)
+
+func TestReadyz(t *testing.T) {
+	// nothing listens on port 1, so the database is unreachable
+	dbClient, err := newDatabaseClient(databaseConfig{Host: "127.0.0.1", Port: 1, DatabaseName: "regatta", UserName: "regatta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dbClient.Database.Close() })
+	s := newRegattaService(dbClient, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+
+	w := httptest.NewRecorder()
+	s.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	var response health.Response
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != health.StatusUnavailable {
+		t.Errorf("status = %q, want %q", response.Status, health.StatusUnavailable)
+	}
+	for _, name := range []string{"database", "migrations"} {
+		component := response.Components[name]
+		if component.Status != health.StatusUnavailable || component.Error == "" {
+			t.Errorf("component %q = %+v, want unavailable with error", name, component)
+		}
+	}
+}
+
+func TestReadyzDatabase(t *testing.T) {
+	s := newRegattaService(newTestDatabaseClient(t), defaultValidationConfig(), 0, defaultLimitConfig(), "")
+
+	w := httptest.NewRecorder()
+	s.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("readyz status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
@@ -1,47 +1,137 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"regatta-watch/internal/health"
+	"regatta-watch/internal/logging"
 )
 
 func main() {
-	// If the file doesn't exist, create it or append to the file
-	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Fatal(err)
+	c, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	log.SetOutput(file)
-
-	c, err := loadConfig()
 	if err != nil {
 		log.Fatal("error loading config: ", err)
 	}
 
-	dbClient, err := newDatabaseClient(c.DBConfig, "test") // normal
+	if len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatal(migrateUsage)
+		}
+		if c.Storage.Backend != storagePostgres {
+			log.Fatalf("migrations only apply to %s, the %s storage creates its tables itself", storagePostgres, c.Storage.Backend)
+		}
+		dbClient, err := newDatabaseClient(c.DBConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = runMigrate(context.Background(), dbClient, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logger, logOutput, err := logging.NewLogger(c.Logging)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer func() { _ = logOutput.Close() }()
+	slog.SetDefault(logger)
+
+	storageClient, err := newStorage(context.Background(), c)
+	if err != nil {
+		logging.Fatal("error opening storage", err)
+	}
+	defer func() { _ = storageClient.Close() }()
+
+	// a replay is played into memory and the positions are served from there,
+	// it never touches the stored positions
+	var replayStorage *memoryStorage
+	var replayPositions []Position
+	if c.ReplayConfig != nil {
+		replayPositions, err = storageClient.GetReplayPositions(context.Background(), c.ReplayConfig.Dataset)
+		if err != nil {
+			logging.Fatal("error loading replay dataset", err)
+		}
+		if len(replayPositions) == 0 {
+			logging.Fatal("error loading replay dataset", fmt.Errorf("dataset %q is empty", c.ReplayConfig.Dataset))
+		}
+		replayStorage = newMemoryStorage()
+		slog.Info("serving a replay instead of the stored positions", "dataset", c.ReplayConfig.Dataset)
+	}
 
-	regattaService := newRegattaService(dbClient)
+	regattaService := newRegattaService(storageClient, c.Validation, c.BulkMaxBytes, c.Limits, c.AdminToken)
+	if replayStorage != nil {
+		regattaService.positionStorage = replayStorage
+	}
+
+	// the receivers run outside of requests
+	logError := func(err error) { regattaService.LogError(context.Background(), err) }
+
+	if c.MQTTConfig != nil {
+		mqttSubscriber := newMQTTSubscriber(*c.MQTTConfig, regattaService.handleOwnTracksMessage, logError)
+		if err = mqttSubscriber.Start(); err != nil {
+			logging.Fatal("error starting mqtt subscriber", err)
+		}
+		defer mqttSubscriber.Stop()
+	}
+
+	if c.NMEAConfig.TCPAddress != "" || c.NMEAConfig.UDPAddress != "" {
+		nmeaListener := newNMEAListener(c.NMEAConfig, regattaService.handleNMEASentence, logError)
+		if err = nmeaListener.Start(); err != nil {
+			logging.Fatal("error starting nmea listener", err)
+		}
+		defer nmeaListener.Stop()
+	}
+
+	if c.CompactConfig.UDPAddress != "" {
+		compactListener := newCompactListener(c.CompactConfig, regattaService.handleCompactDatagram, logError)
+		if err = compactListener.Start(); err != nil {
+			logging.Fatal("error starting compact listener", err)
+		}
+		defer compactListener.Stop()
+	}
+
+	if replayStorage != nil {
+		replayPlayer := newReplayPlayer(*c.ReplayConfig, replayPositions, regattaService.insertReplayPositions, replayStorage.forgetPositions, logError)
+		go replayPlayer.Run(context.Background())
+	}
 
-	//certFile := "../../../https_certificate/cert.pem"
-	//keyFile := "../../../https_certificate/key.pem"
+	handleRoute("/ping", regattaService.Ping)
+	handleRoute("/healthz", health.Healthz)
+	handleRoute("/readyz", regattaService.Readyz)
+	handleRoute("/pushposition", regattaService.RequireDevice(regattaService.PushPositions))
+	handleRoute("/pushbulk", regattaService.RequireDevice(regattaService.PushBulk))
+	handleRoute("/pushcompact", regattaService.RequireDevice(regattaService.PushCompact))
+	handleRoute("/readposition", regattaService.ReadPositions)
+	handleRoute("/readpositionpage", regattaService.ReadPositionPage)
+	handleRoute("/streamposition", regattaService.StreamPositions)
+	handleRoute("/exporttrack", regattaService.ExportTrack)
+	handleRoute("/readrejectedpositions", regattaService.ReadRejectedPositions)
+	handleRoute("/pushbattery", regattaService.RequireDevice(regattaService.PushBattery))
+	handleRoute("/readtelemetry", regattaService.ReadTelemetry)
+	handleRoute("/assigndevice", regattaService.RequireAdmin(regattaService.AssignDevice))
+	handleRoute("/readdevices", regattaService.RequireAdmin(regattaService.ReadDevices))
+	handleRoute("/importpositions", regattaService.RequireAdmin(regattaService.ImportPositions))
 
-	http.HandleFunc("/ping", regattaService.Ping)
-	http.HandleFunc("/pushposition", regattaService.PushPositions)
-	http.HandleFunc("/readposition", regattaService.ReadPositions)
-	http.HandleFunc("/pushbattery", regattaService.PushBattery)
-	http.HandleFunc("/readbattery", regattaService.ReadBattery)
+	http.Handle("/metrics", promhttp.Handler())
 
-	fmt.Println("Service started and listening")
-	//err = http.ListenAndServeTLS(":8090", certFile, keyFile, nil)
-	err = http.ListenAndServe(":8090", nil)
+	server := c.Server.newServer(nil)
+	slog.Info("service started and listening", "address", server.Addr, "tls", c.Server.TLSCertFile != "")
+	err = c.Server.listenAndServe(server)
 	if err != nil {
-		log.Fatal("error in http handler: ", err)
+		logging.Fatal("error in http handler", err)
 	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"regatta-watch/internal/logging"
+)
+
+// The metrics are exposed on /metrics. Their names are part of the interface
+// of the service, see the README before renaming them.
+var (
+	positionsIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "regatta_data_server_positions_ingested_total",
+		Help: "Positions received by boat and outcome: accepted, rejected by the validation or duplicate.",
+	}, []string{"boat", "outcome"})
+
+	rejectedPushesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "regatta_data_server_rejected_pushes_total",
+		Help: "Pushes rejected because the device could not be authenticated.",
+	})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "regatta_data_server_rate_limited_total",
+		Help: "Requests and packets dropped by a rate limit: ip or device:<class>.",
+	}, []string{"limit"})
+
+	oversizedBodiesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "regatta_data_server_oversized_bodies_total",
+		Help: "Requests rejected because their body exceeded the size limit.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "regatta_data_server_db_query_duration_seconds",
+		Help:    "Duration of the database calls by storage method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "regatta_data_server_http_request_duration_seconds",
+		Help:    "Duration of the HTTP requests by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "code"})
+)
+
+// observeQuery starts timing a storage method. Defer the call of the
+// returned function to record the duration.
+func observeQuery(method string) func() {
+	timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues(method))
+	return func() { timer.ObserveDuration() }
+}
+
+// observeIngest counts the positions of an insert by boat and outcome.
+func observeIngest(positions []Position) {
+	for _, position := range positions {
+		outcome := "accepted"
+		switch {
+		case position.Duplicate:
+			outcome = "duplicate"
+		case position.RejectReason != "":
+			outcome = "rejected"
+		}
+		positionsIngested.WithLabelValues(position.Boat, outcome).Inc()
+	}
+}
+
+// handleRoute registers a handler with a request ID and records the duration
+// of its requests.
+func handleRoute(route string, handler http.HandlerFunc) {
+	http.Handle(route, logging.WithRequestID(promhttp.InstrumentHandlerDuration(
+		httpRequestDuration.MustCurryWith(prometheus.Labels{"route": route}),
+		handler,
+	)))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveIngest(t *testing.T) {
+	positionsIngested.Reset()
+
+	observeIngest([]Position{
+		{Boat: "Bluebird"},
+		{Boat: "Bluebird"},
+		{Boat: "Bluebird", RejectReason: "position outside of bounds"},
+		{Boat: "Bluebird", Duplicate: true},
+		{Boat: "Vivace", Duplicate: true, RejectReason: "position outside of bounds"},
+	})
+
+	tests := []struct {
+		boat    string
+		outcome string
+		want    float64
+	}{
+		{"Bluebird", "accepted", 2},
+		{"Bluebird", "rejected", 1},
+		{"Bluebird", "duplicate", 1},
+		{"Vivace", "accepted", 0},
+		{"Vivace", "duplicate", 1},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(positionsIngested.WithLabelValues(tt.boat, tt.outcome))
+		if got != tt.want {
+			t.Errorf("positions ingested of %q with outcome %q = %v, want %v", tt.boat, tt.outcome, got, tt.want)
+		}
+	}
+}
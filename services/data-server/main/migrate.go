@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// schemaMigrationLock is the key of the advisory lock held while migrating,
+// so instances that start at the same time do not migrate twice.
+const schemaMigrationLock = 7244
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations returns the embedded migrations ordered by version. The
+// files are named "<version>_<name>.up.sql" and "<version>_<name>.down.sql",
+// versions start at 1 and have no gaps.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionRaw, name, ok2 := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionRaw)
+		if !ok || !ok2 || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		switch direction {
+		case "up":
+			m.up = string(content)
+		case "down":
+			m.down = string(content)
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for version := 1; version <= len(byVersion); version++ {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("migration %d is missing", version)
+		}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down file", version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	return migrations, nil
+}
+
+// SchemaVersion returns the version of the last applied migration, 0 if no
+// migration was applied.
+func (c *databaseClient) SchemaVersion(ctx context.Context) (int, error) {
+	defer observeQuery("SchemaVersion")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var exists bool
+	err := c.Database.QueryRowContext(ctx, `SELECT to_regclass('schema_version') IS NOT NULL;`).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("check schema version table: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err = c.Database.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version;`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Migrate applies the up or down migrations from the current version to the
+// target version in one transaction and returns the version it started from.
+func (c *databaseClient) Migrate(ctx context.Context, migrations []migration, target int) (int, error) {
+	defer observeQuery("Migrate")()
+
+	if target < 0 || target > len(migrations) {
+		return 0, fmt.Errorf("unknown schema version %d, the latest is %d", target, len(migrations))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, schemaMigrationLock)
+	if err != nil {
+		return 0, fmt.Errorf("lock schema: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+       CREATE TABLE IF NOT EXISTS schema_version (
+           version integer PRIMARY KEY,
+           name text NOT NULL,
+           applied_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+       );
+       `)
+	if err != nil {
+		return 0, fmt.Errorf("create schema version table: %w", err)
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version;`).Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return current, fmt.Errorf("schema version %d is newer than the latest known version %d", current, len(migrations))
+	}
+
+	for version := current + 1; version <= target; version++ {
+		m := migrations[version-1]
+		if _, err = tx.ExecContext(ctx, m.up); err != nil {
+			return current, fmt.Errorf("migrate up to %d_%s: %w", m.version, m.name, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_version(version, name) VALUES ($1, $2);`, m.version, m.name)
+		if err != nil {
+			return current, fmt.Errorf("store schema version: %w", err)
+		}
+	}
+
+	for version := current; version > target; version-- {
+		m := migrations[version-1]
+		if _, err = tx.ExecContext(ctx, m.down); err != nil {
+			return current, fmt.Errorf("migrate down from %d_%s: %w", m.version, m.name, err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = $1;`, m.version)
+		if err != nil {
+			return current, fmt.Errorf("delete schema version: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return current, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return current, nil
+}
+
+// prepareSchema brings the schema to the latest version on startup. If apply
+// is false, the schema is only verified, e.g. if migrations are run as a
+// separate step of a deployment.
+func prepareSchema(ctx context.Context, dbClient *databaseClient, apply bool) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if apply {
+		from, err := dbClient.Migrate(ctx, migrations, len(migrations))
+		if err != nil {
+			return err
+		}
+		if from != len(migrations) {
+			slog.InfoContext(ctx, "migrated schema", "from", from, "to", len(migrations))
+		}
+		return nil
+	}
+
+	return checkSchemaVersion(ctx, dbClient, migrations)
+}
+
+// checkSchemaVersion returns an error if not all migrations are applied.
+func checkSchemaVersion(ctx context.Context, dbClient *databaseClient, migrations []migration) error {
+	version, err := dbClient.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		return fmt.Errorf("schema version is %d, want %d, run \"migrate up\"", version, len(migrations))
+	}
+	return nil
+}
+
+const migrateUsage = `usage:
+  go run . [flags] migrate status            show the schema version
+  go run . [flags] migrate up [version]      migrate up to the latest or the given version
+  go run . [flags] migrate down [version]    migrate down by one or to the given version`
+
+// runMigrate runs the migrate subcommand with its arguments.
+func runMigrate(ctx context.Context, dbClient *databaseClient, args []string) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+
+	current, err := dbClient.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target int
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		for _, m := range migrations {
+			status := "pending"
+			if m.version <= current {
+				status = "applied"
+			}
+			fmt.Printf("%03d_%s\t%s\n", m.version, m.name, status)
+		}
+		fmt.Printf("schema version %d of %d\n", current, len(migrations))
+		return nil
+	case "up":
+		target = len(migrations)
+	case "down":
+		target = current - 1
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if len(args) == 2 {
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+	}
+	if (args[0] == "up" && target < current) || (args[0] == "down" && target > current) {
+		return fmt.Errorf("cannot migrate %s from version %d to %d", args[0], current, target)
+	}
+
+	from, err := dbClient.Migrate(ctx, migrations, max(target, 0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("migrated schema from version %d to %d\n", from, max(target, 0))
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.version)
+		}
+	}
+}
+
+// TestMigrationsMatchStorage verifies that the migrations create exactly the
+// tables the queries in storage.go use.
+func TestMigrationsMatchStorage(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTable := regexp.MustCompile(`(?i)CREATE TABLE IF NOT EXISTS "?([a-z_]+)`)
+	dropTable := regexp.MustCompile(`(?i)DROP TABLE (?:IF EXISTS )?"?([a-z_]+)`)
+	var created []string
+	for _, m := range migrations {
+		for _, match := range createTable.FindAllStringSubmatch(m.up, -1) {
+			created = append(created, match[1])
+		}
+		for _, match := range dropTable.FindAllStringSubmatch(m.up, -1) {
+			created = slices.DeleteFunc(created, func(table string) bool { return table == match[1] })
+		}
+	}
+
+	storage, err := os.ReadFile("storage.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableReference := regexp.MustCompile(`(?:FROM|INTO|UPDATE|JOIN)\s+"?([a-z_]+)`)
+	var used []string
+	for _, match := range tableReference.FindAllStringSubmatch(string(storage), -1) {
+		if match[1] != "unnest" {
+			used = append(used, match[1])
+		}
+	}
+
+	slices.Sort(created)
+	slices.Sort(used)
+	used = slices.Compact(used)
+	if !slices.Equal(created, used) {
+		t.Errorf("migrations create tables %v, storage.go uses %v", created, used)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	c := newTestDatabaseClient(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []int{len(migrations), 0, len(migrations)} {
+		if _, err = c.Migrate(ctx, migrations, target); err != nil {
+			t.Fatalf("migrate to %d: %v", target, err)
+		}
+		version, err := c.SchemaVersion(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != target {
+			t.Errorf("schema version = %d, want %d", version, target)
+		}
+	}
+}
+
+// TestMigrateLegacySchema verifies that a table of the positions set up by
+// hand in the first versions is migrated, and that a table that does not
+// match fails the migration.
+func TestMigrateLegacySchema(t *testing.T) {
+	c := newTestDatabaseClient(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed migration leaves the hand-made table behind
+	reset := func(t *testing.T) {
+		t.Helper()
+		if _, err := c.Migrate(ctx, migrations, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Database.ExecContext(ctx, `DROP TABLE IF EXISTS positions_data_server CASCADE;`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		reset(t)
+		if _, err := c.Migrate(ctx, migrations, len(migrations)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	legacy := `
+       CREATE TABLE positions_data_server (
+           id BIGSERIAL PRIMARY KEY,
+           boat text NOT NULL DEFAULT '',
+           longitude pg_catalog.float8 NOT NULL DEFAULT 0.0,
+           latitude pg_catalog.float8 NOT NULL DEFAULT 0.0,
+           measure_time timestamptz NOT NULL DEFAULT '1970-01-01 00:00:00+00',
+           send_time timestamptz NOT NULL DEFAULT '1970-01-01 00:00:00+00',
+           receive_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+       );
+       INSERT INTO positions_data_server (boat, longitude, latitude, measure_time)
+       VALUES ('Bluebird', 10.0091, 53.5655, '2025-06-01 12:00:00+00'),
+              ('Bluebird', 10.0092, 53.5656, '2025-06-01 12:00:01+00');
+       `
+	tests := []struct {
+		name    string
+		setup   string
+		wantErr string
+	}{
+		{name: "first version", setup: legacy},
+		{
+			name:    "duplicate positions",
+			setup:   legacy + `INSERT INTO positions_data_server (boat, measure_time) VALUES ('Bluebird', '2025-06-01 12:00:00+00');`,
+			wantErr: "several positions of a boat at the same measure time",
+		},
+		{
+			name:    "different column",
+			setup:   legacy + `ALTER TABLE positions_data_server ALTER COLUMN latitude TYPE text;`,
+			wantErr: "positions_data_server.latitude double precision",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset(t)
+			if _, err := c.Database.ExecContext(ctx, tt.setup); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := c.Migrate(ctx, migrations, len(migrations))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var count int
+			err = c.Database.QueryRowContext(ctx, `SELECT count(*) FROM positions_data_server WHERE device_id = '';`).Scan(&count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 2 {
+				t.Errorf("%d positions without device, want the 2 of the first version", count)
+			}
+			_, err = c.Database.ExecContext(ctx, `INSERT INTO positions_data_server (boat, measure_time) VALUES ('Bluebird', '2025-06-01 12:00:00+00');`)
+			if err == nil {
+				t.Error("inserted a second position of a boat at the same measure time")
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS replay_positions;
+DROP TABLE IF EXISTS device_telemetry;
+DROP TABLE IF EXISTS device_credentials;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS position_conflicts;
+DROP TABLE IF EXISTS positions_data_server;
@@ -0,0 +1,173 @@
+-- The tables use IF NOT EXISTS, so databases that were set up by hand before
+-- migrations existed are taken over. The positions of the first versions are
+-- migrated, any other difference to the tables below fails the migration.
+
+CREATE TABLE IF NOT EXISTS positions_data_server (
+    id BIGSERIAL PRIMARY KEY,
+    boat text NOT NULL DEFAULT '',
+    device_id text NOT NULL DEFAULT '',
+    longitude pg_catalog.float8 NOT NULL DEFAULT 0.0,
+    latitude pg_catalog.float8 NOT NULL DEFAULT 0.0,
+    measure_time timestamptz NOT NULL DEFAULT '1970-01-01 00:00:00+00',
+    send_time timestamptz NOT NULL DEFAULT '1970-01-01 00:00:00+00',
+    receive_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (boat, measure_time)
+);
+
+-- the positions of the first versions had no device and allowed several
+-- positions of a boat at the same time
+ALTER TABLE positions_data_server ADD COLUMN IF NOT EXISTS device_id text NOT NULL DEFAULT '';
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT FROM pg_constraint
+        WHERE conrelid = 'positions_data_server'::regclass
+        AND contype IN ('p', 'u')
+        AND conkey = ARRAY(
+            SELECT attnum FROM pg_attribute
+            WHERE attrelid = 'positions_data_server'::regclass
+            AND attname IN ('boat', 'measure_time')
+            ORDER BY attname
+        )
+    ) THEN
+        IF EXISTS (SELECT FROM positions_data_server GROUP BY boat, measure_time HAVING count(*) > 1) THEN
+            RAISE EXCEPTION 'positions_data_server has several positions of a boat at the same measure time, remove the duplicates before migrating';
+        END IF;
+        ALTER TABLE positions_data_server ADD UNIQUE (boat, measure_time);
+    END IF;
+END
+$$;
+
+-- positions that were sent again with different coordinates
+CREATE TABLE IF NOT EXISTS position_conflicts (
+    id BIGSERIAL PRIMARY KEY,
+    position_id bigint NOT NULL REFERENCES positions_data_server (id) ON DELETE CASCADE,
+    device_id text NOT NULL DEFAULT '',
+    longitude pg_catalog.float8 NOT NULL,
+    latitude pg_catalog.float8 NOT NULL,
+    send_time timestamptz NOT NULL,
+    receive_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- assignment of tracking devices to boats
+CREATE TABLE IF NOT EXISTS devices (
+    id BIGSERIAL PRIMARY KEY,
+    device_id text NOT NULL,
+    boat text NOT NULL,
+    start_time timestamptz NOT NULL,
+    end_time timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS device_credentials (
+    id BIGSERIAL PRIMARY KEY,
+    device_id text NOT NULL,
+    token_hash text NOT NULL UNIQUE,
+    created_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_time timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS device_telemetry (
+    id BIGSERIAL PRIMARY KEY,
+    boat text NOT NULL,
+    device_id text NOT NULL,
+    measure_time timestamptz NOT NULL,
+    battery_level pg_catalog.float8,
+    battery_status text,
+    accuracy pg_catalog.float8,
+    altitude pg_catalog.float8,
+    velocity pg_catalog.float8,
+    course pg_catalog.float8,
+    connectivity text,
+    receive_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- recorded datasets for replays
+CREATE TABLE IF NOT EXISTS replay_positions (
+    dataset text NOT NULL,
+    boat text NOT NULL,
+    longitude pg_catalog.float8 NOT NULL,
+    latitude pg_catalog.float8 NOT NULL,
+    measure_time timestamptz NOT NULL,
+    PRIMARY KEY (dataset, boat, measure_time)
+);
+
+-- tables that existed before must have the same columns
+DO $$
+DECLARE
+    mismatched text;
+BEGIN
+    SELECT string_agg(expected.table_name || '.' || expected.column_name || ' ' || expected.data_type, ', ')
+    INTO mismatched
+    FROM (VALUES
+        ('positions_data_server', 'id', 'bigint'),
+        ('positions_data_server', 'boat', 'text'),
+        ('positions_data_server', 'device_id', 'text'),
+        ('positions_data_server', 'longitude', 'double precision'),
+        ('positions_data_server', 'latitude', 'double precision'),
+        ('positions_data_server', 'measure_time', 'timestamp with time zone'),
+        ('positions_data_server', 'send_time', 'timestamp with time zone'),
+        ('positions_data_server', 'receive_time', 'timestamp with time zone'),
+        ('position_conflicts', 'id', 'bigint'),
+        ('position_conflicts', 'position_id', 'bigint'),
+        ('position_conflicts', 'device_id', 'text'),
+        ('position_conflicts', 'longitude', 'double precision'),
+        ('position_conflicts', 'latitude', 'double precision'),
+        ('position_conflicts', 'send_time', 'timestamp with time zone'),
+        ('position_conflicts', 'receive_time', 'timestamp with time zone'),
+        ('devices', 'id', 'bigint'),
+        ('devices', 'device_id', 'text'),
+        ('devices', 'boat', 'text'),
+        ('devices', 'start_time', 'timestamp with time zone'),
+        ('devices', 'end_time', 'timestamp with time zone'),
+        ('device_credentials', 'id', 'bigint'),
+        ('device_credentials', 'device_id', 'text'),
+        ('device_credentials', 'token_hash', 'text'),
+        ('device_credentials', 'created_time', 'timestamp with time zone'),
+        ('device_credentials', 'revoked_time', 'timestamp with time zone'),
+        ('device_telemetry', 'id', 'bigint'),
+        ('device_telemetry', 'boat', 'text'),
+        ('device_telemetry', 'device_id', 'text'),
+        ('device_telemetry', 'measure_time', 'timestamp with time zone'),
+        ('device_telemetry', 'battery_level', 'double precision'),
+        ('device_telemetry', 'battery_status', 'text'),
+        ('device_telemetry', 'accuracy', 'double precision'),
+        ('device_telemetry', 'altitude', 'double precision'),
+        ('device_telemetry', 'velocity', 'double precision'),
+        ('device_telemetry', 'course', 'double precision'),
+        ('device_telemetry', 'connectivity', 'text'),
+        ('device_telemetry', 'receive_time', 'timestamp with time zone'),
+        ('replay_positions', 'dataset', 'text'),
+        ('replay_positions', 'boat', 'text'),
+        ('replay_positions', 'longitude', 'double precision'),
+        ('replay_positions', 'latitude', 'double precision'),
+        ('replay_positions', 'measure_time', 'timestamp with time zone')
+    ) AS expected (table_name, column_name, data_type)
+    LEFT JOIN information_schema.columns AS actual
+        ON actual.table_schema = current_schema()
+        AND actual.table_name = expected.table_name
+        AND actual.column_name = expected.column_name
+        AND actual.data_type = expected.data_type
+    WHERE actual.column_name IS NULL;
+
+    IF mismatched IS NOT NULL THEN
+        RAISE EXCEPTION 'existing tables do not match the schema, missing or different columns: %', mismatched;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT FROM pg_constraint
+        WHERE conrelid = 'positions_data_server'::regclass
+        AND contype = 'p'
+    ) OR NOT EXISTS (
+        SELECT FROM pg_constraint
+        WHERE conrelid = 'device_credentials'::regclass
+        AND contype IN ('p', 'u')
+        AND conkey = ARRAY(
+            SELECT attnum FROM pg_attribute
+            WHERE attrelid = 'device_credentials'::regclass
+            AND attname = 'token_hash'
+        )
+    ) THEN
+        RAISE EXCEPTION 'existing tables do not match the schema, positions_data_server needs a primary key and device_credentials a unique token_hash';
+    END IF;
+END
+$$;
@@ -0,0 +1 @@
+ALTER TABLE positions_data_server DROP COLUMN reject_reason;
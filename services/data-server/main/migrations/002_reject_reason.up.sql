@@ -0,0 +1,3 @@
+-- positions with a reject reason failed the validation on ingest and are only
+-- kept for debugging
+ALTER TABLE positions_data_server ADD COLUMN reject_reason text;
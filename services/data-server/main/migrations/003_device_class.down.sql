@@ -0,0 +1 @@
+ALTER TABLE device_credentials DROP COLUMN device_class;
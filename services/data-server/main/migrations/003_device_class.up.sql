@@ -0,0 +1,2 @@
+-- the class of a device selects its rate limit, see RATE_LIMITS
+ALTER TABLE device_credentials ADD COLUMN device_class text NOT NULL DEFAULT 'default';
@@ -0,0 +1,3 @@
+-- the key compact packets are signed with, see compact.Key, tokens issued
+-- before have none and have to be issued again to send compact packets
+ALTER TABLE device_credentials ADD COLUMN compact_key text;
@@ -0,0 +1,14 @@
+-- positions of devices that were not assigned to a boat when they were
+-- received, they are moved to positions_data_server once an assignment
+-- covers their measure time
+CREATE TABLE IF NOT EXISTS unassigned_positions (
+    id BIGSERIAL PRIMARY KEY,
+    device_id text NOT NULL,
+    longitude pg_catalog.float8 NOT NULL,
+    latitude pg_catalog.float8 NOT NULL,
+    measure_time timestamptz NOT NULL,
+    accuracy pg_catalog.float8,
+    send_time timestamptz NOT NULL,
+    receive_time timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (device_id, measure_time)
+);
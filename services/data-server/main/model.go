@@ -2,11 +2,28 @@ package main
 
 import "time"
 
+// OwnTracksMessage is a message of the OwnTracks JSON format as sent by the
+// app in HTTP mode. Only the fields we use are decoded. See
+// https://owntracks.org/booklet/tech/json/ for the full format.
 type OwnTracksMessage struct {
-	Battery   int     `json:"batt"`
-	Latitude  float64 `json:"lat"`
-	Longitude float64 `json:"lon"`
-	CreatedAt int     `json:"created_at"`
+	Type        string  `json:"_type"`
+	TrackerID   string  `json:"tid"`
+	Topic       string  `json:"topic"`
+	Timestamp   int64   `json:"tst"`
+	CreatedAt   int64   `json:"created_at"`
+	Latitude    float64 `json:"lat"`
+	Longitude   float64 `json:"lon"`
+	Event       string  `json:"event"` // transition only: "enter" or "leave"
+	Description string  `json:"desc"`  // transition only: name of the region
+
+	// device telemetry, not every message contains all of it
+	Battery       *float64 `json:"batt"` // in percent
+	BatteryStatus *int     `json:"bs"`   // 0 unknown, 1 unplugged, 2 charging, 3 full
+	Accuracy      *float64 `json:"acc"`  // in meters
+	Altitude      *float64 `json:"alt"`  // in meters above sea level
+	Velocity      *float64 `json:"vel"`  // in km/h
+	Course        *float64 `json:"cog"`  // in degrees, 0 is north
+	Connectivity  *string  `json:"conn"` // "w" wifi, "m" mobile, "o" offline
 }
 
 type PushMessageRequest struct {
@@ -16,9 +33,61 @@ type PushMessageRequest struct {
 
 type Position struct {
 	Boat        string    `json:"boat"`
+	DeviceID    string    `json:"device_id"`
 	Longitude   float64   `json:"longitude"`
 	Latitude    float64   `json:"latitude"`
 	MeasureTime time.Time `json:"measure_time"`
+	Accuracy    *float64  `json:"accuracy,omitempty"` // in meters, only used for validation
+
+	// RejectReason is set by the validation if the position is implausible.
+	RejectReason string `json:"-"`
+	// Duplicate is set by the insert if the position was already stored.
+	Duplicate bool `json:"-"`
+}
+
+// InsertResult counts the positions of an insert. Duplicates are positions
+// that were already stored for the boat at the same measure time. Conflicts
+// are the duplicates with different coordinates. Rejected are the inserted
+// positions that failed the validation.
+type InsertResult struct {
+	Inserted   int `json:"inserted"`
+	Duplicates int `json:"duplicates"`
+	Conflicts  int `json:"conflicts"`
+	Rejected   int `json:"rejected"`
+}
+
+// BulkChunkResult summarizes a chunk of a bulk upload. Unassigned are the
+// positions measured while the device was not assigned to a boat, they are
+// not stored.
+type BulkChunkResult struct {
+	Positions  int `json:"positions"`
+	Unassigned int `json:"unassigned"`
+	InsertResult
+}
+
+func (r *BulkChunkResult) add(chunk BulkChunkResult) {
+	r.Positions += chunk.Positions
+	r.Unassigned += chunk.Unassigned
+	r.Inserted += chunk.Inserted
+	r.Duplicates += chunk.Duplicates
+	r.Conflicts += chunk.Conflicts
+	r.Rejected += chunk.Rejected
+}
+
+type PushBulkResponse struct {
+	Chunks []BulkChunkResult `json:"chunks"`
+	Total  BulkChunkResult   `json:"total"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// RejectedPosition is a position that failed the validation on ingest.
+type RejectedPosition struct {
+	PositionAtTime
+	RejectReason string `json:"reject_reason"`
+}
+
+type ReadRejectedPositionsResponse struct {
+	RejectedPositions []RejectedPosition `json:"rejected_positions"`
 }
 
 type ReadMessageRequest struct {
@@ -32,6 +101,7 @@ type ReadMessageResponse struct {
 }
 
 type PositionAtTime struct {
+	DeviceID    string    `json:"device_id"`
 	Longitude   float64   `json:"longitude"`
 	Latitude    float64   `json:"latitude"`
 	MeasureTime time.Time `json:"measure_time"`
@@ -39,6 +109,26 @@ type PositionAtTime struct {
 	ReceiveTime time.Time `json:"receive_time"`
 }
 
+// ReadPositionPageRequest requests the positions stored after the position
+// with the ID Cursor. Start with cursor 0 and continue with the NextCursor of
+// the response.
+type ReadPositionPageRequest struct {
+	Cursor int64  `json:"cursor"`
+	Limit  int    `json:"limit"`
+	Boat   string `json:"boat"` // all boats if empty
+}
+
+type ReadPositionPageResponse struct {
+	Positions  []BoatPosition `json:"positions"`
+	NextCursor int64          `json:"next_cursor"`
+}
+
+type BoatPosition struct {
+	ID   int64  `json:"id"`
+	Boat string `json:"boat"`
+	PositionAtTime
+}
+
 type BatteryMessage struct {
 	BatteryLevel []BatteryLevel `json:"battery_level"`
 }
@@ -47,3 +137,38 @@ type BatteryLevel struct {
 	BatteryLevel float64   `json:"battery_level"`
 	MeasureTime  time.Time `json:"measure_time"`
 }
+
+// Telemetry is the state of a tracking device at the measure time. Fields
+// the device did not report are nil.
+type Telemetry struct {
+	DeviceID      string    `json:"device_id"`
+	MeasureTime   time.Time `json:"measure_time"`
+	BatteryLevel  *float64  `json:"battery_level"`  // in percent
+	BatteryStatus *string   `json:"battery_status"` // "unplugged", "charging" or "full"
+	Accuracy      *float64  `json:"accuracy"`       // in meters
+	Altitude      *float64  `json:"altitude"`       // in meters above sea level
+	Velocity      *float64  `json:"velocity"`       // in km/h as reported by the device
+	Course        *float64  `json:"course"`         // in degrees, 0 is north
+	Connectivity  *string   `json:"connectivity"`   // "wifi", "mobile" or "offline"
+}
+
+type ReadTelemetryResponse struct {
+	Telemetry []Telemetry `json:"telemetry"`
+}
+
+// DeviceAssignment assigns a device to a boat from the start time until the
+// end time. An assignment without end time is open-ended.
+type DeviceAssignment struct {
+	DeviceID  string     `json:"device_id"`
+	Boat      string     `json:"boat"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+}
+
+type ReadDevicesRequest struct {
+	Boat string `json:"boat"`
+}
+
+type ReadDevicesResponse struct {
+	Devices []DeviceAssignment `json:"devices"`
+}
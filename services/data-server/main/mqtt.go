@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type mqttConfig struct {
+	BrokerURL    string
+	Topic        string
+	ClientID     string
+	UserName     string
+	UserPassword string
+}
+
+// ownTracksHandler processes an OwnTracks message of one of the given
+// devices.
+type ownTracksHandler func(ctx context.Context, deviceIDs []string, m *OwnTracksMessage) (InsertResult, error)
+
+// mqttSubscriber receives OwnTracks messages from an MQTT broker. Messages
+// are received with QoS 1 and only acknowledged once they are handled. The
+// broker only delivers a message again after a reconnect, so a message that
+// could not be stored is retried until it is or the subscriber is stopped.
+type mqttSubscriber struct {
+	client         mqtt.Client
+	topic          string
+	handle         ownTracksHandler
+	logError       func(err error)
+	defaultTimeout time.Duration
+	// the delay before the first retry, doubled up to maxRetryDelay
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	stop          chan struct{}
+}
+
+func newMQTTSubscriber(config mqttConfig, handle ownTracksHandler, logError func(err error)) *mqttSubscriber {
+	s := &mqttSubscriber{
+		topic:          config.Topic,
+		handle:         handle,
+		logError:       logError,
+		defaultTimeout: time.Minute,
+		retryDelay:     time.Second,
+		maxRetryDelay:  time.Minute,
+		stop:           make(chan struct{}),
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(config.BrokerURL).
+		SetClientID(config.ClientID).
+		SetUsername(config.UserName).
+		SetPassword(config.UserPassword).
+		// keep the session, so the broker queues messages while we are away
+		SetCleanSession(false).
+		SetAutoAckDisabled(true).
+		SetOrderMatters(false).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(s.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			s.logError(fmt.Errorf("mqtt: connection lost: %w", err))
+		})
+
+	s.client = mqtt.NewClient(options)
+
+	return s
+}
+
+// Start connects to the broker. The connection is retried in the background
+// if the broker is not reachable, so Start does not wait for it to succeed.
+func (s *mqttSubscriber) Start() error {
+	token := s.client.Connect()
+	if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+		return fmt.Errorf("connect to mqtt broker: %w", token.Error())
+	}
+	return nil
+}
+
+// Stop disconnects from the broker. Messages that are retried are left
+// unacknowledged, the broker delivers them again after the next connect.
+func (s *mqttSubscriber) Stop() {
+	close(s.stop)
+	s.client.Disconnect(250)
+}
+
+// onConnect subscribes to the topic after every (re)connect.
+func (s *mqttSubscriber) onConnect(client mqtt.Client) {
+	token := client.Subscribe(s.topic, 1, s.onMessage)
+	go func() {
+		_ = token.Wait()
+		if token.Error() != nil {
+			s.logError(fmt.Errorf("mqtt: subscribe to %q: %w", s.topic, token.Error()))
+		}
+	}()
+}
+
+func (s *mqttSubscriber) onMessage(_ mqtt.Client, message mqtt.Message) {
+	var m OwnTracksMessage
+	if err := json.Unmarshal(message.Payload(), &m); err != nil {
+		// the message will never be valid, so there is no point in getting it again
+		s.logError(fmt.Errorf("mqtt: unmarshal message on %q: %w", message.Topic(), err))
+		message.Ack()
+		return
+	}
+
+	// the topic is only part of the payload in HTTP mode
+	if m.Topic == "" {
+		m.Topic = message.Topic()
+	}
+
+	deviceIDs := ownTracksDeviceIDs(&m)
+	if len(deviceIDs) == 0 {
+		// neither a matching topic nor a tracker ID, retrying will not help
+		s.logError(fmt.Errorf("mqtt: no device ID in message on %q", message.Topic()))
+		message.Ack()
+		return
+	}
+
+	delay := s.retryDelay
+	for {
+		err := s.handleMessage(deviceIDs, &m)
+		if err == nil {
+			break
+		}
+		s.logError(fmt.Errorf("mqtt: handle message on %q, retry in %s: %w", message.Topic(), delay, err))
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, s.maxRetryDelay)
+	}
+
+	message.Ack()
+}
+
+func (s *mqttSubscriber) handleMessage(deviceIDs []string, m *OwnTracksMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.defaultTimeout)
+	defer cancel()
+
+	_, err := s.handle(ctx, deviceIDs, m)
+	return err
+}
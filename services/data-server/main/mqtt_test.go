@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// startBroker starts an embedded MQTT broker and returns its URL.
+func startBroker(t *testing.T) (*mochi.Server, string) {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{InlineClient: true})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	return server, "tcp://" + tcp.Address()
+}
+
+type handledMessage struct {
+	deviceIDs []string
+	message   OwnTracksMessage
+}
+
+func TestMQTTSubscriber(t *testing.T) {
+	broker, brokerURL := startBroker(t)
+
+	var mu sync.Mutex
+	var handled []handledMessage
+	var attempts int
+	failure := errors.New("database not reachable")
+	handle := func(_ context.Context, deviceIDs []string, m *OwnTracksMessage) (InsertResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if failure != nil {
+			return InsertResult{}, failure
+		}
+		handled = append(handled, handledMessage{deviceIDs: deviceIDs, message: *m})
+		return InsertResult{Inserted: 1}, nil
+	}
+
+	config := mqttConfig{
+		BrokerURL: brokerURL,
+		Topic:     "owntracks/+/+",
+		ClientID:  "data-server-test",
+	}
+	subscriber := newMQTTSubscriber(config, handle, func(err error) { t.Log(err) })
+	subscriber.retryDelay = 10 * time.Millisecond
+	subscriber.maxRetryDelay = 50 * time.Millisecond
+	if err := subscriber.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Stop()
+
+	inflight := func() int {
+		client, ok := broker.Clients.Get(config.ClientID)
+		if !ok {
+			return -1
+		}
+		return client.State.Inflight.Len()
+	}
+
+	// wait for the subscription, the broker drops messages without subscriber
+	waitFor(t, func() bool { return len(broker.Topics.Subscribers("owntracks/bluebird/phone").Subscriptions) > 0 })
+
+	payload := []byte(`{"_type":"location","tid":"bb","lat":53.5655,"lon":10.0091,"tst":1722600000}`)
+	if err := broker.Publish("owntracks/bluebird/phone", payload, false, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed write must not acknowledge the message, it is retried instead
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts >= 3
+	})
+	if got := inflight(); got != 1 {
+		t.Fatalf("inflight messages after failed write = %d, want 1", got)
+	}
+
+	// once the storage is back the same message is stored and acknowledged
+	// without a reconnect
+	mu.Lock()
+	failure = nil
+	mu.Unlock()
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 1
+	})
+
+	mu.Lock()
+	got := handled[0]
+	mu.Unlock()
+
+	wantDeviceIDs := []string{"bluebird/phone", "bb"}
+	if !slices.Equal(got.deviceIDs, wantDeviceIDs) {
+		t.Errorf("device IDs = %v, want %v", got.deviceIDs, wantDeviceIDs)
+	}
+	if got.message.Type != ownTracksTypeLocation || got.message.Latitude != 53.5655 || got.message.Longitude != 10.0091 {
+		t.Errorf("message = %+v, want location at 53.5655, 10.0091", got.message)
+	}
+
+	waitFor(t, func() bool { return inflight() == 0 })
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 1 {
+		t.Errorf("handled %d messages, want 1", len(handled))
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5 seconds")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
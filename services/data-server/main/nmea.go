@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"regatta-watch/services/data-server/nmea"
+)
+
+type nmeaConfig struct {
+	TCPAddress string // e.g. ":10110", empty if disabled
+	UDPAddress string // e.g. ":10110", empty if disabled
+}
+
+// nmeaSource is a device that sends NMEA sentences. Receivers do not identify
+// themselves, so the device ID is derived from the source address as
+// "nmea/<ip>" and assigned to a boat like any other device.
+type nmeaSource struct {
+	deviceID string
+	// most receivers send RMC and GGA for every fix, the other sentences are
+	// only used if the receiver does not send RMC
+	sendsRMC bool
+	// lastSeen is the receive time of the last UDP datagram
+	lastSeen time.Time
+}
+
+// A UDP source is forgotten when it sent nothing for nmeaUDPSourceIdle, it is
+// detected anew with its next datagram. Idle sources are swept once per
+// nmeaUDPSourceSweepInterval and at most nmeaMaxUDPSources are kept, the one
+// seen least recently makes room for a new one.
+const (
+	nmeaUDPSourceIdle          = 10 * time.Minute
+	nmeaUDPSourceSweepInterval = time.Minute
+	nmeaMaxUDPSources          = 1024
+)
+
+// nmeaHandler processes a sentence of a source. receiveTime completes the
+// sentences that do not carry a date.
+type nmeaHandler func(ctx context.Context, source *nmeaSource, sentence nmea.Sentence, receiveTime time.Time) error
+
+// nmeaListener receives NMEA sentences over TCP, one connection per receiver,
+// and UDP, one or more sentences per datagram.
+type nmeaListener struct {
+	config         nmeaConfig
+	handle         nmeaHandler
+	logError       func(err error)
+	defaultTimeout time.Duration
+
+	tcpListener net.Listener
+	udpConn     net.PacketConn
+	udpSources  map[string]*nmeaSource
+	lastSweep   time.Time
+	wg          sync.WaitGroup
+}
+
+func newNMEAListener(config nmeaConfig, handle nmeaHandler, logError func(err error)) *nmeaListener {
+	return &nmeaListener{
+		config:         config,
+		handle:         handle,
+		logError:       logError,
+		defaultTimeout: time.Minute,
+		udpSources:     map[string]*nmeaSource{},
+	}
+}
+
+// Start listens on the configured addresses and serves them in the
+// background.
+func (l *nmeaListener) Start() error {
+	if l.config.TCPAddress != "" {
+		listener, err := net.Listen("tcp", l.config.TCPAddress)
+		if err != nil {
+			return fmt.Errorf("nmea: listen on tcp %s: %w", l.config.TCPAddress, err)
+		}
+		l.tcpListener = listener
+
+		l.wg.Add(1)
+		go l.serveTCP()
+	}
+
+	if l.config.UDPAddress != "" {
+		conn, err := net.ListenPacket("udp", l.config.UDPAddress)
+		if err != nil {
+			l.Stop()
+			return fmt.Errorf("nmea: listen on udp %s: %w", l.config.UDPAddress, err)
+		}
+		l.udpConn = conn
+
+		l.wg.Add(1)
+		go l.serveUDP()
+	}
+
+	return nil
+}
+
+// Stop closes the listeners. Open TCP connections are served until the
+// receiver closes them.
+func (l *nmeaListener) Stop() {
+	if l.tcpListener != nil {
+		_ = l.tcpListener.Close()
+	}
+	if l.udpConn != nil {
+		_ = l.udpConn.Close()
+	}
+	l.wg.Wait()
+}
+
+func (l *nmeaListener) serveTCP() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.tcpListener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logError(fmt.Errorf("nmea: accept tcp connection: %w", err))
+			}
+			return
+		}
+
+		go l.serveTCPConn(conn)
+	}
+}
+
+func (l *nmeaListener) serveTCPConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	source := &nmeaSource{deviceID: nmeaDeviceID(conn.RemoteAddr())}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		l.handleLine(source, scanner.Text(), time.Now())
+	}
+	if err := scanner.Err(); err != nil {
+		l.logError(fmt.Errorf("nmea: read from %s: %w", source.deviceID, err))
+	}
+}
+
+func (l *nmeaListener) serveUDP() {
+	defer l.wg.Done()
+
+	buffer := make([]byte, 64*1024)
+	for {
+		n, addr, err := l.udpConn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logError(fmt.Errorf("nmea: read udp datagram: %w", err))
+			}
+			return
+		}
+		receiveTime := time.Now()
+
+		source := l.udpSource(nmeaDeviceID(addr), receiveTime)
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			l.handleLine(source, line, receiveTime)
+		}
+	}
+}
+
+// udpSource returns the source of a device ID and forgets idle sources. It is
+// only called by serveUDP, so the sources need no lock.
+func (l *nmeaListener) udpSource(deviceID string, now time.Time) *nmeaSource {
+	if now.Sub(l.lastSweep) > nmeaUDPSourceSweepInterval {
+		for id, source := range l.udpSources {
+			if now.Sub(source.lastSeen) > nmeaUDPSourceIdle {
+				delete(l.udpSources, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	source, ok := l.udpSources[deviceID]
+	if !ok {
+		if len(l.udpSources) >= nmeaMaxUDPSources {
+			var oldest *nmeaSource
+			for _, s := range l.udpSources {
+				if oldest == nil || s.lastSeen.Before(oldest.lastSeen) {
+					oldest = s
+				}
+			}
+			delete(l.udpSources, oldest.deviceID)
+		}
+		source = &nmeaSource{deviceID: deviceID}
+		l.udpSources[deviceID] = source
+	}
+	source.lastSeen = now
+	return source
+}
+
+func (l *nmeaListener) handleLine(source *nmeaSource, line string, receiveTime time.Time) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	sentence, err := nmea.Parse(line)
+	if err != nil {
+		if !errors.Is(err, nmea.ErrUnsupported) {
+			l.logError(fmt.Errorf("nmea: parse sentence from %s: %w", source.deviceID, err))
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.defaultTimeout)
+	defer cancel()
+
+	if err = l.handle(ctx, source, sentence, receiveTime); err != nil {
+		l.logError(fmt.Errorf("nmea: handle sentence from %s: %w", source.deviceID, err))
+	}
+}
+
+// nmeaDeviceID returns the device ID of a receiver, the port changes with
+// every connection and is not part of it.
+func nmeaDeviceID(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return "nmea/" + host
+}
+
+// handleNMEASentence stores the fix of an RMC or GGA sentence and the speed
+// and course of an RMC or VTG sentence.
+func (s *regattaService) handleNMEASentence(ctx context.Context, source *nmeaSource, sentence nmea.Sentence, receiveTime time.Time) error {
+	switch sentence := sentence.(type) {
+	case nmea.RMC:
+		source.sendsRMC = true
+		if !sentence.Valid {
+			return nil
+		}
+		speed, course := sentence.SpeedKmh(), sentence.Course
+		telemetry := Telemetry{DeviceID: source.deviceID, MeasureTime: sentence.Time, Velocity: &speed, Course: &course}
+		return s.storeNMEAFix(ctx, source.deviceID, sentence.Latitude, sentence.Longitude, sentence.Time, receiveTime, &telemetry)
+	case nmea.GGA:
+		if source.sendsRMC || sentence.FixQuality == 0 {
+			return nil
+		}
+		measureTime := sentence.TimeOn(receiveTime)
+		return s.storeNMEAFix(ctx, source.deviceID, sentence.Latitude, sentence.Longitude, measureTime, receiveTime, nil)
+	case nmea.VTG:
+		if source.sendsRMC {
+			return nil
+		}
+		// VTG does not carry a time, it belongs to the fix that was just sent
+		boat, deviceID, err := s.storageClient.GetBoatOfDevice(ctx, []string{source.deviceID}, receiveTime)
+		if err != nil {
+			return fmt.Errorf("get boat of device: %w", err)
+		}
+		if boat == "" {
+			return fmt.Errorf("no boat assigned to device %q at %s", source.deviceID, receiveTime)
+		}
+		telemetry := Telemetry{DeviceID: deviceID, MeasureTime: receiveTime.Truncate(time.Second), Velocity: &sentence.SpeedKmh, Course: &sentence.Course}
+		if err = s.storageClient.InsertTelemetry(ctx, boat, []Telemetry{telemetry}); err != nil {
+			return fmt.Errorf("insert telemetry into database: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *regattaService) storeNMEAFix(ctx context.Context, sourceDeviceID string, latitude, longitude float64, measureTime, receiveTime time.Time, telemetry *Telemetry) error {
+	boat, deviceID, err := s.storageClient.GetBoatOfDevice(ctx, []string{sourceDeviceID}, measureTime)
+	if err != nil {
+		return fmt.Errorf("get boat of device: %w", err)
+	}
+	if boat == "" {
+		return fmt.Errorf("no boat assigned to device %q at %s", sourceDeviceID, measureTime)
+	}
+
+	pmr := PushMessageRequest{
+		Positions: []Position{
+			{
+				Boat:        boat,
+				DeviceID:    deviceID,
+				Longitude:   longitude,
+				Latitude:    latitude,
+				MeasureTime: measureTime,
+			},
+		},
+		SendTime: receiveTime,
+	}
+
+	result, err := s.insertPositions(ctx, &pmr)
+	if err != nil {
+		return fmt.Errorf("insert into database: %w", err)
+	}
+
+	if telemetry != nil && result.Inserted > 0 {
+		err = s.storageClient.InsertTelemetry(ctx, boat, []Telemetry{*telemetry})
+		if err != nil {
+			return fmt.Errorf("insert telemetry into database: %w", err)
+		}
+	}
+
+	return nil
+}
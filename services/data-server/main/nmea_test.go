@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"regatta-watch/services/data-server/nmea"
+)
+
+func TestNMEAListener(t *testing.T) {
+	var mu sync.Mutex
+	var handled []nmea.Sentence
+	var deviceIDs []string
+	handle := func(_ context.Context, source *nmeaSource, sentence nmea.Sentence, _ time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, sentence)
+		deviceIDs = append(deviceIDs, source.deviceID)
+		return nil
+	}
+
+	listener := newNMEAListener(nmeaConfig{TCPAddress: "127.0.0.1:0", UDPAddress: "127.0.0.1:0"}, handle, func(err error) { t.Log(err) })
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Stop()
+
+	tcpConn, err := net.Dial("tcp", listener.tcpListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tcpConn.Close() }()
+
+	// the sentence with the broken checksum and the unsupported one are dropped
+	_, err = tcpConn.Write([]byte("$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B\r\n" +
+		"$GPGSV,3,1,11,03,03,111,00,04,15,270,00,06,01,010,00,13,06,292,00*74\r\n" +
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 1
+	})
+
+	udpConn, err := net.Dial("udp", listener.udpConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udpConn.Close() }()
+
+	_, err = udpConn.Write([]byte("$GPGGA,123519,4807.038,N,01131.000,W,1,08,0.9,545.4,M,46.9,M,,*55\r\n" +
+		"$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 3
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := handled[0].(nmea.RMC); !ok {
+		t.Errorf("first sentence = %T, want nmea.RMC", handled[0])
+	}
+	if _, ok := handled[1].(nmea.GGA); !ok {
+		t.Errorf("second sentence = %T, want nmea.GGA", handled[1])
+	}
+	if _, ok := handled[2].(nmea.VTG); !ok {
+		t.Errorf("third sentence = %T, want nmea.VTG", handled[2])
+	}
+	for i, deviceID := range deviceIDs {
+		if deviceID != "nmea/127.0.0.1" {
+			t.Errorf("sentence %d: device ID = %q, want %q", i, deviceID, "nmea/127.0.0.1")
+		}
+	}
+}
+
+func TestNMEAUDPSources(t *testing.T) {
+	listener := newNMEAListener(nmeaConfig{}, nil, func(err error) { t.Log(err) })
+	start := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	// a source is remembered between datagrams
+	source := listener.udpSource("nmea/10.0.0.1", start)
+	source.sendsRMC = true
+	if got := listener.udpSource("nmea/10.0.0.1", start.Add(time.Second)); got != source {
+		t.Error("the source was not remembered")
+	}
+
+	// the most recently seen sources are kept when the map is full
+	for i := 2; i <= nmeaMaxUDPSources+1; i++ {
+		listener.udpSource(fmt.Sprintf("nmea/10.0.%d.%d", i/256, i%256), start.Add(2*time.Second))
+	}
+	if len(listener.udpSources) != nmeaMaxUDPSources {
+		t.Errorf("%d sources, want %d", len(listener.udpSources), nmeaMaxUDPSources)
+	}
+	if _, ok := listener.udpSources["nmea/10.0.0.1"]; ok {
+		t.Error("the least recently seen source was kept")
+	}
+
+	// idle sources are forgotten
+	source = listener.udpSource("nmea/10.0.0.1", start.Add(nmeaUDPSourceIdle))
+	source.sendsRMC = true
+	if got := listener.udpSource("nmea/10.0.0.1", start.Add(2*nmeaUDPSourceIdle+time.Second)); got == source || got.sendsRMC {
+		t.Error("an idle source was remembered, want it to be detected anew")
+	}
+	if len(listener.udpSources) != 1 {
+		t.Errorf("%d sources after they were idle, want 1", len(listener.udpSources))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ownTracksTypeLocation   = "location"
+	ownTracksTypeTransition = "transition"
+	ownTracksTypeStatus     = "status"
+	ownTracksTypeLWT        = "lwt"
+)
+
+// ownTracksDeviceIDs returns the candidate device IDs of an OwnTracks message
+// ordered by how reliable they are. The app identifies itself by user and
+// device name, which are part of the topic "owntracks/<user>/<device>" and
+// are written as "<user>/<device>". The tracker ID (tid) is only two
+// characters long and is tried last.
+func ownTracksDeviceIDs(m *OwnTracksMessage) []string {
+	var ids []string
+
+	if parts := strings.Split(m.Topic, "/"); len(parts) >= 3 && parts[0] == "owntracks" {
+		ids = append(ids, parts[1]+"/"+parts[2])
+	}
+
+	if m.TrackerID != "" {
+		ids = append(ids, m.TrackerID)
+	}
+
+	return ids
+}
+
+// ownTracksTimes returns the measure time and the send time of an OwnTracks
+// message. tst is the time of the GPS fix, created_at the time the message
+// was created, which differs from tst if the app reports an older fix.
+func ownTracksTimes(m *OwnTracksMessage) (time.Time, time.Time) {
+	measureTime := m.Timestamp
+	sendTime := m.CreatedAt
+	if measureTime == 0 {
+		measureTime = sendTime
+	}
+	if sendTime == 0 {
+		sendTime = measureTime
+	}
+	return time.Unix(measureTime, 0), time.Unix(sendTime, 0)
+}
+
+// handleOwnTracksMessage processes a single OwnTracks message. Messages that
+// do not carry a position are only logged.
+func (s *regattaService) handleOwnTracksMessage(ctx context.Context, deviceIDs []string, m *OwnTracksMessage) (InsertResult, error) {
+	switch m.Type {
+	case ownTracksTypeLocation, ownTracksTypeTransition:
+		return s.storeOwnTracksLocation(ctx, deviceIDs, m)
+	case ownTracksTypeStatus:
+		s.LogDebug(ctx, "status message", "device_ids", deviceIDs)
+	case ownTracksTypeLWT:
+		s.LogDebug(ctx, "device disconnected unexpectedly", "device_ids", deviceIDs)
+	default:
+		s.LogDebug(ctx, "ignore message", "type", m.Type, "device_ids", deviceIDs)
+	}
+	return InsertResult{}, nil
+}
+
+func (s *regattaService) storeOwnTracksLocation(ctx context.Context, deviceIDs []string, m *OwnTracksMessage) (InsertResult, error) {
+	measureTime, sendTime := ownTracksTimes(m)
+
+	boat, deviceID, err := s.storageClient.GetBoatOfDevice(ctx, deviceIDs, measureTime)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("get boat of device: %w", err)
+	}
+	if boat == "" {
+		return s.keepUnassignedOwnTracksLocation(ctx, deviceIDs, m)
+	}
+
+	if m.Type == ownTracksTypeTransition {
+		s.LogDebug(ctx, "region transition", "boat", boat, "device_id", deviceID, "event", m.Event, "region", m.Description)
+	}
+
+	pmr := PushMessageRequest{
+		Positions: []Position{
+			{
+				Boat:        boat,
+				DeviceID:    deviceID,
+				Longitude:   m.Longitude,
+				Latitude:    m.Latitude,
+				MeasureTime: measureTime,
+				Accuracy:    m.Accuracy,
+			},
+		},
+		SendTime: sendTime,
+	}
+
+	result, err := s.insertPositions(ctx, &pmr)
+	if err != nil {
+		return result, fmt.Errorf("insert into database: %w", err)
+	}
+
+	if result.Conflicts > 0 {
+		s.LogDebug(ctx, "different coordinates for a stored position", "boat", boat, "device_id", deviceID, "measure_time", measureTime)
+	}
+
+	// the telemetry of a duplicate is already stored as well
+	if telemetry := ownTracksTelemetry(deviceID, measureTime, m); telemetry != nil && result.Inserted > 0 {
+		err = s.storageClient.InsertTelemetry(ctx, boat, []Telemetry{*telemetry})
+		if err != nil {
+			return result, fmt.Errorf("insert telemetry into database: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// keepUnassignedOwnTracksLocation keeps the location of a device that is not
+// assigned to a boat at its measure time as a position of the most reliable
+// device ID, so the track of a phone is not lost if it is assigned after it
+// started sending. The telemetry of the message is dropped.
+func (s *regattaService) keepUnassignedOwnTracksLocation(ctx context.Context, deviceIDs []string, m *OwnTracksMessage) (InsertResult, error) {
+	if len(deviceIDs) == 0 {
+		return InsertResult{}, errors.New("no device ID in message")
+	}
+	measureTime, sendTime := ownTracksTimes(m)
+
+	pmr := PushMessageRequest{
+		Positions: []Position{
+			{
+				DeviceID:    deviceIDs[0],
+				Longitude:   m.Longitude,
+				Latitude:    m.Latitude,
+				MeasureTime: measureTime,
+				Accuracy:    m.Accuracy,
+			},
+		},
+		SendTime: sendTime,
+	}
+
+	result, err := s.storageClient.InsertUnassignedPositions(ctx, &pmr)
+	if err != nil {
+		return result, fmt.Errorf("insert unassigned position into database: %w", err)
+	}
+	s.LogDebug(ctx, "keep position of unassigned device", "device_id", deviceIDs[0], "measure_time", measureTime)
+
+	return result, nil
+}
+
+var (
+	ownTracksBatteryStatus = map[int]string{1: "unplugged", 2: "charging", 3: "full"}
+	ownTracksConnectivity  = map[string]string{"w": "wifi", "m": "mobile", "o": "offline"}
+)
+
+// ownTracksTelemetry returns the device telemetry of an OwnTracks message or
+// nil if the message does not contain any.
+func ownTracksTelemetry(deviceID string, measureTime time.Time, m *OwnTracksMessage) *Telemetry {
+	telemetry := Telemetry{
+		DeviceID:     deviceID,
+		MeasureTime:  measureTime,
+		BatteryLevel: m.Battery,
+		Accuracy:     m.Accuracy,
+		Altitude:     m.Altitude,
+		Velocity:     m.Velocity,
+		Course:       m.Course,
+	}
+
+	if m.BatteryStatus != nil {
+		if status, ok := ownTracksBatteryStatus[*m.BatteryStatus]; ok {
+			telemetry.BatteryStatus = &status
+		}
+	}
+
+	if m.Connectivity != nil {
+		if connectivity, ok := ownTracksConnectivity[*m.Connectivity]; ok {
+			telemetry.Connectivity = &connectivity
+		}
+	}
+
+	if telemetry.BatteryLevel == nil && telemetry.BatteryStatus == nil && telemetry.Accuracy == nil &&
+		telemetry.Altitude == nil && telemetry.Velocity == nil && telemetry.Course == nil &&
+		telemetry.Connectivity == nil {
+		return nil
+	}
+
+	return &telemetry
+}
+
+// writeOwnTracksResponse acknowledges an OwnTracks message. The app expects a
+// JSON array in the response body, which may contain commands for the device,
+// so the insert result is reported in headers.
+func writeOwnTracksResponse(w http.ResponseWriter, result InsertResult) error {
+	setInsertResultHeaders(w, result)
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write([]byte("[]"))
+	return err
+}
+
+// setInsertResultHeaders reports an insert result in the X-Positions-*
+// headers.
+func setInsertResultHeaders(w http.ResponseWriter, result InsertResult) {
+	w.Header().Set("X-Positions-Inserted", strconv.Itoa(result.Inserted))
+	w.Header().Set("X-Positions-Duplicates", strconv.Itoa(result.Duplicates))
+	w.Header().Set("X-Positions-Conflicts", strconv.Itoa(result.Conflicts))
+	w.Header().Set("X-Positions-Rejected", strconv.Itoa(result.Rejected))
+}
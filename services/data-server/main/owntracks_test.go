@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOwnTracksUnassignedDevice(t *testing.T) {
+	const token = "0123456789abcdef"
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	storage := newMemoryStorage()
+	storage.addToken("spare", token)
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+
+	// the spare phone sends before it is assigned, the fixes are kept instead
+	// of being rejected for good or retried by the app
+	for i, lat := range []float64{53.5, 53.5001} {
+		body := fmt.Sprintf(`{"_type": "location", "tst": %d, "lat": %v, "lon": 10}`, now.Add(time.Duration(i-2)*time.Minute).Unix(), lat)
+		r := httptest.NewRequest(http.MethodPost, "/pushposition", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.RequireDevice(s.PushPositions)(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("push %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+
+	positions, err := storage.GetPositions(ctx, "Bluebird", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 0 {
+		t.Fatalf("positions before the assignment = %+v, want none", positions)
+	}
+
+	body := fmt.Sprintf(`{"device_id": "spare", "boat": "Bluebird", "start_time": %q}`, now.Add(-5*time.Minute).Format(time.RFC3339))
+	w := httptest.NewRecorder()
+	s.AssignDevice(w, httptest.NewRequest(http.MethodPost, "/assigndevice", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("assign: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("X-Positions-Inserted"); got != "2" {
+		t.Errorf("assign: inserted %s positions, want 2", got)
+	}
+
+	positions, err = storage.GetPositions(ctx, "Bluebird", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 2 {
+		t.Errorf("positions after the assignment = %+v, want the kept ones", positions)
+	}
+	kept, err := storage.GetUnassignedPositions(ctx, "spare", now.Add(-time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 0 {
+		t.Errorf("kept positions after the assignment = %+v, want none", kept)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultDeviceClass is the class of tokens that were issued without one and
+// the limit of classes that are not configured.
+const defaultDeviceClass = "default"
+
+// rateLimit allows Rate requests per second on average and bursts of up to
+// Burst requests. A Rate of 0 disables the limit.
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// limitConfig configures the abuse protection of the push endpoints.
+type limitConfig struct {
+	// DeviceClasses limits the requests of a device by the class of its
+	// token, e.g. phones that push every fix separately and loggers that push
+	// batches.
+	DeviceClasses map[string]rateLimit
+	// IP limits the requests of a remote address before they are
+	// authenticated, so floods with unknown tokens do not load the database.
+	IP rateLimit
+	// MaxBodyBytes limits the request bodies apart from bulk uploads and
+	// compact packets, which have their own limits.
+	MaxBodyBytes int64
+}
+
+func defaultLimitConfig() limitConfig {
+	return limitConfig{
+		DeviceClasses: map[string]rateLimit{defaultDeviceClass: {Rate: 2, Burst: 30}},
+		IP:            rateLimit{Rate: 20, Burst: 100},
+		MaxBodyBytes:  1 << 20,
+	}
+}
+
+// rateLimitSweepInterval is how often buckets that are full again are
+// removed, so the buckets of devices and addresses that stopped sending do
+// not pile up.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a token bucket per key.
+type rateLimiter struct {
+	limit rateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool // the last request was limited
+}
+
+func newRateLimiter(limit rateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of the key. Without a token it returns
+// how long until there is one and if the key was allowed before, so the start
+// of a flood can be logged once.
+func (l *rateLimiter) allow(key string, now time.Time) (ok bool, retryAfter time.Duration, first bool) {
+	if l.limit.Rate <= 0 {
+		return true, 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweep(now)
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		first = !bucket.limited
+		bucket.limited = true
+		wait := (1 - bucket.tokens) / l.limit.Rate
+		return false, time.Duration(wait * float64(time.Second)), first
+	}
+	bucket.tokens--
+	bucket.limited = false
+	return true, 0, false
+}
+
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(l.limit.Burst), bucket.tokens+elapsed*l.limit.Rate)
+		bucket.last = now
+	}
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// deviceLimiter returns the limiter of a device class.
+func (s *regattaService) deviceLimiter(class string) *rateLimiter {
+	if limiter, ok := s.deviceLimiters[class]; ok {
+		return limiter
+	}
+	return s.deviceLimiters[defaultDeviceClass]
+}
+
+// allowRequest writes 429 Too Many Requests with a Retry-After header and
+// returns false if the key exceeded the limit. limit names the limit in logs
+// and metrics, "ip" or "device:<class>".
+func (s *regattaService) allowRequest(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, limit, key string) bool {
+	ok, retryAfter := s.allow(r.Context(), limiter, limit, key, "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	return false
+}
+
+// allow counts and logs requests over the limit. Only the first request of a
+// flood is logged as warning, the following ones at debug level.
+func (s *regattaService) allow(ctx context.Context, limiter *rateLimiter, limit, key string, args ...any) (bool, time.Duration) {
+	ok, retryAfter, first := limiter.allow(key, time.Now())
+	if ok {
+		return true, 0
+	}
+
+	rateLimitedTotal.WithLabelValues(limit).Inc()
+	args = append([]any{"limit", limit, "key", key, "retry_after", retryAfter}, args...)
+	if first {
+		s.LogWarn(ctx, "rate limit exceeded", args...)
+	} else {
+		s.LogDebug(ctx, "rate limit exceeded", args...)
+	}
+	return false, retryAfter
+}
+
+// remoteIP returns the IP of a remote address with port.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// readBody reads a request body of up to the configured size.
+func (s *regattaService) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.MaxBodyBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		oversizedBodiesTotal.Inc()
+	}
+	return body, err
+}
+
+// writeBodyError answers a request whose body could not be read.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Bad Request", http.StatusBadRequest)
+}
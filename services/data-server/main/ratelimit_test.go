@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(rateLimit{Rate: 0.5, Burst: 2})
+
+	steps := []struct {
+		after     time.Duration
+		key       string
+		wantOK    bool
+		wantRetry time.Duration
+		wantFirst bool
+	}{
+		{key: "a", wantOK: true},
+		{key: "a", wantOK: true},
+		{key: "a", wantRetry: 2 * time.Second, wantFirst: true},
+		{after: time.Second, key: "a", wantRetry: time.Second},
+		{key: "b", wantOK: true},
+		{after: time.Second, key: "a", wantOK: true},
+		{key: "a", wantRetry: 2 * time.Second, wantFirst: true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		ok, retryAfter, first := limiter.allow(step.key, now)
+		if ok != step.wantOK || retryAfter != step.wantRetry || first != step.wantFirst {
+			t.Errorf("step %d: allow(%q) = %v, %s, %v, want %v, %s, %v",
+				i, step.key, ok, retryAfter, first, step.wantOK, step.wantRetry, step.wantFirst)
+		}
+	}
+
+	// full buckets are removed
+	limiter.allow("c", now.Add(time.Hour))
+	if _, ok := limiter.buckets["b"]; ok {
+		t.Error("bucket of b was not removed")
+	}
+}
+
+func TestRequireDeviceRateLimit(t *testing.T) {
+	// nothing listens on port 1, so requests that pass the limit fail
+	dbClient, err := newDatabaseClient(databaseConfig{Host: "127.0.0.1", Port: 1, DatabaseName: "regatta", UserName: "regatta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dbClient.Database.Close() })
+
+	limits := defaultLimitConfig()
+	limits.IP = rateLimit{Rate: 0.1, Burst: 1}
+	s := newRegattaService(dbClient, defaultValidationConfig(), 0, limits, "")
+	handler := s.RequireDevice(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request passed without a valid token")
+	})
+
+	for i, want := range []int{http.StatusInternalServerError, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodPost, "/pushposition", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "10" {
+			t.Errorf("request %d: Retry-After = %q, want %q", i, w.Header().Get("Retry-After"), "10")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// replayConfig configures the replay of a recorded dataset.
+type replayConfig struct {
+	Dataset     string
+	Speed       float64       // 2 plays the dataset twice as fast as recorded
+	Loop        bool          // start over at the end of the dataset
+	StartOffset time.Duration // recorded time skipped at the start of the first lap
+}
+
+// replayLoopGap is the recorded time between the last position of a lap and
+// the first position of the next lap.
+const replayLoopGap = time.Second
+
+// replayPlayer plays a recorded dataset as if its boats were sailing right
+// now. The positions are inserted as positions of the device
+// "replay/<dataset>" into a storage of their own, which the service reads
+// like live data.
+type replayPlayer struct {
+	config    replayConfig
+	positions []Position // ordered by measure time
+	insert    func(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error)
+	forget    func(before time.Time) // drops played positions, so a loop does not grow
+	logError  func(err error)
+}
+
+func newReplayPlayer(
+	config replayConfig,
+	positions []Position,
+	insert func(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error),
+	forget func(before time.Time),
+	logError func(err error),
+) *replayPlayer {
+	return &replayPlayer{
+		config:    config,
+		positions: positions,
+		insert:    insert,
+		forget:    forget,
+		logError:  logError,
+	}
+}
+
+// playTime returns the time at which a recorded position is played in the
+// given lap of a replay that started at start.
+func (p *replayPlayer) playTime(start time.Time, lap int, measureTime time.Time) time.Time {
+	first := p.positions[0].MeasureTime
+	last := p.positions[len(p.positions)-1].MeasureTime
+	lapDuration := last.Sub(first) + replayLoopGap
+
+	recorded := time.Duration(lap)*lapDuration + measureTime.Sub(first) - p.config.StartOffset
+	return start.Add(time.Duration(float64(recorded) / p.config.Speed))
+}
+
+// Run plays the dataset until it ends or ctx is cancelled. Positions are
+// stored when they are due, all positions that are due at once are stored
+// together. Each lap forgets the positions played before the previous lap.
+func (p *replayPlayer) Run(ctx context.Context) {
+	if len(p.positions) == 0 {
+		return
+	}
+
+	deviceID := "replay/" + p.config.Dataset
+	start := time.Now()
+
+	for lap := 0; ; lap++ {
+		if lap > 1 {
+			p.forget(p.playTime(start, lap-1, p.positions[0].MeasureTime))
+		}
+
+		for i := 0; i < len(p.positions); {
+			playTime := p.playTime(start, lap, p.positions[i].MeasureTime)
+			if playTime.Before(start) {
+				// skipped by the start offset
+				i++
+				continue
+			}
+
+			if wait := time.Until(playTime); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+
+			now := time.Now()
+			pmr := PushMessageRequest{SendTime: now}
+			for ; i < len(p.positions); i++ {
+				playTime = p.playTime(start, lap, p.positions[i].MeasureTime)
+				if playTime.After(now) {
+					break
+				}
+
+				position := p.positions[i]
+				position.DeviceID = deviceID
+				position.MeasureTime = playTime
+				pmr.Positions = append(pmr.Positions, position)
+			}
+
+			if _, err := p.insert(ctx, &pmr); err != nil {
+				p.logError(fmt.Errorf("replay dataset %q: %w", p.config.Dataset, err))
+			}
+		}
+
+		if !p.config.Loop {
+			return
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayPlayTime(t *testing.T) {
+	recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := []Position{
+		{Boat: "Bluebird", MeasureTime: recorded},
+		{Boat: "Bluebird", MeasureTime: recorded.Add(9 * time.Second)},
+	}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		config      replayConfig
+		lap         int
+		measureTime time.Time
+		want        time.Time
+	}{
+		{
+			name:        "first position",
+			config:      replayConfig{Speed: 1},
+			measureTime: recorded,
+			want:        start,
+		},
+		{
+			name:        "double speed",
+			config:      replayConfig{Speed: 2},
+			measureTime: recorded.Add(9 * time.Second),
+			want:        start.Add(4500 * time.Millisecond),
+		},
+		{
+			name:        "second lap",
+			config:      replayConfig{Speed: 1},
+			lap:         1,
+			measureTime: recorded,
+			want:        start.Add(10 * time.Second),
+		},
+		{
+			name:        "start offset",
+			config:      replayConfig{Speed: 1, StartOffset: 3 * time.Second},
+			measureTime: recorded.Add(9 * time.Second),
+			want:        start.Add(6 * time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newReplayPlayer(tt.config, positions, nil, nil, nil)
+			if got := p.playTime(start, tt.lap, tt.measureTime); !got.Equal(tt.want) {
+				t.Errorf("playTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayPlayerRun(t *testing.T) {
+	recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := []Position{
+		{Boat: "Bluebird", Latitude: 1, MeasureTime: recorded},
+		{Boat: "Vivace", Latitude: 2, MeasureTime: recorded},
+		{Boat: "Bluebird", Latitude: 3, MeasureTime: recorded.Add(time.Second)},
+		{Boat: "Bluebird", Latitude: 4, MeasureTime: recorded.Add(2 * time.Second)},
+	}
+
+	var mu sync.Mutex
+	var played []Position
+	insert := func(_ context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		played = append(played, pmr.Positions...)
+		return InsertResult{Inserted: len(pmr.Positions)}, nil
+	}
+
+	config := replayConfig{Dataset: "training", Speed: 100, StartOffset: time.Second}
+	before := time.Now()
+	newReplayPlayer(config, positions, insert, nil, func(err error) { t.Error(err) }).Run(context.Background())
+
+	// the start offset skips the first two positions
+	if len(played) != 2 {
+		t.Fatalf("played %d positions, want 2", len(played))
+	}
+	for i, position := range played {
+		if position.DeviceID != "replay/training" {
+			t.Errorf("position %d: device ID = %q, want %q", i, position.DeviceID, "replay/training")
+		}
+		if position.MeasureTime.Before(before) || position.MeasureTime.After(time.Now()) {
+			t.Errorf("position %d: measure time %s is not within the replay", i, position.MeasureTime)
+		}
+	}
+	if played[0].Latitude != 3 || played[1].Latitude != 4 {
+		t.Errorf("played latitudes %v and %v, want 3 and 4", played[0].Latitude, played[1].Latitude)
+	}
+	if got := played[1].MeasureTime.Sub(played[0].MeasureTime); got != 10*time.Millisecond {
+		t.Errorf("time between positions = %s, want 10ms", got)
+	}
+}
+
+func TestReplayPlayerLoop(t *testing.T) {
+	recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := []Position{
+		{Boat: "Bluebird", MeasureTime: recorded},
+		{Boat: "Bluebird", MeasureTime: recorded.Add(time.Second)},
+		{Boat: "Bluebird", MeasureTime: recorded.Add(2 * time.Second)},
+	}
+	storage := newMemoryStorage()
+
+	// a lap takes 3ms
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	config := replayConfig{Dataset: "training", Speed: 1000, Loop: true}
+	newReplayPlayer(config, positions, storage.InsertPositions, storage.forgetPositions, func(err error) { t.Error(err) }).Run(ctx)
+
+	page, err := storage.GetPositionPage(context.Background(), 0, 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the previous lap and the current one
+	if len(page) == 0 || len(page) > 2*len(positions) {
+		t.Fatalf("stored %d positions, want at most %d", len(page), 2*len(positions))
+	}
+	if page[0].ID <= int64(len(positions)) {
+		t.Errorf("first stored ID = %d, want the first laps to be forgotten", page[0].ID)
+	}
+}
+
+func TestReplayPlayerValidation(t *testing.T) {
+	// the boat sails at 10 m/s, played ten times as fast it appears to sail
+	// at 100 m/s and jumps 40 m back to the start within 100ms with every lap
+	recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := make([]Position, 5)
+	for i := range positions {
+		positions[i] = Position{
+			Boat:        "Bluebird",
+			Latitude:    53.5 + float64(i)*10/111195,
+			Longitude:   10,
+			MeasureTime: recorded.Add(time.Duration(i) * time.Second),
+		}
+	}
+	storage := newMemoryStorage()
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+
+	// a lap takes 500ms
+	ctx, cancel := context.WithTimeout(context.Background(), 800*time.Millisecond)
+	defer cancel()
+	config := replayConfig{Dataset: "training", Speed: 10, Loop: true}
+	newReplayPlayer(config, positions, s.insertReplayPositions, storage.forgetPositions, func(err error) { t.Error(err) }).Run(ctx)
+
+	page, err := storage.GetPositionPage(context.Background(), 0, 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) <= len(positions) {
+		t.Fatalf("played %d positions, want more than one lap", len(page))
+	}
+	rejected, err := storage.GetRejectedPositions(context.Background(), "Bluebird", recorded, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, position := range rejected {
+		t.Errorf("position at %s rejected: %s", position.MeasureTime, position.RejectReason)
+	}
+}
+
+func TestReplayPositionStorage(t *testing.T) {
+	const token = "0123456789abcdef"
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// devices and their pushes use the storage, the replay is played into a
+	// position storage of its own
+	storage := newMemoryStorage()
+	storage.addToken("bluebird", token)
+	err := storage.AssignDevice(ctx, &DeviceAssignment{DeviceID: "bluebird", Boat: "Bluebird", StartTime: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayStorage := newMemoryStorage()
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+	s.positionStorage = replayStorage
+
+	replayed := PushMessageRequest{
+		Positions: []Position{{Boat: "Bluebird", DeviceID: "replay/training", Latitude: 53.5, Longitude: 10, MeasureTime: now.Add(-time.Minute)}},
+		SendTime:  now,
+	}
+	if _, err = s.insertReplayPositions(ctx, &replayed); err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf(`{"_type": "location", "tst": %d, "lat": 53.6, "lon": 10.1}`, now.Unix())
+	r := httptest.NewRequest(http.MethodPost, "/pushposition", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.RequireDevice(s.PushPositions)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("push: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	pushed, err := storage.GetPositions(ctx, "Bluebird", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed) != 1 || pushed[0].Latitude != 53.6 {
+		t.Errorf("stored %+v, want the pushed position", pushed)
+	}
+
+	body = fmt.Sprintf(`{"boat": "Bluebird", "start_time": %q, "end_time": %q}`,
+		now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))
+	r = httptest.NewRequest(http.MethodPost, "/readposition", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	s.ReadPositions(w, r)
+	var response ReadMessageResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.PositionsAtTime) != 1 || response.PositionsAtTime[0].Latitude != 53.5 {
+		t.Errorf("read %+v, want the replayed position", response.PositionsAtTime)
+	}
+}
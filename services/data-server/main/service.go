@@ -1,32 +1,160 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
 type regattaService struct {
-	dbClient *databaseClient
+	storageClient storageInterface
+	// positionStorage serves the position read and stream endpoints. It is
+	// storageClient unless a replay is played, see main.
+	positionStorage storageInterface
+	notifier        *positionNotifier
+	validation      validationConfig
+	bulkMaxBytes    int64
+	rejectedPushes  atomic.Int64
+
+	limits         limitConfig
+	ipLimiter      *rateLimiter
+	deviceLimiters map[string]*rateLimiter // by device class
+	// adminTokenHash is the hash of the token of the admin routes, empty if
+	// they are disabled.
+	adminTokenHash string
 }
 
-func newRegattaService(dbClient *databaseClient) *regattaService {
+// storageInterface is implemented by the Postgres, SQLite and in-memory
+// storages. They behave the same, see the conformance tests in
+// storage_conformance_test.go.
+type storageInterface interface {
+	Ping(ctx context.Context) error
+	// CheckSchema returns an error if the schema is not up to date.
+	CheckSchema(ctx context.Context) error
+	Close() error
+
+	// InsertPositions stores all positions or none of them, see InsertResult.
+	InsertPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error)
+	GetPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]PositionAtTime, error)
+	ForEachPosition(ctx context.Context, boat string, start time.Time, end time.Time, fn func(position PositionAtTime) error) error
+	GetPositionPage(ctx context.Context, cursor int64, limit int, boat string) ([]BoatPosition, error)
+	GetPreviousPosition(ctx context.Context, boat string, before time.Time) (*Position, error)
+	GetRejectedPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]RejectedPosition, error)
+
+	InsertTelemetry(ctx context.Context, boat string, telemetry []Telemetry) error
+	GetTelemetry(ctx context.Context, boat string, start time.Time, end time.Time) ([]Telemetry, error)
+
+	GetBoatOfDevice(ctx context.Context, deviceIDs []string, at time.Time) (string, string, error)
+	AssignDevice(ctx context.Context, assignment *DeviceAssignment) error
+	GetDeviceAssignments(ctx context.Context, boat string) ([]DeviceAssignment, error)
+	GetAssignmentsOfDevice(ctx context.Context, deviceID string) ([]DeviceAssignment, error)
+	GetDeviceOfToken(ctx context.Context, tokenHash string) (string, string, error)
+	GetCompactKeysOfDevice(ctx context.Context, deviceID string) ([]string, error)
+
+	GetReplayPositions(ctx context.Context, dataset string) ([]Position, error)
+
+	// InsertUnassignedPositions keeps positions of devices without boat until
+	// an assignment covers them, see attributeUnassignedPositions.
+	InsertUnassignedPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error)
+	GetUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) ([]PushMessageRequest, error)
+	DeleteUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) error
+}
+
+// newRegattaService returns the service. An empty adminToken disables the
+// admin routes.
+func newRegattaService(storageClient storageInterface, validation validationConfig, bulkMaxBytes int64, limits limitConfig, adminToken string) *regattaService {
+	deviceLimiters := map[string]*rateLimiter{
+		defaultDeviceClass: newRateLimiter(defaultLimitConfig().DeviceClasses[defaultDeviceClass]),
+	}
+	for class, limit := range limits.DeviceClasses {
+		deviceLimiters[class] = newRateLimiter(limit)
+	}
+
+	var adminTokenHash string
+	if adminToken != "" {
+		adminTokenHash = hashToken(adminToken)
+	}
+
 	return &regattaService{
-		dbClient: dbClient,
+		storageClient:   storageClient,
+		positionStorage: storageClient,
+		notifier:        newPositionNotifier(),
+		validation:      validation,
+		bulkMaxBytes:    bulkMaxBytes,
+		limits:          limits,
+		ipLimiter:       newRateLimiter(limits.IP),
+		deviceLimiters:  deviceLimiters,
+		adminTokenHash:  adminTokenHash,
 	}
 }
 
-func (s *regattaService) LogError(err error) {
-	log.Println(err.Error())
+// LogError logs an error with the request ID of the context. args are
+// key-value pairs like boat and device_id, as for slog.
+func (s *regattaService) LogError(ctx context.Context, err error, args ...any) {
+	slog.ErrorContext(ctx, err.Error(), args...)
+}
+
+func (s *regattaService) LogWarn(ctx context.Context, message string, args ...any) {
+	slog.WarnContext(ctx, message, args...)
+}
+
+func (s *regattaService) LogDebug(ctx context.Context, message string, args ...any) {
+	slog.DebugContext(ctx, message, args...)
 }
 
-func (s *regattaService) Ping(w http.ResponseWriter, _ *http.Request) {
+// insertPositions validates and stores positions and notifies the streams
+// about new ones. All ingest paths of devices store positions through it.
+func (s *regattaService) insertPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	if err := s.validatePositions(ctx, pmr, time.Now()); err != nil {
+		return InsertResult{}, fmt.Errorf("validate positions: %w", err)
+	}
+	return s.storePositions(ctx, s.storageClient, pmr)
+}
+
+// insertReplayPositions stores the positions of a replay in the position
+// storage and notifies the streams about new ones. A replay is played faster
+// than it was recorded and jumps back to its start with every lap, so only
+// the checks of single fixes apply and the speed between fixes is not checked.
+func (s *regattaService) insertReplayPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	receiveTime := time.Now()
+	for i := range pmr.Positions {
+		pmr.Positions[i].RejectReason = s.validation.rejectReason(&pmr.Positions[i], receiveTime)
+	}
+	return s.storePositions(ctx, s.positionStorage, pmr)
+}
+
+func (s *regattaService) storePositions(ctx context.Context, storage storageInterface, pmr *PushMessageRequest) (InsertResult, error) {
+	result, err := storage.InsertPositions(ctx, pmr)
+	if err != nil {
+		return result, err
+	}
+	observeIngest(pmr.Positions)
+
+	for _, position := range pmr.Positions {
+		if position.RejectReason != "" {
+			s.LogDebug(ctx, "reject position", "boat", position.Boat, "device_id", position.DeviceID,
+				"measure_time", position.MeasureTime, "reason", position.RejectReason)
+		}
+	}
+
+	if result.Inserted > 0 {
+		s.notifier.Notify()
+	}
+
+	return result, nil
+}
+
+func (s *regattaService) Ping(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
 	if _, err := w.Write([]byte("pong")); err != nil {
 		err = fmt.Errorf("ping: write to http response writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -34,14 +162,13 @@ func (s *regattaService) Ping(w http.ResponseWriter, _ *http.Request) {
 
 func (s *regattaService) PushPositions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	fmt.Println("endpoint /pushposition called")
 
 	// read body
-	body, err := io.ReadAll(r.Body)
+	body, err := s.readBody(w, r)
 	if err != nil {
 		err = fmt.Errorf("push position: read http body: %w", err)
-		s.LogError(err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
 		return
 	}
 
@@ -49,59 +176,50 @@ func (s *regattaService) PushPositions(w http.ResponseWriter, r *http.Request) {
 	var m OwnTracksMessage
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("push position: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	// convert data
-	pmr := PushMessageRequest{
-		Positions: []Position{
-			{
-				Boat:        "Bluebird",
-				Longitude:   m.Longitude,
-				Latitude:    m.Latitude,
-				MeasureTime: time.Unix(int64(m.CreatedAt), 0),
-			},
-		},
-		SendTime: time.Unix(int64(m.CreatedAt), 0),
-	}
-
-	// store new data in DB
-	err = s.dbClient.InsertPositions(ctx, &pmr)
+	deviceID, _ := authenticatedDevice(ctx)
+	result, err := s.handleOwnTracksMessage(ctx, []string{deviceID}, &m)
 	if err != nil {
-		err = fmt.Errorf("push position: insert into database: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("push position: %w", err)
+		s.LogError(ctx, err, "device_id", deviceID)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+
+	if err = writeOwnTracksResponse(w, result); err != nil {
+		err = fmt.Errorf("push position: write to http writer: %w", err)
+		s.LogError(ctx, err, "device_id", deviceID)
+		return
+	}
 }
 
 func (s *regattaService) ReadPositions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	fmt.Println("endpoint /readpositions called")
-
 	// parse data from request
 	var m ReadMessageRequest
-	body, err := io.ReadAll(r.Body)
+	body, err := s.readBody(w, r)
 	if err != nil {
 		err = fmt.Errorf("read position: read http body: %w", err)
-		s.LogError(err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
 		return
 	}
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("read position: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	positions, err := s.dbClient.GetPositions(ctx, m.Boat, m.StartTime, m.EndTime)
+	positions, err := s.positionStorage.GetPositions(ctx, m.Boat, m.StartTime, m.EndTime)
 	if err != nil {
 		err = fmt.Errorf("read position: extract from database: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -113,7 +231,7 @@ func (s *regattaService) ReadPositions(w http.ResponseWriter, r *http.Request) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("read position: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -121,7 +239,117 @@ func (s *regattaService) ReadPositions(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(responseBytes)
 	if err != nil {
 		err = fmt.Errorf("read position: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+}
+
+// ReadRejectedPositions returns the positions of a boat that failed the
+// validation on ingest, for debugging trackers.
+func (s *regattaService) ReadRejectedPositions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var m ReadMessageRequest
+	body, err := s.readBody(w, r)
+	if err != nil {
+		err = fmt.Errorf("read rejected positions: read http body: %w", err)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, &m); err != nil {
+		err = fmt.Errorf("read rejected positions: unmarshal http body: %w", err)
+		s.LogError(ctx, err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	positions, err := s.positionStorage.GetRejectedPositions(ctx, m.Boat, m.StartTime, m.EndTime)
+	if err != nil {
+		err = fmt.Errorf("read rejected positions: extract from database: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	responseBytes, err := json.Marshal(ReadRejectedPositionsResponse{RejectedPositions: positions})
+	if err != nil {
+		err = fmt.Errorf("read rejected positions: marshal response: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	_, err = w.Write(responseBytes)
+	if err != nil {
+		err = fmt.Errorf("read rejected positions: write to http writer: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+}
+
+const (
+	defaultPositionPageLimit = 1000
+	maxPositionPageLimit     = 10000
+)
+
+// ReadPositionPage returns the positions stored after a cursor. Unlike
+// ReadPositions it also returns positions that arrive late with an old
+// measure time.
+func (s *regattaService) ReadPositionPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// parse data from request
+	var m ReadPositionPageRequest
+	body, err := s.readBody(w, r)
+	if err != nil {
+		err = fmt.Errorf("read position page: read http body: %w", err)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, &m); err != nil {
+		err = fmt.Errorf("read position page: unmarshal http body: %w", err)
+		s.LogError(ctx, err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if m.Limit <= 0 {
+		m.Limit = defaultPositionPageLimit
+	}
+	m.Limit = min(m.Limit, maxPositionPageLimit)
+
+	positions, err := s.positionStorage.GetPositionPage(ctx, m.Cursor, m.Limit, m.Boat)
+	if err != nil {
+		err = fmt.Errorf("read position page: extract from database: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat, "cursor", m.Cursor)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	response := ReadPositionPageResponse{
+		Positions:  positions,
+		NextCursor: m.Cursor,
+	}
+	if len(positions) > 0 {
+		response.NextCursor = positions[len(positions)-1].ID
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		err = fmt.Errorf("read position page: marshal response: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat, "cursor", m.Cursor)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	_, err = w.Write(responseBytes)
+	if err != nil {
+		err = fmt.Errorf("read position page: write to http writer: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat, "cursor", m.Cursor)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -132,69 +360,235 @@ func (s *regattaService) PushBattery(w http.ResponseWriter, r *http.Request) {
 
 	// parse data from request
 	var m BatteryMessage
-	body, err := io.ReadAll(r.Body)
+	body, err := s.readBody(w, r)
 	if err != nil {
 		err = fmt.Errorf("push battery: read http body: %w", err)
-		s.LogError(err)
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
 		return
 	}
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("push battery: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	// store new data in DB
-	err = s.dbClient.InsertBatteryLevels(ctx, &m)
+	// resolve the boats of all levels first, so nothing is stored if one of
+	// them cannot be, and a retry of the request does not duplicate rows
+	deviceID, _ := authenticatedDevice(ctx)
+	var boats []string
+	telemetry := map[string][]Telemetry{}
+	for _, batteryLevel := range m.BatteryLevel {
+		boat, _, err := s.storageClient.GetBoatOfDevice(ctx, []string{deviceID}, batteryLevel.MeasureTime)
+		if err != nil {
+			err = fmt.Errorf("push battery: get boat of device: %w", err)
+			s.LogError(ctx, err, "device_id", deviceID)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if boat == "" {
+			err = fmt.Errorf("push battery: no boat assigned to device %q at %s", deviceID, batteryLevel.MeasureTime)
+			s.LogError(ctx, err, "device_id", deviceID)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := telemetry[boat]; !ok {
+			boats = append(boats, boat)
+		}
+		telemetry[boat] = append(telemetry[boat], Telemetry{
+			DeviceID:     deviceID,
+			MeasureTime:  batteryLevel.MeasureTime,
+			BatteryLevel: &batteryLevel.BatteryLevel,
+		})
+	}
+
+	// store new data in DB, a batch only spans several boats if the device
+	// was reassigned in between
+	for _, boat := range boats {
+		err = s.storageClient.InsertTelemetry(ctx, boat, telemetry[boat])
+		if err != nil {
+			err = fmt.Errorf("push battery: insert into database: %w", err)
+			s.LogError(ctx, err, "boat", boat, "device_id", deviceID)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+}
+
+func (s *regattaService) ReadTelemetry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// parse data from request
+	var m ReadMessageRequest
+	body, err := s.readBody(w, r)
 	if err != nil {
-		err = fmt.Errorf("push battery: insert into database: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("read telemetry: read http body: %w", err)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, &m); err != nil {
+		err = fmt.Errorf("read telemetry: unmarshal http body: %w", err)
+		s.LogError(ctx, err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	telemetry, err := s.storageClient.GetTelemetry(ctx, m.Boat, m.StartTime, m.EndTime)
+	if err != nil {
+		err = fmt.Errorf("read telemetry: extract from database: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	responseBytes, err := json.Marshal(ReadTelemetryResponse{Telemetry: telemetry})
+	if err != nil {
+		err = fmt.Errorf("read telemetry: marshal response: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	_, err = w.Write(responseBytes)
+	if err != nil {
+		err = fmt.Errorf("read telemetry: write to http writer: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 }
 
-func (s *regattaService) ReadBattery(w http.ResponseWriter, r *http.Request) {
+func (s *regattaService) AssignDevice(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// parse data from request
-	var b ReadMessageRequest
-	body, err := io.ReadAll(r.Body)
+	var m DeviceAssignment
+	body, err := s.readBody(w, r)
 	if err != nil {
-		err = fmt.Errorf("read battery: read http body: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("assign device: read http body: %w", err)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, &m); err != nil {
+		err = fmt.Errorf("assign device: unmarshal http body: %w", err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
-	if err = json.Unmarshal(body, &b); err != nil {
-		err = fmt.Errorf("read battery: unmarshal http body: %w", err)
-		s.LogError(err)
+
+	if m.DeviceID == "" || m.Boat == "" || m.StartTime.IsZero() {
+		err = errors.New("assign device: device_id, boat and start_time are required")
+		s.LogError(ctx, err, "boat", m.Boat, "device_id", m.DeviceID)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	if m.EndTime != nil && !m.EndTime.After(m.StartTime) {
+		err = errors.New("assign device: end_time must be after start_time")
+		s.LogError(ctx, err, "boat", m.Boat, "device_id", m.DeviceID)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	err = s.storageClient.AssignDevice(ctx, &m)
+	if err != nil {
+		err = fmt.Errorf("assign device: insert into database: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat, "device_id", m.DeviceID)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// the assignment is stored, positions that are not attributed stay kept
+	// until the next assignment that covers them
+	result, err := s.attributeUnassignedPositions(ctx, &m)
+	if err != nil {
+		err = fmt.Errorf("assign device: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat, "device_id", m.DeviceID)
+	}
+	setInsertResultHeaders(w, result)
+}
+
+// attributeUnassignedPositions stores the kept positions of a device that an
+// assignment covers as positions of its boat. Inserting them again is
+// harmless, they are duplicates then, so they are deleted only after all of
+// them are stored.
+func (s *regattaService) attributeUnassignedPositions(ctx context.Context, assignment *DeviceAssignment) (InsertResult, error) {
+	pushes, err := s.storageClient.GetUnassignedPositions(ctx, assignment.DeviceID, assignment.StartTime, assignment.EndTime)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("get unassigned positions: %w", err)
+	}
+	if len(pushes) == 0 {
+		return InsertResult{}, nil
+	}
+
+	var total InsertResult
+	for i := range pushes {
+		for j := range pushes[i].Positions {
+			pushes[i].Positions[j].Boat = assignment.Boat
+		}
+		result, err := s.insertPositions(ctx, &pushes[i])
+		if err != nil {
+			return total, fmt.Errorf("insert unassigned positions: %w", err)
+		}
+		total.Inserted += result.Inserted
+		total.Duplicates += result.Duplicates
+		total.Conflicts += result.Conflicts
+		total.Rejected += result.Rejected
+	}
+
+	err = s.storageClient.DeleteUnassignedPositions(ctx, assignment.DeviceID, assignment.StartTime, assignment.EndTime)
+	if err != nil {
+		return total, fmt.Errorf("delete unassigned positions: %w", err)
+	}
+
+	s.LogDebug(ctx, "attribute unassigned positions", "boat", assignment.Boat, "device_id", assignment.DeviceID, "inserted", total.Inserted)
+	return total, nil
+}
+
+func (s *regattaService) ReadDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// parse data from request
+	var m ReadDevicesRequest
+	body, err := s.readBody(w, r)
+	if err != nil {
+		err = fmt.Errorf("read devices: read http body: %w", err)
+		s.LogError(ctx, err)
+		writeBodyError(w, err)
+		return
+	}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &m); err != nil {
+			err = fmt.Errorf("read devices: unmarshal http body: %w", err)
+			s.LogError(ctx, err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
 
-	batteryMessage, err := s.dbClient.ExtractBatteryLevel(ctx, b.StartTime, b.EndTime)
+	devices, err := s.storageClient.GetDeviceAssignments(ctx, m.Boat)
 	if err != nil {
-		err = fmt.Errorf("read battery: extract from database: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("read devices: extract from database: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	responseBytes, err := json.Marshal(batteryMessage)
+	responseBytes, err := json.Marshal(ReadDevicesResponse{Devices: devices})
 	if err != nil {
-		err = fmt.Errorf("read battery: marshal response: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("read devices: marshal response: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
 	_, err = w.Write(responseBytes)
 	if err != nil {
-		err = fmt.Errorf("read battery: write to http writer: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("read devices: write to http writer: %w", err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushBattery(t *testing.T) {
+	const token = "0123456789abcdef"
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	storage := newMemoryStorage()
+	storage.addToken("bluebird/phone", token)
+	err := storage.AssignDevice(ctx, &DeviceAssignment{DeviceID: "bluebird/phone", Boat: "Bluebird", StartTime: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+
+	push := func(times ...time.Time) int {
+		var levels []string
+		for i, measureTime := range times {
+			levels = append(levels, fmt.Sprintf(`{"battery_level": %d, "measure_time": %q}`, 90-i, measureTime.Format(time.RFC3339)))
+		}
+		body := `{"battery_level": [` + strings.Join(levels, ", ") + `]}`
+		r := httptest.NewRequest(http.MethodPost, "/pushbattery", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.RequireDevice(s.PushBattery)(w, r)
+		return w.Code
+	}
+	stored := func() int {
+		telemetry, err := storage.GetTelemetry(ctx, "Bluebird", now.Add(-3*time.Hour), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(telemetry)
+	}
+
+	// the last level is from before the assignment, so none of them is stored
+	if code := push(now.Add(-time.Minute), now.Add(-2*time.Hour)); code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if got := stored(); got != 0 {
+		t.Errorf("stored %d levels of a rejected batch, want none", got)
+	}
+
+	if code := push(now.Add(-2*time.Minute), now.Add(-time.Minute)); code != http.StatusOK {
+		t.Errorf("status = %d, want %d", code, http.StatusOK)
+	}
+	if got := stored(); got != 2 {
+		t.Errorf("stored %d levels, want 2", got)
+	}
+}
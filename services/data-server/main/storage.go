@@ -5,18 +5,50 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
-type DatabaseInterface interface {
-	InsertPosition(ctx context.Context, position *PushMessageRequest) error
+const (
+	storagePostgres = "postgres"
+	storageSQLite   = "sqlite"
+	storageMemory   = "memory"
+)
+
+type storageConfig struct {
+	Backend      string // storagePostgres, storageSQLite or storageMemory
+	SQLitePath   string
+	DeviceTokens map[string]string // token by device, only for storageMemory
+}
+
+// newStorage opens the configured storage. The schema of Postgres is
+// migrated or verified, see prepareSchema, SQLite creates its tables itself.
+func newStorage(ctx context.Context, c *config) (storageInterface, error) {
+	switch c.Storage.Backend {
+	case storageSQLite:
+		return newSQLiteClient(ctx, c.Storage.SQLitePath)
+	case storageMemory:
+		m := newMemoryStorage()
+		for deviceID, token := range c.Storage.DeviceTokens {
+			m.addToken(deviceID, token)
+		}
+		return m, nil
+	}
+
+	dbClient, err := newDatabaseClient(c.DBConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err = prepareSchema(ctx, dbClient, c.MigrateOnStart); err != nil {
+		_ = dbClient.Close()
+		return nil, fmt.Errorf("prepare schema: %w", err)
+	}
+	return dbClient, nil
 }
 
 type databaseClient struct {
 	Database       *sql.DB
 	defaultTimeout time.Duration
-
-	mode string // "normal", "test"
 }
 
 type databaseConfig struct {
@@ -25,74 +57,295 @@ type databaseConfig struct {
 	DatabaseName string
 	UserName     string
 	UserPassword string
+	// MaxOpenConns limits the open connections, 0 means no limit.
+	MaxOpenConns int
+	// MaxIdleConns limits the idle connections, 0 keeps the default of 2.
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// Timeout limits every query, 0 means 1 minute.
+	Timeout time.Duration
 }
 
-func newDatabaseClient(config databaseConfig, mode string) (*databaseClient, error) {
+func newDatabaseClient(config databaseConfig) (*databaseClient, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=disable",
 		config.Host, config.Port, config.UserName, config.UserPassword, config.DatabaseName)
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("connect to database 'regatta': %w", err)
 	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
 	return &databaseClient{
 		Database:       db,
-		defaultTimeout: time.Minute,
-		mode:           mode,
+		defaultTimeout: timeout,
 	}, nil
 }
 
-func (c *databaseClient) InsertPositions(ctx context.Context, position *PushMessageRequest) error {
-	if position == nil {
-		return errors.New("position is set to nil")
+// CheckSchema returns an error if not all migrations are applied.
+func (c *databaseClient) CheckSchema(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return checkSchemaVersion(ctx, c, migrations)
+}
+
+func (c *databaseClient) Close() error {
+	return c.Database.Close()
+}
+
+// maxRowsPerInsert limits the rows of a multi-row insert, so the number of
+// parameters stays well below the limit of 65535 of Postgres.
+const maxRowsPerInsert = 1000
+
+// valuesPlaceholders returns the placeholders of a multi-row VALUES list,
+// e.g. "($1, $2), ($3, $4)" for two rows with two columns.
+func valuesPlaceholders(rows, columns int) string {
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for column := 0; column < columns; column++ {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", row*columns+column+1)
+		}
+		b.WriteString(")")
 	}
+	return b.String()
+}
+
+// positionsInsertLock is the key of the advisory lock held while inserting
+// positions.
+const positionsInsertLock = 7243
+
+// deviceAssignmentLock is the first key of the advisory lock held while
+// assigning a device, the second one is the hash of the device ID. Two keys
+// do not share the key space of positionsInsertLock.
+const deviceAssignmentLock = 7244
+
+// positionKey identifies a position of a boat, measure times are compared
+// with the microsecond precision of the database.
+type positionKey struct {
+	boat        string
+	measureTime int64
+}
+
+func newPositionKey(boat string, measureTime time.Time) positionKey {
+	return positionKey{boat: boat, measureTime: measureTime.UnixMicro()}
+}
+
+// markDuplicates counts the inserted positions of a push and marks all other
+// positions as duplicates of a stored position, which it returns. Every
+// inserted key belongs to the first position of the push with that key.
+func markDuplicates(pmr *PushMessageRequest, inserted map[positionKey]bool) (InsertResult, []*Position) {
+	var result InsertResult
+	var duplicates []*Position
+	for i := range pmr.Positions {
+		key := newPositionKey(pmr.Positions[i].Boat, pmr.Positions[i].MeasureTime)
+		if inserted[key] {
+			result.Inserted++
+			if pmr.Positions[i].RejectReason != "" {
+				result.Rejected++
+			}
+			delete(inserted, key)
+			continue
+		}
+		pmr.Positions[i].Duplicate = true
+		duplicates = append(duplicates, &pmr.Positions[i])
+	}
+	result.Duplicates = len(duplicates)
+	return result, duplicates
+}
 
-	query := `INSERT INTO "positions_data_server"(boat, longitude, latitude, measure_time, send_time) VALUES ($1, $2, $3, $4, $5);`
+// InsertPositions inserts positions and skips the ones that are already
+// stored for the boat at the same measure time. Duplicates with different
+// coordinates are recorded as conflicts. Either all positions are processed
+// or none.
+func (c *databaseClient) InsertPositions(ctx context.Context, position *PushMessageRequest) (InsertResult, error) {
+	defer observeQuery("InsertPositions")()
+
+	var result InsertResult
+	if position == nil {
+		return result, errors.New("position is set to nil")
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	for i := range position.Positions {
-		_, err := c.Database.ExecContext(
-			ctx,
-			query,
-			position.Positions[i].Boat,
-			position.Positions[i].Longitude,
-			position.Positions[i].Latitude,
-			position.Positions[i].MeasureTime,
-			position.SendTime,
-		)
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Serialize inserts, so IDs become visible in ascending order and readers
+	// paging by ID cannot skip a position of a transaction that commits late.
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, positionsInsertLock)
+	if err != nil {
+		return result, fmt.Errorf("lock positions: %w", err)
+	}
+
+	inserted := map[positionKey]bool{}
+	for start := 0; start < len(position.Positions); start += maxRowsPerInsert {
+		chunk := position.Positions[start:min(start+maxRowsPerInsert, len(position.Positions))]
 
+		query := fmt.Sprintf(`
+       INSERT INTO "positions_data_server"(boat, device_id, longitude, latitude, measure_time, send_time, reject_reason)
+       VALUES %s
+       ON CONFLICT (boat, measure_time) DO NOTHING
+       RETURNING boat, measure_time;
+       `, valuesPlaceholders(len(chunk), 7))
+
+		args := make([]any, 0, 7*len(chunk))
+		for i := range chunk {
+			var rejectReason *string
+			if chunk[i].RejectReason != "" {
+				rejectReason = &chunk[i].RejectReason
+			}
+			args = append(args, chunk[i].Boat, chunk[i].DeviceID, chunk[i].Longitude, chunk[i].Latitude, chunk[i].MeasureTime, position.SendTime, rejectReason)
+		}
+
+		rows, err := tx.QueryContext(ctx, query, args...)
 		if err != nil {
-			return fmt.Errorf("insert position: %w", err)
+			return result, fmt.Errorf("insert positions: %w", err)
+		}
+		for rows.Next() {
+			var boat string
+			var measureTime time.Time
+			if err = rows.Scan(&boat, &measureTime); err != nil {
+				_ = rows.Close()
+				return result, fmt.Errorf("parse row: %w", err)
+			}
+			inserted[newPositionKey(boat, measureTime)] = true
+		}
+		if err = rows.Err(); err != nil {
+			return result, fmt.Errorf("insert positions: %w", err)
 		}
 	}
 
-	return nil
+	result, duplicates := markDuplicates(position, inserted)
+
+	if len(duplicates) > 0 {
+		result.Conflicts, err = insertPositionConflicts(ctx, tx, duplicates, position.SendTime)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return result, nil
 }
 
-func (c *databaseClient) GetPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]PositionAtTime, error) {
-	table := "positions_data_server"
-	startTime := start
-	endTime := end
-
-	if c.mode == "test" {
-		table = "positions_data_server_test"
-		endTime = time.Date(2024, 01, 01, 00, 00, end.Second(), 0, time.UTC)
-		if endTime.Second() < startTime.Second() {
-			startTime = time.Date(2023, 12, 31, 23, 59, start.Second(), 0, time.UTC)
-		} else {
-			startTime = time.Date(2024, 01, 01, 00, 00, start.Second(), 0, time.UTC)
+// insertPositionConflicts records the duplicates whose coordinates differ
+// from the stored position and returns how many there were.
+func insertPositionConflicts(ctx context.Context, tx *sql.Tx, duplicates []*Position, sendTime time.Time) (int, error) {
+	boats := make([]string, len(duplicates))
+	measureTimes := make([]time.Time, len(duplicates))
+	for i, duplicate := range duplicates {
+		boats[i] = duplicate.Boat
+		measureTimes[i] = duplicate.MeasureTime
+	}
+
+	query := `
+       SELECT id, boat, measure_time, longitude, latitude
+       FROM "positions_data_server"
+       WHERE (boat, measure_time) IN (SELECT * FROM unnest($1::text[], $2::timestamptz[]));
+       `
+
+	rows, err := tx.QueryContext(ctx, query, boats, measureTimes)
+	if err != nil {
+		return 0, fmt.Errorf("query existing positions: %w", err)
+	}
+
+	type storedPosition struct {
+		id        int64
+		longitude float64
+		latitude  float64
+	}
+	stored := map[positionKey]storedPosition{}
+	for rows.Next() {
+		var p storedPosition
+		var boat string
+		var measureTime time.Time
+		if err = rows.Scan(&p.id, &boat, &measureTime, &p.longitude, &p.latitude); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("parse row: %w", err)
+		}
+		stored[newPositionKey(boat, measureTime)] = p
+	}
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("query existing positions: %w", err)
+	}
+
+	var args []any
+	for _, duplicate := range duplicates {
+		p, ok := stored[newPositionKey(duplicate.Boat, duplicate.MeasureTime)]
+		if !ok {
+			return 0, fmt.Errorf("stored position of boat %q at %s not found", duplicate.Boat, duplicate.MeasureTime)
+		}
+		if p.longitude == duplicate.Longitude && p.latitude == duplicate.Latitude {
+			continue
+		}
+		args = append(args, p.id, duplicate.DeviceID, duplicate.Longitude, duplicate.Latitude, sendTime)
+	}
+
+	conflicts := len(args) / 5
+	for start := 0; start < conflicts; start += maxRowsPerInsert {
+		end := min(start+maxRowsPerInsert, conflicts)
+
+		query := fmt.Sprintf(`
+       INSERT INTO "position_conflicts"(position_id, device_id, longitude, latitude, send_time)
+       VALUES %s;
+       `, valuesPlaceholders(end-start, 5))
+
+		_, err = tx.ExecContext(ctx, query, args[5*start:5*end]...)
+		if err != nil {
+			return 0, fmt.Errorf("insert position conflicts: %w", err)
 		}
 	}
 
-	query := fmt.Sprintf(`
-       SELECT longitude, latitude, measure_time, send_time, receive_time
-       FROM %s
+	return conflicts, nil
+}
+
+// Ping checks that the database is reachable.
+func (c *databaseClient) Ping(ctx context.Context) error {
+	defer observeQuery("Ping")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	if err := c.Database.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", err)
+	}
+	return nil
+}
+
+func (c *databaseClient) GetPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]PositionAtTime, error) {
+	defer observeQuery("GetPositions")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, send_time, receive_time
+       FROM positions_data_server
        WHERE boat = $1
        AND measure_time > $2
        AND measure_time <= $3
+       AND reject_reason IS NULL
        ORDER BY measure_time ASC;
-       `, table)
+       `
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
@@ -101,8 +354,8 @@ func (c *databaseClient) GetPositions(ctx context.Context, boat string, start ti
 		ctx,
 		query,
 		boat,
-		startTime,
-		endTime)
+		start,
+		end)
 
 	if err != nil {
 		return nil, fmt.Errorf("query position: %w", err)
@@ -112,6 +365,7 @@ func (c *databaseClient) GetPositions(ctx context.Context, boat string, start ti
 	for rows.Next() {
 		var position PositionAtTime
 		err = rows.Scan(
+			&position.DeviceID,
 			&position.Longitude,
 			&position.Latitude,
 			&position.MeasureTime,
@@ -124,80 +378,675 @@ func (c *databaseClient) GetPositions(ctx context.Context, boat string, start ti
 		positions = append(positions, position)
 	}
 
-	if c.mode == "test" {
-		for i := range positions {
-			if positions[i].MeasureTime.Second() > end.Second() {
-				positions[i].MeasureTime = time.Date(end.Year(), end.Month(), end.Day(), end.Hour(), end.Minute(), positions[i].MeasureTime.Second(), 0, end.Location()).Add(-time.Minute)
-			} else {
-				positions[i].MeasureTime = time.Date(end.Year(), end.Month(), end.Day(), end.Hour(), end.Minute(), positions[i].MeasureTime.Second(), 0, end.Location())
-			}
-		}
+	return positions, nil
+}
+
+// GetPositionPage returns up to limit positions with an ID greater than the
+// cursor in ascending order of their IDs. All boats are returned if the boat
+// is empty.
+func (c *databaseClient) GetPositionPage(ctx context.Context, cursor int64, limit int, boat string) ([]BoatPosition, error) {
+	defer observeQuery("GetPositionPage")()
+
+	query := `
+       SELECT id, boat, device_id, longitude, latitude, measure_time, send_time, receive_time
+       FROM "positions_data_server"
+       WHERE id > $1
+       AND ($2 = '' OR boat = $2)
+       AND reject_reason IS NULL
+       ORDER BY id ASC
+       LIMIT $3;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, cursor, boat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query position page: %w", err)
 	}
+	defer func() { _ = rows.Close() }()
 
-	if len(positions) == 0 {
-		fmt.Println(start, startTime, end, endTime)
+	var positions []BoatPosition
+	for rows.Next() {
+		var position BoatPosition
+		err = rows.Scan(
+			&position.ID,
+			&position.Boat,
+			&position.DeviceID,
+			&position.Longitude,
+			&position.Latitude,
+			&position.MeasureTime,
+			&position.SendTime,
+			&position.ReceiveTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		positions = append(positions, position)
 	}
 
 	return positions, nil
 }
 
-func (c *databaseClient) InsertBatteryLevels(ctx context.Context, batteryMessage *BatteryMessage) error {
-	if batteryMessage == nil {
-		return errors.New("position is set to nil")
-	}
+// InsertTelemetry inserts telemetry of the devices of a boat. Either all of
+// it is inserted or none.
+func (c *databaseClient) InsertTelemetry(ctx context.Context, boat string, telemetry []Telemetry) error {
+	defer observeQuery("InsertTelemetry")()
 
-	query := `INSERT INTO "battery"(batteryLevel, measure_time) VALUES ($1, $2);`
+	query := `
+       INSERT INTO device_telemetry(boat, device_id, measure_time, battery_level, battery_status, accuracy, altitude, velocity, course, connectivity)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+       `
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	for i := range batteryMessage.BatteryLevel {
-		_, err := c.Database.ExecContext(
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i := range telemetry {
+		_, err := tx.ExecContext(
 			ctx,
 			query,
-			batteryMessage.BatteryLevel[i].BatteryLevel,
-			batteryMessage.BatteryLevel[i].MeasureTime,
+			boat,
+			telemetry[i].DeviceID,
+			telemetry[i].MeasureTime,
+			telemetry[i].BatteryLevel,
+			telemetry[i].BatteryStatus,
+			telemetry[i].Accuracy,
+			telemetry[i].Altitude,
+			telemetry[i].Velocity,
+			telemetry[i].Course,
+			telemetry[i].Connectivity,
 		)
 
 		if err != nil {
-			return fmt.Errorf("insert battery level: %w", err)
+			return fmt.Errorf("insert telemetry: %w", err)
 		}
 	}
 
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
 	return nil
 }
 
-func (c *databaseClient) ExtractBatteryLevel(ctx context.Context, start time.Time, end time.Time) (*BatteryMessage, error) {
-	query := `SELECT batteryLevel, measure_time FROM battery WHERE measure_time >= $1 AND measure_time < $2;`
+// GetTelemetry returns the telemetry of all devices of a boat in the given
+// time range in ascending order.
+func (c *databaseClient) GetTelemetry(ctx context.Context, boat string, start time.Time, end time.Time) ([]Telemetry, error) {
+	defer observeQuery("GetTelemetry")()
+
+	query := `
+       SELECT device_id, measure_time, battery_level, battery_status, accuracy, altitude, velocity, course, connectivity
+       FROM device_telemetry
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       ORDER BY measure_time ASC;
+       `
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	rows, err := c.Database.QueryContext(
+	rows, err := c.Database.QueryContext(ctx, query, boat, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("query telemetry: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var telemetry []Telemetry
+	for rows.Next() {
+		var t Telemetry
+		err = rows.Scan(
+			&t.DeviceID,
+			&t.MeasureTime,
+			&t.BatteryLevel,
+			&t.BatteryStatus,
+			&t.Accuracy,
+			&t.Altitude,
+			&t.Velocity,
+			&t.Course,
+			&t.Connectivity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		telemetry = append(telemetry, t)
+	}
+
+	return telemetry, nil
+}
+
+// GetBoatOfDevice returns the boat the first of the given devices that has an
+// assignment at the given time is assigned to, together with the ID of that
+// device. The boat is empty if none of the devices is assigned.
+func (c *databaseClient) GetBoatOfDevice(ctx context.Context, deviceIDs []string, at time.Time) (string, string, error) {
+	defer observeQuery("GetBoatOfDevice")()
+
+	query := `
+       SELECT boat, device_id
+       FROM devices
+       WHERE device_id = ANY($1)
+       AND start_time <= $2
+       AND (end_time > $2 OR end_time IS NULL)
+       ORDER BY array_position($1, device_id)
+       LIMIT 1;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	row := c.Database.QueryRowContext(ctx, query, deviceIDs, at)
+
+	var boat, deviceID string
+	err := row.Scan(&boat, &deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("scan device: %w", err)
+	}
+
+	return boat, deviceID, nil
+}
+
+// AssignDevice assigns a device to a boat. An open-ended assignment of the
+// device that started earlier is ended at the start of the new one, so a
+// device can be moved to another boat without ending the old assignment
+// first. Any other overlap with an existing assignment is an error.
+func (c *databaseClient) AssignDevice(ctx context.Context, assignment *DeviceAssignment) error {
+	defer observeQuery("AssignDevice")()
+
+	if assignment == nil {
+		return errors.New("assignment is set to nil")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Serialize the assignments of a device, under read committed two of them
+	// could otherwise both find no overlap and both be inserted.
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2));`, deviceAssignmentLock, assignment.DeviceID)
+	if err != nil {
+		return fmt.Errorf("lock device assignments: %w", err)
+	}
+
+	_, err = tx.ExecContext(
 		ctx,
-		query,
-		start,
-		end)
+		`UPDATE devices SET end_time = $2 WHERE device_id = $1 AND end_time IS NULL AND start_time < $2;`,
+		assignment.DeviceID,
+		assignment.StartTime,
+	)
+	if err != nil {
+		return fmt.Errorf("end open assignment: %w", err)
+	}
+
+	row := tx.QueryRowContext(
+		ctx,
+		`SELECT count(*) FROM devices
+        WHERE device_id = $1
+        AND (end_time > $2 OR end_time IS NULL)
+        AND ($3::timestamptz IS NULL OR start_time < $3);`,
+		assignment.DeviceID,
+		assignment.StartTime,
+		assignment.EndTime,
+	)
+	var overlapping int
+	if err = row.Scan(&overlapping); err != nil {
+		return fmt.Errorf("count overlapping assignments: %w", err)
+	}
+	if overlapping > 0 {
+		return fmt.Errorf("device %q is already assigned in this time range", assignment.DeviceID)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO devices(device_id, boat, start_time, end_time) VALUES ($1, $2, $3, $4);`,
+		assignment.DeviceID,
+		assignment.Boat,
+		assignment.StartTime,
+		assignment.EndTime,
+	)
+	if err != nil {
+		return fmt.Errorf("insert assignment: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetDeviceAssignments returns all device assignments of a boat ordered by
+// start time. All assignments are returned if the boat is empty.
+func (c *databaseClient) GetDeviceAssignments(ctx context.Context, boat string) ([]DeviceAssignment, error) {
+	defer observeQuery("GetDeviceAssignments")()
 
+	query := `
+       SELECT device_id, boat, start_time, end_time
+       FROM devices
+       WHERE $1 = '' OR boat = $1
+       ORDER BY start_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat)
 	if err != nil {
-		return nil, fmt.Errorf("query battery level: %w", err)
+		return nil, fmt.Errorf("query devices: %w", err)
 	}
+	defer func() { _ = rows.Close() }()
 
-	var batteryLevelSlice []BatteryLevel
+	var assignments []DeviceAssignment
 	for rows.Next() {
-		var batteryLevel BatteryLevel
+		var assignment DeviceAssignment
 		err = rows.Scan(
-			&batteryLevel.BatteryLevel,
-			&batteryLevel.MeasureTime,
+			&assignment.DeviceID,
+			&assignment.Boat,
+			&assignment.StartTime,
+			&assignment.EndTime,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("parse row: %w", err)
 		}
-		batteryLevelSlice = append(batteryLevelSlice, batteryLevel)
+		assignments = append(assignments, assignment)
 	}
 
-	batteryMessage := BatteryMessage{
-		BatteryLevel: batteryLevelSlice}
+	return assignments, nil
+}
+
+// GetDeviceOfToken returns the ID and class of the device a token with the
+// given hash was issued to. The device ID is empty if there is no such token
+// or if it was revoked.
+func (c *databaseClient) GetDeviceOfToken(ctx context.Context, tokenHash string) (string, string, error) {
+	defer observeQuery("GetDeviceOfToken")()
 
-	return &batteryMessage, nil
+	query := `SELECT device_id, device_class FROM device_credentials WHERE token_hash = $1 AND revoked_time IS NULL;`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	row := c.Database.QueryRowContext(ctx, query, tokenHash)
+
+	var deviceID, deviceClass string
+	err := row.Scan(&deviceID, &deviceClass)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("scan device: %w", err)
+	}
+
+	return deviceID, deviceClass, nil
+}
+
+// GetCompactKeysOfDevice returns the hex encoded keys the compact packets of a
+// device can be signed with, see compact.Key, one per token that is not
+// revoked. Tokens issued before compact keys were stored have none.
+func (c *databaseClient) GetCompactKeysOfDevice(ctx context.Context, deviceID string) ([]string, error) {
+	defer observeQuery("GetCompactKeysOfDevice")()
+
+	query := `SELECT compact_key FROM device_credentials WHERE device_id = $1 AND revoked_time IS NULL AND compact_key IS NOT NULL;`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("query compact keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var compactKeys []string
+	for rows.Next() {
+		var compactKey string
+		if err = rows.Scan(&compactKey); err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		compactKeys = append(compactKeys, compactKey)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("query compact keys: %w", err)
+	}
+
+	return compactKeys, nil
+}
+
+// GetReplayPositions returns the recorded positions of a replay dataset
+// ordered by measure time.
+func (c *databaseClient) GetReplayPositions(ctx context.Context, dataset string) ([]Position, error) {
+	defer observeQuery("GetReplayPositions")()
+
+	query := `
+       SELECT boat, longitude, latitude, measure_time
+       FROM replay_positions
+       WHERE dataset = $1
+       ORDER BY measure_time ASC, boat ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, dataset)
+	if err != nil {
+		return nil, fmt.Errorf("query replay positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var positions []Position
+	for rows.Next() {
+		var position Position
+		err = rows.Scan(
+			&position.Boat,
+			&position.Longitude,
+			&position.Latitude,
+			&position.MeasureTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		positions = append(positions, position)
+	}
+
+	return positions, nil
+}
+
+// ForEachPosition calls fn for every position of a boat in the time range
+// ordered by measure time, without holding all positions in memory.
+func (c *databaseClient) ForEachPosition(ctx context.Context, boat string, start time.Time, end time.Time, fn func(position PositionAtTime) error) error {
+	defer observeQuery("ForEachPosition")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, send_time, receive_time
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       AND reject_reason IS NULL
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, start, end)
+	if err != nil {
+		return fmt.Errorf("query position: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var position PositionAtTime
+		err = rows.Scan(
+			&position.DeviceID,
+			&position.Longitude,
+			&position.Latitude,
+			&position.MeasureTime,
+			&position.SendTime,
+			&position.ReceiveTime,
+		)
+		if err != nil {
+			return fmt.Errorf("parse row: %w", err)
+		}
+		if err = fn(position); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetPreviousPosition returns the last accepted position of a boat measured
+// before the given time, or nil if there is none.
+func (c *databaseClient) GetPreviousPosition(ctx context.Context, boat string, before time.Time) (*Position, error) {
+	defer observeQuery("GetPreviousPosition")()
+
+	query := `
+       SELECT boat, device_id, longitude, latitude, measure_time
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time < $2
+       AND reject_reason IS NULL
+       ORDER BY measure_time DESC
+       LIMIT 1;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var position Position
+	err := c.Database.QueryRowContext(ctx, query, boat, before).Scan(
+		&position.Boat,
+		&position.DeviceID,
+		&position.Longitude,
+		&position.Latitude,
+		&position.MeasureTime,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query previous position: %w", err)
+	}
+
+	return &position, nil
+}
+
+// GetRejectedPositions returns the positions of a boat in the time range that
+// failed the validation.
+func (c *databaseClient) GetRejectedPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]RejectedPosition, error) {
+	defer observeQuery("GetRejectedPositions")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, send_time, receive_time, reject_reason
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       AND reject_reason IS NOT NULL
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("query rejected positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var positions []RejectedPosition
+	for rows.Next() {
+		var position RejectedPosition
+		err = rows.Scan(
+			&position.DeviceID,
+			&position.Longitude,
+			&position.Latitude,
+			&position.MeasureTime,
+			&position.SendTime,
+			&position.ReceiveTime,
+			&position.RejectReason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		positions = append(positions, position)
+	}
+
+	return positions, nil
+}
+
+// GetAssignmentsOfDevice returns all boat assignments of a device ordered by
+// start time.
+func (c *databaseClient) GetAssignmentsOfDevice(ctx context.Context, deviceID string) ([]DeviceAssignment, error) {
+	defer observeQuery("GetAssignmentsOfDevice")()
+
+	query := `
+       SELECT device_id, boat, start_time, end_time
+       FROM devices
+       WHERE device_id = $1
+       ORDER BY start_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("query devices: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var assignments []DeviceAssignment
+	for rows.Next() {
+		var assignment DeviceAssignment
+		err = rows.Scan(
+			&assignment.DeviceID,
+			&assignment.Boat,
+			&assignment.StartTime,
+			&assignment.EndTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, nil
+}
+
+// appendUnassignedPosition adds a position to the pushes of unassigned
+// positions, which are ordered by send time. Positions with the same send
+// time belong to the same push.
+func appendUnassignedPosition(pushes []PushMessageRequest, position Position, sendTime time.Time) []PushMessageRequest {
+	if n := len(pushes); n > 0 && pushes[n-1].SendTime.Equal(sendTime) {
+		pushes[n-1].Positions = append(pushes[n-1].Positions, position)
+		return pushes
+	}
+	return append(pushes, PushMessageRequest{Positions: []Position{position}, SendTime: sendTime})
+}
+
+// InsertUnassignedPositions keeps positions of devices that are not assigned
+// to a boat, the boat of the positions is ignored. Positions that are already
+// kept for the device at the same measure time are duplicates.
+func (c *databaseClient) InsertUnassignedPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	defer observeQuery("InsertUnassignedPositions")()
+
+	if pmr == nil {
+		return InsertResult{}, errors.New("position is set to nil")
+	}
+
+	query := `
+       INSERT INTO unassigned_positions(device_id, longitude, latitude, measure_time, accuracy, send_time)
+       VALUES ($1, $2, $3, $4, $5, $6)
+       ON CONFLICT (device_id, measure_time) DO NOTHING;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var result InsertResult
+	for i := range pmr.Positions {
+		res, err := c.Database.ExecContext(
+			ctx,
+			query,
+			pmr.Positions[i].DeviceID,
+			pmr.Positions[i].Longitude,
+			pmr.Positions[i].Latitude,
+			pmr.Positions[i].MeasureTime,
+			pmr.Positions[i].Accuracy,
+			pmr.SendTime,
+		)
+		if err != nil {
+			return result, fmt.Errorf("insert unassigned position: %w", err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return result, fmt.Errorf("count inserted rows: %w", err)
+		}
+		if inserted > 0 {
+			result.Inserted++
+		} else {
+			result.Duplicates++
+		}
+	}
+
+	return result, nil
+}
+
+// GetUnassignedPositions returns the kept positions of a device measured from
+// start until end, or without end if it is nil, as the pushes they were sent
+// with in ascending order of their send time. The boat of the positions is
+// empty.
+func (c *databaseClient) GetUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) ([]PushMessageRequest, error) {
+	defer observeQuery("GetUnassignedPositions")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, accuracy, send_time
+       FROM unassigned_positions
+       WHERE device_id = $1 AND measure_time >= $2 AND ($3::timestamptz IS NULL OR measure_time < $3)
+       ORDER BY send_time ASC, measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, deviceID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("query unassigned positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var pushes []PushMessageRequest
+	for rows.Next() {
+		var position Position
+		var sendTime time.Time
+		err = rows.Scan(
+			&position.DeviceID,
+			&position.Longitude,
+			&position.Latitude,
+			&position.MeasureTime,
+			&position.Accuracy,
+			&sendTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		pushes = appendUnassignedPosition(pushes, position, sendTime)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("query unassigned positions: %w", err)
+	}
+
+	return pushes, nil
+}
+
+// DeleteUnassignedPositions deletes the kept positions of a device measured
+// from start until end, or without end if it is nil.
+func (c *databaseClient) DeleteUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) error {
+	defer observeQuery("DeleteUnassignedPositions")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.Database.ExecContext(
+		ctx,
+		`DELETE FROM unassigned_positions WHERE device_id = $1 AND measure_time >= $2 AND ($3::timestamptz IS NULL OR measure_time < $3);`,
+		deviceID,
+		start,
+		end,
+	)
+	if err != nil {
+		return fmt.Errorf("delete unassigned positions: %w", err)
+	}
+	return nil
 }
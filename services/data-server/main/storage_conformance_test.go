@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seededStorage is a storage under test. Device tokens and replay datasets
+// are only read by the service, the tests store them with the add methods.
+type seededStorage interface {
+	storageInterface
+	addCredential(tb testing.TB, deviceID, deviceClass, tokenHash, compactKey string, revoked bool)
+	addReplayPositions(tb testing.TB, dataset string, positions []Position)
+}
+
+func (m *memoryStorage) addCredential(_ testing.TB, deviceID, deviceClass, tokenHash, compactKey string, revoked bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.credentials = append(m.credentials, memoryCredential{deviceID: deviceID, deviceClass: deviceClass, tokenHash: tokenHash, compactKey: compactKey, revoked: revoked})
+}
+
+func (m *memoryStorage) addReplayPositions(_ testing.TB, dataset string, positions []Position) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range positions {
+		p.MeasureTime = memoryTime(p.MeasureTime)
+		m.replays[dataset] = append(m.replays[dataset], p)
+	}
+}
+
+func (c *sqliteClient) addCredential(tb testing.TB, deviceID, deviceClass, tokenHash, compactKey string, revoked bool) {
+	var revokedTime *int64
+	if revoked {
+		now := sqliteTime(time.Now())
+		revokedTime = &now
+	}
+	_, err := c.Database.Exec(`INSERT INTO device_credentials(device_id, device_class, token_hash, compact_key, revoked_time) VALUES ($1, $2, $3, NULLIF($4, ''), $5);`,
+		deviceID, deviceClass, tokenHash, compactKey, revokedTime)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func (c *sqliteClient) addReplayPositions(tb testing.TB, dataset string, positions []Position) {
+	for _, p := range positions {
+		_, err := c.Database.Exec(`INSERT INTO replay_positions(dataset, boat, longitude, latitude, measure_time) VALUES ($1, $2, $3, $4, $5);`,
+			dataset, p.Boat, p.Longitude, p.Latitude, sqliteTime(p.MeasureTime))
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func (c *databaseClient) addCredential(tb testing.TB, deviceID, deviceClass, tokenHash, compactKey string, revoked bool) {
+	var revokedTime *time.Time
+	if revoked {
+		now := time.Now()
+		revokedTime = &now
+	}
+	_, err := c.Database.Exec(`INSERT INTO device_credentials(device_id, device_class, token_hash, compact_key, revoked_time) VALUES ($1, $2, $3, NULLIF($4, ''), $5);`,
+		deviceID, deviceClass, tokenHash, compactKey, revokedTime)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func (c *databaseClient) addReplayPositions(tb testing.TB, dataset string, positions []Position) {
+	for _, p := range positions {
+		_, err := c.Database.Exec(`INSERT INTO replay_positions(dataset, boat, longitude, latitude, measure_time) VALUES ($1, $2, $3, $4, $5);`,
+			dataset, p.Boat, p.Longitude, p.Latitude, p.MeasureTime)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestStorageConformance(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) seededStorage
+	}{
+		{
+			name: storageMemory,
+			open: func(t *testing.T) seededStorage { return newMemoryStorage() },
+		},
+		{
+			name: storageSQLite,
+			open: func(t *testing.T) seededStorage {
+				c, err := newSQLiteClient(context.Background(), filepath.Join(t.TempDir(), "regatta.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { _ = c.Close() })
+				return c
+			},
+		},
+		{
+			name: storagePostgres,
+			open: func(t *testing.T) seededStorage {
+				c := newTestDatabaseClient(t)
+				_, err := c.Database.Exec(`TRUNCATE positions_data_server, position_conflicts, devices, device_credentials, device_telemetry, replay_positions, unassigned_positions RESTART IDENTITY;`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			testStorage(t, backend.open)
+		})
+	}
+}
+
+// testStorage checks the behavior the service relies on. Every subtest
+// starts with an empty storage.
+func testStorage(t *testing.T, open func(t *testing.T) seededStorage) {
+	ctx := context.Background()
+	base := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+
+	t.Run("schema", func(t *testing.T) {
+		s := open(t)
+		if err := s.Ping(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := s.CheckSchema(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("positions", func(t *testing.T) {
+		s := open(t)
+
+		push := &PushMessageRequest{SendTime: at(10), Positions: []Position{
+			{Boat: "Bluebird", DeviceID: "bluebird/phone", Latitude: 53.1, Longitude: 10.1, MeasureTime: at(1)},
+			{Boat: "Bluebird", DeviceID: "bluebird/phone", Latitude: 53.2, Longitude: 10.2, MeasureTime: at(2)},
+			{Boat: "Bluebird", DeviceID: "bluebird/phone", Latitude: 53.3, Longitude: 10.3, MeasureTime: at(3), RejectReason: "speed"},
+			{Boat: "Redwood", DeviceID: "redwood/phone", Latitude: 54.1, Longitude: 11.1, MeasureTime: at(1)},
+			{Boat: "Bluebird", DeviceID: "bluebird/phone", Latitude: 53.1, Longitude: 10.1, MeasureTime: at(1)},
+		}}
+		result, err := s.InsertPositions(ctx, push)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (InsertResult{Inserted: 4, Duplicates: 1, Rejected: 1}); result != want {
+			t.Errorf("first insert = %+v, want %+v", result, want)
+		}
+		if !push.Positions[4].Duplicate || push.Positions[0].Duplicate {
+			t.Error("duplicate in the push not marked")
+		}
+
+		result, err = s.InsertPositions(ctx, &PushMessageRequest{SendTime: at(20), Positions: []Position{
+			{Boat: "Bluebird", DeviceID: "bluebird/logger", Latitude: 53.9, Longitude: 10.9, MeasureTime: at(1)},
+			{Boat: "Bluebird", DeviceID: "bluebird/logger", Latitude: 53.2, Longitude: 10.2, MeasureTime: at(2)},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (InsertResult{Duplicates: 2, Conflicts: 1}); result != want {
+			t.Errorf("second insert = %+v, want %+v", result, want)
+		}
+
+		positions, err := s.GetPositions(ctx, "Bluebird", base, at(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(positions) != 2 || !positions[0].MeasureTime.Equal(at(1)) || !positions[1].MeasureTime.Equal(at(2)) {
+			t.Fatalf("positions = %+v, want the accepted ones at 1 s and 2 s", positions)
+		}
+		if p := positions[1]; p.DeviceID != "bluebird/phone" || p.Latitude != 53.2 || p.Longitude != 10.2 || !p.SendTime.Equal(at(10)) || p.ReceiveTime.IsZero() {
+			t.Errorf("position = %+v, want the first one sent", p)
+		}
+
+		// the start is exclusive, the end inclusive
+		positions, err = s.GetPositions(ctx, "Bluebird", at(1), at(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(positions) != 1 || !positions[0].MeasureTime.Equal(at(2)) {
+			t.Errorf("positions in (1 s, 2 s] = %+v, want the one at 2 s", positions)
+		}
+
+		var streamed []time.Time
+		err = s.ForEachPosition(ctx, "Bluebird", base, at(3), func(position PositionAtTime) error {
+			streamed = append(streamed, position.MeasureTime)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(streamed) != 2 || !streamed[0].Equal(at(1)) || !streamed[1].Equal(at(2)) {
+			t.Errorf("ForEachPosition = %v, want 1 s and 2 s", streamed)
+		}
+
+		rejected, err := s.GetRejectedPositions(ctx, "Bluebird", base, at(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rejected) != 1 || rejected[0].RejectReason != "speed" || !rejected[0].MeasureTime.Equal(at(3)) {
+			t.Errorf("rejected positions = %+v, want the one at 3 s", rejected)
+		}
+
+		previous, err := s.GetPreviousPosition(ctx, "Bluebird", at(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous == nil || !previous.MeasureTime.Equal(at(2)) || previous.Boat != "Bluebird" {
+			t.Errorf("previous position = %+v, want the accepted one at 2 s", previous)
+		}
+		previous, err = s.GetPreviousPosition(ctx, "Bluebird", at(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous != nil {
+			t.Errorf("previous position = %+v, want none", previous)
+		}
+	})
+
+	t.Run("position page", func(t *testing.T) {
+		s := open(t)
+
+		for i, boat := range []string{"Bluebird", "Redwood", "Bluebird", "Redwood", "Bluebird"} {
+			position := Position{Boat: boat, DeviceID: "phone", Latitude: 53, Longitude: 10, MeasureTime: at(i)}
+			if i == 2 {
+				position.RejectReason = "speed"
+			}
+			if _, err := s.InsertPositions(ctx, &PushMessageRequest{SendTime: at(i), Positions: []Position{position}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var measureTimes []time.Time
+		var cursor int64
+		for {
+			page, err := s.GetPositionPage(ctx, cursor, 2, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, position := range page {
+				if position.ID <= cursor {
+					t.Fatalf("ID %d after cursor %d", position.ID, cursor)
+				}
+				cursor = position.ID
+				measureTimes = append(measureTimes, position.MeasureTime)
+			}
+		}
+		if len(measureTimes) != 4 || !measureTimes[2].Equal(at(3)) {
+			t.Errorf("pages = %v, want the accepted positions in insert order", measureTimes)
+		}
+
+		page, err := s.GetPositionPage(ctx, 0, 10, "Redwood")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || page[0].Boat != "Redwood" || page[1].Boat != "Redwood" {
+			t.Errorf("page of Redwood = %+v, want its 2 positions", page)
+		}
+	})
+
+	t.Run("telemetry", func(t *testing.T) {
+		s := open(t)
+
+		battery := 80.0
+		connectivity := "mobile"
+		err := s.InsertTelemetry(ctx, "Bluebird", []Telemetry{
+			{DeviceID: "bluebird/phone", MeasureTime: at(2), BatteryLevel: &battery},
+			{DeviceID: "bluebird/phone", MeasureTime: at(1), Connectivity: &connectivity},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.InsertTelemetry(ctx, "Redwood", []Telemetry{{DeviceID: "redwood/phone", MeasureTime: at(1)}}); err != nil {
+			t.Fatal(err)
+		}
+
+		telemetry, err := s.GetTelemetry(ctx, "Bluebird", base, at(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(telemetry) != 2 || !telemetry[0].MeasureTime.Equal(at(1)) {
+			t.Fatalf("telemetry = %+v, want 2 in ascending order", telemetry)
+		}
+		if telemetry[0].Connectivity == nil || *telemetry[0].Connectivity != connectivity || telemetry[0].BatteryLevel != nil {
+			t.Errorf("telemetry = %+v, want only the connectivity", telemetry[0])
+		}
+		if telemetry[1].BatteryLevel == nil || *telemetry[1].BatteryLevel != battery {
+			t.Errorf("telemetry = %+v, want the battery level", telemetry[1])
+		}
+	})
+
+	t.Run("device assignments", func(t *testing.T) {
+		s := open(t)
+		hour := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+		assign := func(deviceID, boat string, start time.Time, end *time.Time) error {
+			return s.AssignDevice(ctx, &DeviceAssignment{DeviceID: deviceID, Boat: boat, StartTime: start, EndTime: end})
+		}
+
+		if err := assign("phone", "Bluebird", hour(0), nil); err != nil {
+			t.Fatal(err)
+		}
+		// moving the device ends the open assignment
+		if err := assign("phone", "Redwood", hour(2), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := assign("logger", "Greenfin", hour(0), nil); err != nil {
+			t.Fatal(err)
+		}
+		end := hour(2)
+		if err := assign("phone", "Greenfin", hour(1), &end); err == nil {
+			t.Error("overlapping assignment was accepted")
+		}
+
+		assignments, err := s.GetAssignmentsOfDevice(ctx, "phone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(assignments) != 2 || assignments[0].Boat != "Bluebird" || assignments[0].EndTime == nil ||
+			!assignments[0].EndTime.Equal(hour(2)) || assignments[1].EndTime != nil {
+			t.Errorf("assignments of phone = %+v, want Bluebird until 2 h and open Redwood", assignments)
+		}
+
+		tests := []struct {
+			deviceIDs  []string
+			at         time.Time
+			wantBoat   string
+			wantDevice string
+		}{
+			{deviceIDs: []string{"phone"}, at: hour(1), wantBoat: "Bluebird", wantDevice: "phone"},
+			{deviceIDs: []string{"phone"}, at: hour(2), wantBoat: "Redwood", wantDevice: "phone"},
+			{deviceIDs: []string{"phone"}, at: hour(-1)},
+			{deviceIDs: []string{"unknown", "logger", "phone"}, at: hour(3), wantBoat: "Greenfin", wantDevice: "logger"},
+		}
+		for _, tt := range tests {
+			boat, deviceID, err := s.GetBoatOfDevice(ctx, tt.deviceIDs, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if boat != tt.wantBoat || deviceID != tt.wantDevice {
+				t.Errorf("GetBoatOfDevice(%v, %s) = %q, %q, want %q, %q", tt.deviceIDs, tt.at, boat, deviceID, tt.wantBoat, tt.wantDevice)
+			}
+		}
+
+		all, err := s.GetDeviceAssignments(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		greenfin, err := s.GetDeviceAssignments(ctx, "Greenfin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 3 || len(greenfin) != 1 || greenfin[0].DeviceID != "logger" {
+			t.Errorf("assignments = %+v and of Greenfin %+v, want 3 and the logger", all, greenfin)
+		}
+	})
+
+	t.Run("concurrent device assignments", func(t *testing.T) {
+		s := open(t)
+		end := at(60)
+
+		// all assignments cover the same time, only one of them may be stored
+		boats := []string{"Bluebird", "Redwood", "Greenfin", "Vivace"}
+		var wg sync.WaitGroup
+		errs := make([]error, len(boats))
+		for i, boat := range boats {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = s.AssignDevice(ctx, &DeviceAssignment{DeviceID: "phone", Boat: boat, StartTime: base, EndTime: &end})
+			}()
+		}
+		wg.Wait()
+
+		assignments, err := s.GetAssignmentsOfDevice(ctx, "phone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed := len(slices.DeleteFunc(errs, func(err error) bool { return err == nil })); len(assignments) != 1 || failed != len(boats)-1 {
+			t.Errorf("assignments of phone = %+v with %d failed, want one of them", assignments, failed)
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		s := open(t)
+		s.addCredential(t, "phone", "default", "hash1", "key1", false)
+		s.addCredential(t, "phone", "logger", "hash2", "", false)
+		s.addCredential(t, "phone", "default", "hash3", "key3", true)
+		s.addCredential(t, "phone", "default", "hash4", "key4", false)
+
+		tests := []struct {
+			tokenHash  string
+			wantDevice string
+			wantClass  string
+		}{
+			{tokenHash: "hash2", wantDevice: "phone", wantClass: "logger"},
+			{tokenHash: "hash3"},
+			{tokenHash: "unknown"},
+		}
+		for _, tt := range tests {
+			deviceID, deviceClass, err := s.GetDeviceOfToken(ctx, tt.tokenHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deviceID != tt.wantDevice || deviceClass != tt.wantClass {
+				t.Errorf("GetDeviceOfToken(%q) = %q, %q, want %q, %q", tt.tokenHash, deviceID, deviceClass, tt.wantDevice, tt.wantClass)
+			}
+		}
+
+		compactKeys, err := s.GetCompactKeysOfDevice(ctx, "phone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(compactKeys)
+		if !slices.Equal(compactKeys, []string{"key1", "key4"}) {
+			t.Errorf("compact keys = %v, want those of the unrevoked tokens", compactKeys)
+		}
+	})
+
+	t.Run("replay positions", func(t *testing.T) {
+		s := open(t)
+		s.addReplayPositions(t, "regatta", []Position{
+			{Boat: "Redwood", Latitude: 54, Longitude: 11, MeasureTime: at(1)},
+			{Boat: "Bluebird", Latitude: 53, Longitude: 10, MeasureTime: at(2)},
+			{Boat: "Bluebird", Latitude: 53, Longitude: 10, MeasureTime: at(1)},
+		})
+		s.addReplayPositions(t, "other", []Position{{Boat: "Greenfin", Latitude: 53, Longitude: 10, MeasureTime: at(1)}})
+
+		positions, err := s.GetReplayPositions(ctx, "regatta")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(positions) != 3 || positions[0].Boat != "Bluebird" || positions[1].Boat != "Redwood" || !positions[2].MeasureTime.Equal(at(2)) {
+			t.Errorf("replay positions = %+v, want them by measure time and boat", positions)
+		}
+	})
+
+	t.Run("unassigned positions", func(t *testing.T) {
+		s := open(t)
+		accuracy := 5.0
+		pushes := []PushMessageRequest{
+			{Positions: []Position{{DeviceID: "phone", Latitude: 53, Longitude: 10, MeasureTime: at(2), Accuracy: &accuracy}}, SendTime: at(10)},
+			{Positions: []Position{
+				{DeviceID: "phone", Latitude: 53.1, Longitude: 10, MeasureTime: at(1)},
+				{DeviceID: "phone", Latitude: 53.2, Longitude: 10, MeasureTime: at(3)},
+			}, SendTime: at(5)},
+			{Positions: []Position{{DeviceID: "logger", Latitude: 54, Longitude: 11, MeasureTime: at(1)}}, SendTime: at(5)},
+		}
+		for i := range pushes {
+			result, err := s.InsertUnassignedPositions(ctx, &pushes[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Inserted != len(pushes[i].Positions) {
+				t.Errorf("push %d: inserted %d positions, want %d", i, result.Inserted, len(pushes[i].Positions))
+			}
+		}
+		result, err := s.InsertUnassignedPositions(ctx, &pushes[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Inserted != 0 || result.Duplicates != 1 {
+			t.Errorf("second insert = %+v, want a duplicate", result)
+		}
+
+		end := at(3)
+		got, err := s.GetUnassignedPositions(ctx, "phone", at(1), &end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || !got[0].SendTime.Equal(at(5)) || len(got[0].Positions) != 1 || got[0].Positions[0].Latitude != 53.1 ||
+			!got[1].SendTime.Equal(at(10)) || got[1].Positions[0].Accuracy == nil || *got[1].Positions[0].Accuracy != accuracy {
+			t.Errorf("unassigned positions until 3 s = %+v, want them by send time", got)
+		}
+
+		if err = s.DeleteUnassignedPositions(ctx, "phone", at(1), &end); err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetUnassignedPositions(ctx, "phone", at(0), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || len(got[0].Positions) != 1 || !got[0].Positions[0].MeasureTime.Equal(at(3)) {
+			t.Errorf("unassigned positions after the delete = %+v, want the one at 3 s", got)
+		}
+		got, err = s.GetUnassignedPositions(ctx, "logger", at(0), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Errorf("unassigned positions of logger = %+v, want them to be kept", got)
+		}
+	})
+}
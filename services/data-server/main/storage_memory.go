@@ -0,0 +1,480 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"regatta-watch/services/data-server/compact"
+)
+
+// memoryStorage keeps all data in memory, for tests and trying out the
+// service. Nothing is kept after a restart. Times are truncated to
+// microseconds like in the databases.
+type memoryStorage struct {
+	mu          sync.RWMutex
+	positions   []memoryPosition    // in ascending order of their IDs
+	byKey       map[positionKey]int // index in positions
+	lastID      int64
+	conflicts   []memoryConflict
+	telemetry   map[string][]Telemetry // by boat
+	assignments []DeviceAssignment
+	credentials []memoryCredential
+	replays     map[string][]Position // by dataset
+	unassigned  []memoryUnassignedPosition
+}
+
+type memoryPosition struct {
+	id           int64
+	boat         string
+	rejectReason string
+	PositionAtTime
+}
+
+type memoryConflict struct {
+	positionID int64
+	deviceID   string
+	longitude  float64
+	latitude   float64
+	sendTime   time.Time
+}
+
+type memoryUnassignedPosition struct {
+	position Position
+	sendTime time.Time
+}
+
+type memoryCredential struct {
+	deviceID    string
+	deviceClass string
+	tokenHash   string
+	compactKey  string // empty if the token has none
+	revoked     bool
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		byKey:     make(map[positionKey]int),
+		telemetry: make(map[string][]Telemetry),
+		replays:   make(map[string][]Position),
+	}
+}
+
+// addToken lets a device authenticate with a token of the class "default".
+// The memory storage starts empty, so its tokens are configured with
+// DEVICE_TOKENS instead of being issued by jobs/device_tokens.
+func (m *memoryStorage) addToken(deviceID, token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.credentials = append(m.credentials, memoryCredential{
+		deviceID:    deviceID,
+		deviceClass: "default",
+		tokenHash:   hashToken(token),
+		compactKey:  hex.EncodeToString(compact.Key(token)),
+	})
+}
+
+func memoryTime(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond).UTC()
+}
+
+func (m *memoryStorage) Ping(context.Context) error        { return nil }
+func (m *memoryStorage) CheckSchema(context.Context) error { return nil }
+func (m *memoryStorage) Close() error                      { return nil }
+
+// InsertPositions inserts positions and skips the ones that are already
+// stored for the boat at the same measure time. Duplicates with different
+// coordinates are recorded as conflicts.
+func (m *memoryStorage) InsertPositions(_ context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	if pmr == nil {
+		return InsertResult{}, errors.New("position is set to nil")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	receiveTime := memoryTime(time.Now())
+	inserted := map[positionKey]bool{}
+	for _, p := range pmr.Positions {
+		key := newPositionKey(p.Boat, p.MeasureTime)
+		if _, ok := m.byKey[key]; ok {
+			continue
+		}
+		m.lastID++
+		m.byKey[key] = len(m.positions)
+		m.positions = append(m.positions, memoryPosition{
+			id:           m.lastID,
+			boat:         p.Boat,
+			rejectReason: p.RejectReason,
+			PositionAtTime: PositionAtTime{
+				DeviceID:    p.DeviceID,
+				Longitude:   p.Longitude,
+				Latitude:    p.Latitude,
+				MeasureTime: memoryTime(p.MeasureTime),
+				SendTime:    memoryTime(pmr.SendTime),
+				ReceiveTime: receiveTime,
+			},
+		})
+		inserted[key] = true
+	}
+
+	result, duplicates := markDuplicates(pmr, inserted)
+	for _, duplicate := range duplicates {
+		stored := m.positions[m.byKey[newPositionKey(duplicate.Boat, duplicate.MeasureTime)]]
+		if stored.Longitude == duplicate.Longitude && stored.Latitude == duplicate.Latitude {
+			continue
+		}
+		m.conflicts = append(m.conflicts, memoryConflict{
+			positionID: stored.id,
+			deviceID:   duplicate.DeviceID,
+			longitude:  duplicate.Longitude,
+			latitude:   duplicate.Latitude,
+			sendTime:   memoryTime(pmr.SendTime),
+		})
+		result.Conflicts++
+	}
+
+	return result, nil
+}
+
+// forgetPositions drops the positions measured before the given time. The
+// IDs of the remaining positions do not change.
+func (m *memoryStorage) forgetPositions(before time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.positions = slices.DeleteFunc(m.positions, func(p memoryPosition) bool { return p.MeasureTime.Before(before) })
+	clear(m.byKey)
+	for i, p := range m.positions {
+		m.byKey[newPositionKey(p.boat, p.MeasureTime)] = i
+	}
+	m.conflicts = slices.DeleteFunc(m.conflicts, func(c memoryConflict) bool {
+		_, found := slices.BinarySearchFunc(m.positions, c.positionID, func(p memoryPosition, id int64) int { return cmp.Compare(p.id, id) })
+		return !found
+	})
+}
+
+// positionsInRange returns the positions of a boat measured after start and
+// until end, accepted or rejected, ordered by measure time.
+func (m *memoryStorage) positionsInRange(boat string, start, end time.Time, rejected bool) []memoryPosition {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var positions []memoryPosition
+	for _, p := range m.positions {
+		if p.boat == boat && p.MeasureTime.After(start) && !p.MeasureTime.After(end) && (p.rejectReason != "") == rejected {
+			positions = append(positions, p)
+		}
+	}
+	slices.SortFunc(positions, func(a, b memoryPosition) int { return a.MeasureTime.Compare(b.MeasureTime) })
+	return positions
+}
+
+func (m *memoryStorage) GetPositions(_ context.Context, boat string, start time.Time, end time.Time) ([]PositionAtTime, error) {
+	var positions []PositionAtTime
+	for _, p := range m.positionsInRange(boat, start, end, false) {
+		positions = append(positions, p.PositionAtTime)
+	}
+	return positions, nil
+}
+
+// ForEachPosition calls fn for every position of a boat in the time range
+// ordered by measure time.
+func (m *memoryStorage) ForEachPosition(_ context.Context, boat string, start time.Time, end time.Time, fn func(position PositionAtTime) error) error {
+	for _, p := range m.positionsInRange(boat, start, end, false) {
+		if err := fn(p.PositionAtTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPositionPage returns up to limit positions with an ID greater than the
+// cursor in ascending order of their IDs. All boats are returned if the boat
+// is empty.
+func (m *memoryStorage) GetPositionPage(_ context.Context, cursor int64, limit int, boat string) ([]BoatPosition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	first, _ := slices.BinarySearchFunc(m.positions, cursor+1, func(p memoryPosition, id int64) int { return cmp.Compare(p.id, id) })
+	var positions []BoatPosition
+	for _, p := range m.positions[first:] {
+		if len(positions) == limit {
+			break
+		}
+		if p.rejectReason != "" || boat != "" && p.boat != boat {
+			continue
+		}
+		positions = append(positions, BoatPosition{ID: p.id, Boat: p.boat, PositionAtTime: p.PositionAtTime})
+	}
+	return positions, nil
+}
+
+// GetPreviousPosition returns the last accepted position of a boat measured
+// before the given time, or nil if there is none.
+func (m *memoryStorage) GetPreviousPosition(_ context.Context, boat string, before time.Time) (*Position, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var previous *Position
+	for _, p := range m.positions {
+		if p.boat != boat || p.rejectReason != "" || !p.MeasureTime.Before(before) {
+			continue
+		}
+		if previous == nil || p.MeasureTime.After(previous.MeasureTime) {
+			previous = &Position{
+				Boat:        p.boat,
+				DeviceID:    p.DeviceID,
+				Longitude:   p.Longitude,
+				Latitude:    p.Latitude,
+				MeasureTime: p.MeasureTime,
+			}
+		}
+	}
+	return previous, nil
+}
+
+// GetRejectedPositions returns the positions of a boat in the time range that
+// failed the validation.
+func (m *memoryStorage) GetRejectedPositions(_ context.Context, boat string, start time.Time, end time.Time) ([]RejectedPosition, error) {
+	var positions []RejectedPosition
+	for _, p := range m.positionsInRange(boat, start, end, true) {
+		positions = append(positions, RejectedPosition{PositionAtTime: p.PositionAtTime, RejectReason: p.rejectReason})
+	}
+	return positions, nil
+}
+
+// InsertTelemetry inserts telemetry of the devices of a boat. Either all of
+// it is inserted or none.
+func (m *memoryStorage) InsertTelemetry(_ context.Context, boat string, telemetry []Telemetry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range telemetry {
+		t.MeasureTime = memoryTime(t.MeasureTime)
+		m.telemetry[boat] = append(m.telemetry[boat], t)
+	}
+	return nil
+}
+
+// GetTelemetry returns the telemetry of all devices of a boat in the given
+// time range in ascending order.
+func (m *memoryStorage) GetTelemetry(_ context.Context, boat string, start time.Time, end time.Time) ([]Telemetry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var telemetry []Telemetry
+	for _, t := range m.telemetry[boat] {
+		if t.MeasureTime.After(start) && !t.MeasureTime.After(end) {
+			telemetry = append(telemetry, t)
+		}
+	}
+	slices.SortStableFunc(telemetry, func(a, b Telemetry) int { return a.MeasureTime.Compare(b.MeasureTime) })
+	return telemetry, nil
+}
+
+// activeAt reports if an assignment covers the time.
+func activeAt(assignment DeviceAssignment, at time.Time) bool {
+	return !assignment.StartTime.After(at) && (assignment.EndTime == nil || assignment.EndTime.After(at))
+}
+
+// GetBoatOfDevice returns the boat the first of the given devices that has an
+// assignment at the given time is assigned to, together with the ID of that
+// device. The boat is empty if none of the devices is assigned.
+func (m *memoryStorage) GetBoatOfDevice(_ context.Context, deviceIDs []string, at time.Time) (string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, deviceID := range deviceIDs {
+		for _, assignment := range m.assignments {
+			if assignment.DeviceID == deviceID && activeAt(assignment, at) {
+				return assignment.Boat, deviceID, nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// AssignDevice assigns a device to a boat. An open-ended assignment of the
+// device that started earlier is ended at the start of the new one. Any other
+// overlap with an existing assignment is an error.
+func (m *memoryStorage) AssignDevice(_ context.Context, assignment *DeviceAssignment) error {
+	if assignment == nil {
+		return errors.New("assignment is set to nil")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	added := DeviceAssignment{
+		DeviceID:  assignment.DeviceID,
+		Boat:      assignment.Boat,
+		StartTime: memoryTime(assignment.StartTime),
+	}
+	if assignment.EndTime != nil {
+		endTime := memoryTime(*assignment.EndTime)
+		added.EndTime = &endTime
+	}
+
+	// work on a copy, so nothing changes on an overlap
+	assignments := slices.Clone(m.assignments)
+	for i, a := range assignments {
+		if a.DeviceID == added.DeviceID && a.EndTime == nil && a.StartTime.Before(added.StartTime) {
+			endTime := added.StartTime
+			assignments[i].EndTime = &endTime
+		}
+	}
+	for _, a := range assignments {
+		if a.DeviceID == added.DeviceID && (a.EndTime == nil || a.EndTime.After(added.StartTime)) &&
+			(added.EndTime == nil || a.StartTime.Before(*added.EndTime)) {
+			return fmt.Errorf("device %q is already assigned in this time range", added.DeviceID)
+		}
+	}
+
+	m.assignments = append(assignments, added)
+	return nil
+}
+
+// GetDeviceAssignments returns all device assignments of a boat ordered by
+// start time. All assignments are returned if the boat is empty.
+func (m *memoryStorage) GetDeviceAssignments(_ context.Context, boat string) ([]DeviceAssignment, error) {
+	return m.filterAssignments(func(a DeviceAssignment) bool { return boat == "" || a.Boat == boat }), nil
+}
+
+// GetAssignmentsOfDevice returns all boat assignments of a device ordered by
+// start time.
+func (m *memoryStorage) GetAssignmentsOfDevice(_ context.Context, deviceID string) ([]DeviceAssignment, error) {
+	return m.filterAssignments(func(a DeviceAssignment) bool { return a.DeviceID == deviceID }), nil
+}
+
+func (m *memoryStorage) filterAssignments(keep func(a DeviceAssignment) bool) []DeviceAssignment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var assignments []DeviceAssignment
+	for _, a := range m.assignments {
+		if keep(a) {
+			assignments = append(assignments, a)
+		}
+	}
+	slices.SortStableFunc(assignments, func(a, b DeviceAssignment) int { return a.StartTime.Compare(b.StartTime) })
+	return assignments
+}
+
+// GetDeviceOfToken returns the ID and class of the device a token with the
+// given hash was issued to. The device ID is empty if there is no such token
+// or if it was revoked.
+func (m *memoryStorage) GetDeviceOfToken(_ context.Context, tokenHash string) (string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.credentials {
+		if c.tokenHash == tokenHash && !c.revoked {
+			return c.deviceID, c.deviceClass, nil
+		}
+	}
+	return "", "", nil
+}
+
+// GetCompactKeysOfDevice returns the hex encoded keys the compact packets of a
+// device can be signed with, see compact.Key, one per token that is not
+// revoked.
+func (m *memoryStorage) GetCompactKeysOfDevice(_ context.Context, deviceID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var compactKeys []string
+	for _, c := range m.credentials {
+		if c.deviceID == deviceID && !c.revoked && c.compactKey != "" {
+			compactKeys = append(compactKeys, c.compactKey)
+		}
+	}
+	return compactKeys, nil
+}
+
+// GetReplayPositions returns the recorded positions of a replay dataset
+// ordered by measure time.
+func (m *memoryStorage) GetReplayPositions(_ context.Context, dataset string) ([]Position, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	positions := slices.Clone(m.replays[dataset])
+	slices.SortFunc(positions, func(a, b Position) int {
+		return cmp.Or(a.MeasureTime.Compare(b.MeasureTime), cmp.Compare(a.Boat, b.Boat))
+	})
+	return positions, nil
+}
+
+// InsertUnassignedPositions keeps positions of devices that are not assigned
+// to a boat, the boat of the positions is ignored. Positions that are already
+// kept for the device at the same measure time are duplicates.
+func (m *memoryStorage) InsertUnassignedPositions(_ context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	if pmr == nil {
+		return InsertResult{}, errors.New("position is set to nil")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result InsertResult
+	for _, position := range pmr.Positions {
+		position.Boat = ""
+		position.MeasureTime = memoryTime(position.MeasureTime)
+		if slices.ContainsFunc(m.unassigned, func(u memoryUnassignedPosition) bool {
+			return u.position.DeviceID == position.DeviceID && u.position.MeasureTime.Equal(position.MeasureTime)
+		}) {
+			result.Duplicates++
+			continue
+		}
+		m.unassigned = append(m.unassigned, memoryUnassignedPosition{position: position, sendTime: memoryTime(pmr.SendTime)})
+		result.Inserted++
+	}
+	return result, nil
+}
+
+// GetUnassignedPositions returns the kept positions of a device measured from
+// start until end, or without end if it is nil, as the pushes they were sent
+// with in ascending order of their send time. The boat of the positions is
+// empty.
+func (m *memoryStorage) GetUnassignedPositions(_ context.Context, deviceID string, start time.Time, end *time.Time) ([]PushMessageRequest, error) {
+	m.mu.RLock()
+	var kept []memoryUnassignedPosition
+	for _, u := range m.unassigned {
+		if unassignedIn(u, deviceID, start, end) {
+			kept = append(kept, u)
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortStableFunc(kept, func(a, b memoryUnassignedPosition) int {
+		return cmp.Or(a.sendTime.Compare(b.sendTime), a.position.MeasureTime.Compare(b.position.MeasureTime))
+	})
+	var pushes []PushMessageRequest
+	for _, u := range kept {
+		pushes = appendUnassignedPosition(pushes, u.position, u.sendTime)
+	}
+	return pushes, nil
+}
+
+// DeleteUnassignedPositions deletes the kept positions of a device measured
+// from start until end, or without end if it is nil.
+func (m *memoryStorage) DeleteUnassignedPositions(_ context.Context, deviceID string, start time.Time, end *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.unassigned = slices.DeleteFunc(m.unassigned, func(u memoryUnassignedPosition) bool {
+		return unassignedIn(u, deviceID, start, end)
+	})
+	return nil
+}
+
+func unassignedIn(u memoryUnassignedPosition, deviceID string, start time.Time, end *time.Time) bool {
+	return u.position.DeviceID == deviceID && !u.position.MeasureTime.Before(start) &&
+		(end == nil || u.position.MeasureTime.Before(*end))
+}
@@ -0,0 +1,942 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchemaVersion is the version of sqliteSchema, stored as user_version
+// of the database file.
+const sqliteSchemaVersion = 3
+
+// sqliteSchema has the tables of the Postgres migrations. Times are stored as
+// Unix time in microseconds, the precision of Postgres, so they compare
+// correctly.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS positions_data_server (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    boat text NOT NULL DEFAULT '',
+    device_id text NOT NULL DEFAULT '',
+    longitude real NOT NULL DEFAULT 0.0,
+    latitude real NOT NULL DEFAULT 0.0,
+    measure_time integer NOT NULL DEFAULT 0,
+    send_time integer NOT NULL DEFAULT 0,
+    receive_time integer NOT NULL,
+    reject_reason text,
+    UNIQUE (boat, measure_time)
+);
+
+CREATE TABLE IF NOT EXISTS position_conflicts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    position_id integer NOT NULL REFERENCES positions_data_server (id) ON DELETE CASCADE,
+    device_id text NOT NULL DEFAULT '',
+    longitude real NOT NULL,
+    latitude real NOT NULL,
+    send_time integer NOT NULL,
+    receive_time integer NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id text NOT NULL,
+    boat text NOT NULL,
+    start_time integer NOT NULL,
+    end_time integer
+);
+
+CREATE TABLE IF NOT EXISTS device_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id text NOT NULL,
+    device_class text NOT NULL DEFAULT 'default',
+    token_hash text NOT NULL UNIQUE,
+    compact_key text,
+    created_time integer NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS integer)),
+    revoked_time integer
+);
+
+CREATE TABLE IF NOT EXISTS device_telemetry (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    boat text NOT NULL,
+    device_id text NOT NULL,
+    measure_time integer NOT NULL,
+    battery_level real,
+    battery_status text,
+    accuracy real,
+    altitude real,
+    velocity real,
+    course real,
+    connectivity text,
+    receive_time integer NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS replay_positions (
+    dataset text NOT NULL,
+    boat text NOT NULL,
+    longitude real NOT NULL,
+    latitude real NOT NULL,
+    measure_time integer NOT NULL,
+    PRIMARY KEY (dataset, boat, measure_time)
+);
+` + sqliteUnassignedPositionsSchema
+
+// sqliteUnassignedPositionsSchema was added in version 3.
+const sqliteUnassignedPositionsSchema = `
+CREATE TABLE IF NOT EXISTS unassigned_positions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id text NOT NULL,
+    longitude real NOT NULL,
+    latitude real NOT NULL,
+    measure_time integer NOT NULL,
+    accuracy real,
+    send_time integer NOT NULL,
+    receive_time integer NOT NULL,
+    UNIQUE (device_id, measure_time)
+);
+`
+
+// sqliteClient stores the data in a SQLite file, for small deployments
+// without a Postgres server, e.g. on a laptop on shore. Writes are
+// serialized by SQLite, so position IDs become visible in ascending order as
+// with the advisory lock of Postgres.
+type sqliteClient struct {
+	Database       *sql.DB
+	defaultTimeout time.Duration
+}
+
+// newSQLiteClient opens the SQLite file at path and creates the tables if
+// the file is new or upgrades them from an older schema version.
+func newSQLiteClient(ctx context.Context, path string) (*sqliteClient, error) {
+	// transactions take the write lock on begin, so concurrent inserts wait
+	// for each other instead of failing on upgrading a read lock
+	dsn := "file:" + path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database %s: %w", path, err)
+	}
+	c := &sqliteClient{
+		Database:       db,
+		defaultTimeout: time.Minute,
+	}
+
+	if err = c.createSchema(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *sqliteClient) createSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var version int
+	if err = tx.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&version); err != nil {
+		return fmt.Errorf("query schema version: %w", err)
+	}
+	switch {
+	case version == sqliteSchemaVersion:
+		return nil
+	case version == 0:
+		if _, err = tx.ExecContext(ctx, sqliteSchema); err != nil {
+			return fmt.Errorf("create tables: %w", err)
+		}
+	case version < sqliteSchemaVersion:
+		if err = upgradeSQLiteSchema(ctx, tx, version); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("sqlite schema version is %d, want %d", version, sqliteSchemaVersion)
+	}
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d;`, sqliteSchemaVersion)); err != nil {
+		return fmt.Errorf("set schema version: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// upgradeSQLiteSchema upgrades the tables of an older schema version one
+// version after the other.
+func upgradeSQLiteSchema(ctx context.Context, tx *sql.Tx, version int) error {
+	if version < 2 {
+		// version 1 signed compact packets with the token hash
+		if _, err := tx.ExecContext(ctx, `ALTER TABLE device_credentials ADD COLUMN compact_key text;`); err != nil {
+			return fmt.Errorf("add compact keys: %w", err)
+		}
+	}
+	if version < 3 {
+		if _, err := tx.ExecContext(ctx, sqliteUnassignedPositionsSchema); err != nil {
+			return fmt.Errorf("create unassigned positions: %w", err)
+		}
+	}
+	return nil
+}
+
+// sqliteTime returns a time as stored in SQLite.
+func sqliteTime(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// sqliteNullTime returns an optional time as stored in SQLite.
+func sqliteNullTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: sqliteTime(*t), Valid: true}
+}
+
+// fromSQLiteTime returns a time stored in SQLite.
+func fromSQLiteTime(micros int64) time.Time {
+	return time.UnixMicro(micros).UTC()
+}
+
+func fromSQLiteNullTime(micros sql.NullInt64) *time.Time {
+	if !micros.Valid {
+		return nil
+	}
+	t := fromSQLiteTime(micros.Int64)
+	return &t
+}
+
+// Ping checks that the database file can be read.
+func (c *sqliteClient) Ping(ctx context.Context) error {
+	defer observeQuery("Ping")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	if err := c.Database.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", err)
+	}
+	return nil
+}
+
+// CheckSchema returns an error if the tables were created by another version.
+func (c *sqliteClient) CheckSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var version int
+	if err := c.Database.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&version); err != nil {
+		return fmt.Errorf("query schema version: %w", err)
+	}
+	if version != sqliteSchemaVersion {
+		return fmt.Errorf("sqlite schema version is %d, want %d", version, sqliteSchemaVersion)
+	}
+	return nil
+}
+
+func (c *sqliteClient) Close() error {
+	return c.Database.Close()
+}
+
+// sqliteValuesPlaceholders returns the placeholders of a multi-row VALUES
+// list, e.g. "(?, ?), (?, ?)" for two rows with two columns. The driver looks
+// up numbered placeholders by formatting the ordinal of every argument, which
+// takes seconds for a chunk of maxRowsPerInsert positions.
+func sqliteValuesPlaceholders(rows, columns int) string {
+	row := "(" + strings.Repeat("?, ", columns-1) + "?)"
+	return strings.Repeat(row+", ", rows-1) + row
+}
+
+// InsertPositions inserts positions and skips the ones that are already
+// stored for the boat at the same measure time. Duplicates with different
+// coordinates are recorded as conflicts. Either all positions are processed
+// or none.
+func (c *sqliteClient) InsertPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	defer observeQuery("InsertPositions")()
+
+	if pmr == nil {
+		return InsertResult{}, errors.New("position is set to nil")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return InsertResult{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	receiveTime := sqliteTime(time.Now())
+	inserted := map[positionKey]bool{}
+	for start := 0; start < len(pmr.Positions); start += maxRowsPerInsert {
+		chunk := pmr.Positions[start:min(start+maxRowsPerInsert, len(pmr.Positions))]
+
+		query := fmt.Sprintf(`
+       INSERT INTO positions_data_server(boat, device_id, longitude, latitude, measure_time, send_time, reject_reason, receive_time)
+       VALUES %s
+       ON CONFLICT (boat, measure_time) DO NOTHING
+       RETURNING boat, measure_time;
+       `, sqliteValuesPlaceholders(len(chunk), 8))
+
+		args := make([]any, 0, 8*len(chunk))
+		for i := range chunk {
+			var rejectReason *string
+			if chunk[i].RejectReason != "" {
+				rejectReason = &chunk[i].RejectReason
+			}
+			args = append(args, chunk[i].Boat, chunk[i].DeviceID, chunk[i].Longitude, chunk[i].Latitude,
+				sqliteTime(chunk[i].MeasureTime), sqliteTime(pmr.SendTime), rejectReason, receiveTime)
+		}
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return InsertResult{}, fmt.Errorf("insert positions: %w", err)
+		}
+		for rows.Next() {
+			var boat string
+			var measureTime int64
+			if err = rows.Scan(&boat, &measureTime); err != nil {
+				_ = rows.Close()
+				return InsertResult{}, fmt.Errorf("parse row: %w", err)
+			}
+			inserted[positionKey{boat: boat, measureTime: measureTime}] = true
+		}
+		if err = rows.Err(); err != nil {
+			return InsertResult{}, fmt.Errorf("insert positions: %w", err)
+		}
+	}
+
+	result, duplicates := markDuplicates(pmr, inserted)
+
+	for _, duplicate := range duplicates {
+		var id int64
+		var longitude, latitude float64
+		err = tx.QueryRowContext(ctx,
+			`SELECT id, longitude, latitude FROM positions_data_server WHERE boat = $1 AND measure_time = $2;`,
+			duplicate.Boat, sqliteTime(duplicate.MeasureTime),
+		).Scan(&id, &longitude, &latitude)
+		if err != nil {
+			return InsertResult{}, fmt.Errorf("query existing position of boat %q at %s: %w", duplicate.Boat, duplicate.MeasureTime, err)
+		}
+		if longitude == duplicate.Longitude && latitude == duplicate.Latitude {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO position_conflicts(position_id, device_id, longitude, latitude, send_time, receive_time) VALUES ($1, $2, $3, $4, $5, $6);`,
+			id, duplicate.DeviceID, duplicate.Longitude, duplicate.Latitude, sqliteTime(pmr.SendTime), receiveTime,
+		)
+		if err != nil {
+			return InsertResult{}, fmt.Errorf("insert position conflict: %w", err)
+		}
+		result.Conflicts++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return InsertResult{}, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+func (c *sqliteClient) GetPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]PositionAtTime, error) {
+	defer observeQuery("GetPositions")()
+
+	var positions []PositionAtTime
+	err := c.forEachPosition(ctx, boat, start, end, func(position PositionAtTime) error {
+		positions = append(positions, position)
+		return nil
+	})
+	return positions, err
+}
+
+// ForEachPosition calls fn for every position of a boat in the time range
+// ordered by measure time.
+func (c *sqliteClient) ForEachPosition(ctx context.Context, boat string, start time.Time, end time.Time, fn func(position PositionAtTime) error) error {
+	defer observeQuery("ForEachPosition")()
+
+	return c.forEachPosition(ctx, boat, start, end, fn)
+}
+
+func (c *sqliteClient) forEachPosition(ctx context.Context, boat string, start time.Time, end time.Time, fn func(position PositionAtTime) error) error {
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, send_time, receive_time
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       AND reject_reason IS NULL
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, sqliteTime(start), sqliteTime(end))
+	if err != nil {
+		return fmt.Errorf("query position: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var position PositionAtTime
+		var measureTime, sendTime, receiveTime int64
+		err = rows.Scan(&position.DeviceID, &position.Longitude, &position.Latitude, &measureTime, &sendTime, &receiveTime)
+		if err != nil {
+			return fmt.Errorf("parse row: %w", err)
+		}
+		position.MeasureTime = fromSQLiteTime(measureTime)
+		position.SendTime = fromSQLiteTime(sendTime)
+		position.ReceiveTime = fromSQLiteTime(receiveTime)
+		if err = fn(position); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetPositionPage returns up to limit positions with an ID greater than the
+// cursor in ascending order of their IDs. All boats are returned if the boat
+// is empty.
+func (c *sqliteClient) GetPositionPage(ctx context.Context, cursor int64, limit int, boat string) ([]BoatPosition, error) {
+	defer observeQuery("GetPositionPage")()
+
+	query := `
+       SELECT id, boat, device_id, longitude, latitude, measure_time, send_time, receive_time
+       FROM positions_data_server
+       WHERE id > $1
+       AND ($2 = '' OR boat = $2)
+       AND reject_reason IS NULL
+       ORDER BY id ASC
+       LIMIT $3;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, cursor, boat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query position page: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var positions []BoatPosition
+	for rows.Next() {
+		var position BoatPosition
+		var measureTime, sendTime, receiveTime int64
+		err = rows.Scan(&position.ID, &position.Boat, &position.DeviceID, &position.Longitude, &position.Latitude,
+			&measureTime, &sendTime, &receiveTime)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		position.MeasureTime = fromSQLiteTime(measureTime)
+		position.SendTime = fromSQLiteTime(sendTime)
+		position.ReceiveTime = fromSQLiteTime(receiveTime)
+		positions = append(positions, position)
+	}
+
+	return positions, rows.Err()
+}
+
+// GetPreviousPosition returns the last accepted position of a boat measured
+// before the given time, or nil if there is none.
+func (c *sqliteClient) GetPreviousPosition(ctx context.Context, boat string, before time.Time) (*Position, error) {
+	defer observeQuery("GetPreviousPosition")()
+
+	query := `
+       SELECT boat, device_id, longitude, latitude, measure_time
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time < $2
+       AND reject_reason IS NULL
+       ORDER BY measure_time DESC
+       LIMIT 1;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var position Position
+	var measureTime int64
+	err := c.Database.QueryRowContext(ctx, query, boat, sqliteTime(before)).Scan(
+		&position.Boat,
+		&position.DeviceID,
+		&position.Longitude,
+		&position.Latitude,
+		&measureTime,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query previous position: %w", err)
+	}
+	position.MeasureTime = fromSQLiteTime(measureTime)
+
+	return &position, nil
+}
+
+// GetRejectedPositions returns the positions of a boat in the time range that
+// failed the validation.
+func (c *sqliteClient) GetRejectedPositions(ctx context.Context, boat string, start time.Time, end time.Time) ([]RejectedPosition, error) {
+	defer observeQuery("GetRejectedPositions")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, send_time, receive_time, reject_reason
+       FROM positions_data_server
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       AND reject_reason IS NOT NULL
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, sqliteTime(start), sqliteTime(end))
+	if err != nil {
+		return nil, fmt.Errorf("query rejected positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var positions []RejectedPosition
+	for rows.Next() {
+		var position RejectedPosition
+		var measureTime, sendTime, receiveTime int64
+		err = rows.Scan(&position.DeviceID, &position.Longitude, &position.Latitude,
+			&measureTime, &sendTime, &receiveTime, &position.RejectReason)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		position.MeasureTime = fromSQLiteTime(measureTime)
+		position.SendTime = fromSQLiteTime(sendTime)
+		position.ReceiveTime = fromSQLiteTime(receiveTime)
+		positions = append(positions, position)
+	}
+
+	return positions, rows.Err()
+}
+
+// InsertTelemetry inserts telemetry of the devices of a boat. Either all of
+// it is inserted or none.
+func (c *sqliteClient) InsertTelemetry(ctx context.Context, boat string, telemetry []Telemetry) error {
+	defer observeQuery("InsertTelemetry")()
+
+	query := `
+       INSERT INTO device_telemetry(boat, device_id, measure_time, battery_level, battery_status, accuracy, altitude, velocity, course, connectivity, receive_time)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	receiveTime := sqliteTime(time.Now())
+	for i := range telemetry {
+		_, err := tx.ExecContext(ctx, query,
+			boat,
+			telemetry[i].DeviceID,
+			sqliteTime(telemetry[i].MeasureTime),
+			telemetry[i].BatteryLevel,
+			telemetry[i].BatteryStatus,
+			telemetry[i].Accuracy,
+			telemetry[i].Altitude,
+			telemetry[i].Velocity,
+			telemetry[i].Course,
+			telemetry[i].Connectivity,
+			receiveTime,
+		)
+		if err != nil {
+			return fmt.Errorf("insert telemetry: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTelemetry returns the telemetry of all devices of a boat in the given
+// time range in ascending order.
+func (c *sqliteClient) GetTelemetry(ctx context.Context, boat string, start time.Time, end time.Time) ([]Telemetry, error) {
+	defer observeQuery("GetTelemetry")()
+
+	query := `
+       SELECT device_id, measure_time, battery_level, battery_status, accuracy, altitude, velocity, course, connectivity
+       FROM device_telemetry
+       WHERE boat = $1
+       AND measure_time > $2
+       AND measure_time <= $3
+       ORDER BY measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, boat, sqliteTime(start), sqliteTime(end))
+	if err != nil {
+		return nil, fmt.Errorf("query telemetry: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var telemetry []Telemetry
+	for rows.Next() {
+		var t Telemetry
+		var measureTime int64
+		err = rows.Scan(&t.DeviceID, &measureTime, &t.BatteryLevel, &t.BatteryStatus, &t.Accuracy,
+			&t.Altitude, &t.Velocity, &t.Course, &t.Connectivity)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		t.MeasureTime = fromSQLiteTime(measureTime)
+		telemetry = append(telemetry, t)
+	}
+
+	return telemetry, rows.Err()
+}
+
+// GetBoatOfDevice returns the boat the first of the given devices that has an
+// assignment at the given time is assigned to, together with the ID of that
+// device. The boat is empty if none of the devices is assigned.
+func (c *sqliteClient) GetBoatOfDevice(ctx context.Context, deviceIDs []string, at time.Time) (string, string, error) {
+	defer observeQuery("GetBoatOfDevice")()
+
+	query := `
+       SELECT boat
+       FROM devices
+       WHERE device_id = $1
+       AND start_time <= $2
+       AND (end_time > $2 OR end_time IS NULL)
+       LIMIT 1;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	// SQLite has no arrays, the devices are few
+	for _, deviceID := range deviceIDs {
+		var boat string
+		err := c.Database.QueryRowContext(ctx, query, deviceID, sqliteTime(at)).Scan(&boat)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("scan device: %w", err)
+		}
+		return boat, deviceID, nil
+	}
+
+	return "", "", nil
+}
+
+// AssignDevice assigns a device to a boat. An open-ended assignment of the
+// device that started earlier is ended at the start of the new one. Any other
+// overlap with an existing assignment is an error.
+func (c *sqliteClient) AssignDevice(ctx context.Context, assignment *DeviceAssignment) error {
+	defer observeQuery("AssignDevice")()
+
+	if assignment == nil {
+		return errors.New("assignment is set to nil")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tx, err := c.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	startTime := sqliteTime(assignment.StartTime)
+	endTime := sqliteNullTime(assignment.EndTime)
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE devices SET end_time = $2 WHERE device_id = $1 AND end_time IS NULL AND start_time < $2;`,
+		assignment.DeviceID, startTime,
+	)
+	if err != nil {
+		return fmt.Errorf("end open assignment: %w", err)
+	}
+
+	var overlapping int
+	err = tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM devices
+        WHERE device_id = $1
+        AND (end_time > $2 OR end_time IS NULL)
+        AND ($3 IS NULL OR start_time < $3);`,
+		assignment.DeviceID, startTime, endTime,
+	).Scan(&overlapping)
+	if err != nil {
+		return fmt.Errorf("count overlapping assignments: %w", err)
+	}
+	if overlapping > 0 {
+		return fmt.Errorf("device %q is already assigned in this time range", assignment.DeviceID)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO devices(device_id, boat, start_time, end_time) VALUES ($1, $2, $3, $4);`,
+		assignment.DeviceID, assignment.Boat, startTime, endTime,
+	)
+	if err != nil {
+		return fmt.Errorf("insert assignment: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetDeviceAssignments returns all device assignments of a boat ordered by
+// start time. All assignments are returned if the boat is empty.
+func (c *sqliteClient) GetDeviceAssignments(ctx context.Context, boat string) ([]DeviceAssignment, error) {
+	defer observeQuery("GetDeviceAssignments")()
+
+	return c.queryAssignments(ctx, `
+       SELECT device_id, boat, start_time, end_time
+       FROM devices
+       WHERE $1 = '' OR boat = $1
+       ORDER BY start_time ASC;
+       `, boat)
+}
+
+// GetAssignmentsOfDevice returns all boat assignments of a device ordered by
+// start time.
+func (c *sqliteClient) GetAssignmentsOfDevice(ctx context.Context, deviceID string) ([]DeviceAssignment, error) {
+	defer observeQuery("GetAssignmentsOfDevice")()
+
+	return c.queryAssignments(ctx, `
+       SELECT device_id, boat, start_time, end_time
+       FROM devices
+       WHERE device_id = $1
+       ORDER BY start_time ASC;
+       `, deviceID)
+}
+
+func (c *sqliteClient) queryAssignments(ctx context.Context, query string, args ...any) ([]DeviceAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query devices: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var assignments []DeviceAssignment
+	for rows.Next() {
+		var assignment DeviceAssignment
+		var startTime int64
+		var endTime sql.NullInt64
+		if err = rows.Scan(&assignment.DeviceID, &assignment.Boat, &startTime, &endTime); err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		assignment.StartTime = fromSQLiteTime(startTime)
+		assignment.EndTime = fromSQLiteNullTime(endTime)
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, rows.Err()
+}
+
+// GetDeviceOfToken returns the ID and class of the device a token with the
+// given hash was issued to. The device ID is empty if there is no such token
+// or if it was revoked.
+func (c *sqliteClient) GetDeviceOfToken(ctx context.Context, tokenHash string) (string, string, error) {
+	defer observeQuery("GetDeviceOfToken")()
+
+	query := `SELECT device_id, device_class FROM device_credentials WHERE token_hash = $1 AND revoked_time IS NULL;`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	var deviceID, deviceClass string
+	err := c.Database.QueryRowContext(ctx, query, tokenHash).Scan(&deviceID, &deviceClass)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("scan device: %w", err)
+	}
+
+	return deviceID, deviceClass, nil
+}
+
+// GetCompactKeysOfDevice returns the hex encoded keys the compact packets of a
+// device can be signed with, see compact.Key, one per token that is not
+// revoked. Tokens issued before compact keys were stored have none.
+func (c *sqliteClient) GetCompactKeysOfDevice(ctx context.Context, deviceID string) ([]string, error) {
+	defer observeQuery("GetCompactKeysOfDevice")()
+
+	query := `SELECT compact_key FROM device_credentials WHERE device_id = $1 AND revoked_time IS NULL AND compact_key IS NOT NULL;`
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("query compact keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var compactKeys []string
+	for rows.Next() {
+		var compactKey string
+		if err = rows.Scan(&compactKey); err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		compactKeys = append(compactKeys, compactKey)
+	}
+
+	return compactKeys, rows.Err()
+}
+
+// GetReplayPositions returns the recorded positions of a replay dataset
+// ordered by measure time.
+func (c *sqliteClient) GetReplayPositions(ctx context.Context, dataset string) ([]Position, error) {
+	defer observeQuery("GetReplayPositions")()
+
+	query := `
+       SELECT boat, longitude, latitude, measure_time
+       FROM replay_positions
+       WHERE dataset = $1
+       ORDER BY measure_time ASC, boat ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, dataset)
+	if err != nil {
+		return nil, fmt.Errorf("query replay positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var positions []Position
+	for rows.Next() {
+		var position Position
+		var measureTime int64
+		if err = rows.Scan(&position.Boat, &position.Longitude, &position.Latitude, &measureTime); err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		position.MeasureTime = fromSQLiteTime(measureTime)
+		positions = append(positions, position)
+	}
+
+	return positions, rows.Err()
+}
+
+// InsertUnassignedPositions keeps positions of devices that are not assigned
+// to a boat, the boat of the positions is ignored. Positions that are already
+// kept for the device at the same measure time are duplicates.
+func (c *sqliteClient) InsertUnassignedPositions(ctx context.Context, pmr *PushMessageRequest) (InsertResult, error) {
+	defer observeQuery("InsertUnassignedPositions")()
+
+	if pmr == nil {
+		return InsertResult{}, errors.New("position is set to nil")
+	}
+
+	query := `
+       INSERT INTO unassigned_positions(device_id, longitude, latitude, measure_time, accuracy, send_time, receive_time)
+       VALUES ($1, $2, $3, $4, $5, $6, $7)
+       ON CONFLICT (device_id, measure_time) DO NOTHING;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	receiveTime := sqliteTime(time.Now())
+	var result InsertResult
+	for i := range pmr.Positions {
+		res, err := c.Database.ExecContext(ctx, query,
+			pmr.Positions[i].DeviceID, pmr.Positions[i].Longitude, pmr.Positions[i].Latitude,
+			sqliteTime(pmr.Positions[i].MeasureTime), pmr.Positions[i].Accuracy, sqliteTime(pmr.SendTime), receiveTime,
+		)
+		if err != nil {
+			return result, fmt.Errorf("insert unassigned position: %w", err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return result, fmt.Errorf("count inserted rows: %w", err)
+		}
+		if inserted > 0 {
+			result.Inserted++
+		} else {
+			result.Duplicates++
+		}
+	}
+
+	return result, nil
+}
+
+// GetUnassignedPositions returns the kept positions of a device measured from
+// start until end, or without end if it is nil, as the pushes they were sent
+// with in ascending order of their send time. The boat of the positions is
+// empty.
+func (c *sqliteClient) GetUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) ([]PushMessageRequest, error) {
+	defer observeQuery("GetUnassignedPositions")()
+
+	query := `
+       SELECT device_id, longitude, latitude, measure_time, accuracy, send_time
+       FROM unassigned_positions
+       WHERE device_id = $1 AND measure_time >= $2 AND ($3 IS NULL OR measure_time < $3)
+       ORDER BY send_time ASC, measure_time ASC;
+       `
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	rows, err := c.Database.QueryContext(ctx, query, deviceID, sqliteTime(start), sqliteNullTime(end))
+	if err != nil {
+		return nil, fmt.Errorf("query unassigned positions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var pushes []PushMessageRequest
+	for rows.Next() {
+		var position Position
+		var measureTime, sendTime int64
+		err = rows.Scan(&position.DeviceID, &position.Longitude, &position.Latitude, &measureTime, &position.Accuracy, &sendTime)
+		if err != nil {
+			return nil, fmt.Errorf("parse row: %w", err)
+		}
+		position.MeasureTime = fromSQLiteTime(measureTime)
+		pushes = appendUnassignedPosition(pushes, position, fromSQLiteTime(sendTime))
+	}
+
+	return pushes, rows.Err()
+}
+
+// DeleteUnassignedPositions deletes the kept positions of a device measured
+// from start until end, or without end if it is nil.
+func (c *sqliteClient) DeleteUnassignedPositions(ctx context.Context, deviceID string, start time.Time, end *time.Time) error {
+	defer observeQuery("DeleteUnassignedPositions")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.Database.ExecContext(ctx,
+		`DELETE FROM unassigned_positions WHERE device_id = $1 AND measure_time >= $2 AND ($3 IS NULL OR measure_time < $3);`,
+		deviceID, sqliteTime(start), sqliteNullTime(end),
+	)
+	if err != nil {
+		return fmt.Errorf("delete unassigned positions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDatabaseClient connects to the database given by the DSN in
+// TEST_DATABASE_DSN, e.g. "host=localhost port=5432 user=regatta
+// password=1234 dbname=regatta_test", and skips if it is not set. The schema
+// is migrated to the latest version.
+func newTestDatabaseClient(tb testing.TB) *databaseClient {
+	tb.Helper()
+
+	dsn, ok := os.LookupEnv("TEST_DATABASE_DSN")
+	if !ok {
+		tb.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = db.Close() })
+
+	c := &databaseClient{
+		Database:       db,
+		defaultTimeout: time.Minute,
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err = c.Migrate(context.Background(), migrations, len(migrations)); err != nil {
+		tb.Fatal(err)
+	}
+
+	return c
+}
+
+func TestValuesPlaceholders(t *testing.T) {
+	tests := []struct {
+		rows       int
+		columns    int
+		want       string
+		wantSQLite string
+	}{
+		{rows: 1, columns: 1, want: "($1)", wantSQLite: "(?)"},
+		{rows: 1, columns: 3, want: "($1, $2, $3)", wantSQLite: "(?, ?, ?)"},
+		{rows: 2, columns: 2, want: "($1, $2), ($3, $4)", wantSQLite: "(?, ?), (?, ?)"},
+		{rows: 3, columns: 1, want: "($1), ($2), ($3)", wantSQLite: "(?), (?), (?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d", tt.rows, tt.columns), func(t *testing.T) {
+			if got := valuesPlaceholders(tt.rows, tt.columns); got != tt.want {
+				t.Errorf("valuesPlaceholders(%d, %d) = %q, want %q", tt.rows, tt.columns, got, tt.want)
+			}
+			if got := sqliteValuesPlaceholders(tt.rows, tt.columns); got != tt.wantSQLite {
+				t.Errorf("sqliteValuesPlaceholders(%d, %d) = %q, want %q", tt.rows, tt.columns, got, tt.wantSQLite)
+			}
+		})
+	}
+}
+
+// benchmarkPositions returns a push of n positions of the benchmark boat,
+// one per second starting at start.
+func benchmarkPositions(n int, start time.Time) *PushMessageRequest {
+	positions := make([]Position, n)
+	for i := range positions {
+		positions[i] = Position{
+			Boat:        "benchmark",
+			DeviceID:    "benchmark/phone",
+			Longitude:   10.0091 + float64(i)*1e-6,
+			Latitude:    53.5655 + float64(i)*1e-6,
+			MeasureTime: start.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return &PushMessageRequest{Positions: positions, SendTime: start}
+}
+
+func deleteBenchmarkPositions(tb testing.TB, c *databaseClient) {
+	_, err := c.Database.ExecContext(context.Background(), `DELETE FROM "positions_data_server" WHERE boat = 'benchmark';`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// BenchmarkInsertPositions measures pushes of 10000 positions on every
+// storage. The Postgres storage is skipped without TEST_DATABASE_DSN.
+func BenchmarkInsertPositions(b *testing.B) {
+	backends := []struct {
+		name string
+		open func(b *testing.B) storageInterface
+	}{
+		{
+			name: storageMemory,
+			open: func(b *testing.B) storageInterface { return newMemoryStorage() },
+		},
+		{
+			name: storageSQLite,
+			open: func(b *testing.B) storageInterface {
+				c, err := newSQLiteClient(context.Background(), filepath.Join(b.TempDir(), "regatta.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.Cleanup(func() { _ = c.Close() })
+				return c
+			},
+		},
+		{
+			name: storagePostgres,
+			open: func(b *testing.B) storageInterface {
+				c := newTestDatabaseClient(b)
+				deleteBenchmarkPositions(b, c)
+				b.Cleanup(func() { deleteBenchmarkPositions(b, c) })
+				return c
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			benchmarkInsertPositions(b, backend.open(b))
+		})
+	}
+}
+
+func benchmarkInsertPositions(b *testing.B, s storageInterface) {
+	const positionsPerPush = 10000
+
+	ctx := context.Background()
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// every run of the benchmark pushes new positions after the ones of the
+	// previous runs
+	pushed := 0
+	b.Run("new", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			push := benchmarkPositions(positionsPerPush, start.Add(time.Duration(pushed)*time.Second))
+			pushed += positionsPerPush
+			b.StartTimer()
+
+			result, err := s.InsertPositions(ctx, push)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if result.Inserted != positionsPerPush {
+				b.Fatalf("inserted %d positions, want %d", result.Inserted, positionsPerPush)
+			}
+		}
+		b.ReportMetric(float64(b.N*positionsPerPush)/b.Elapsed().Seconds(), "positions/s")
+	})
+
+	b.Run("duplicates", func(b *testing.B) {
+		push := benchmarkPositions(positionsPerPush, start)
+
+		for i := 0; i < b.N; i++ {
+			result, err := s.InsertPositions(ctx, push)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if result.Inserted+result.Duplicates != positionsPerPush {
+				b.Fatalf("processed %d positions, want %d", result.Inserted+result.Duplicates, positionsPerPush)
+			}
+		}
+		b.ReportMetric(float64(b.N*positionsPerPush)/b.Elapsed().Seconds(), "positions/s")
+	})
+}
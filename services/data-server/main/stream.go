@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// streamHeartbeatInterval is the interval of comments sent on idle streams,
+// so proxies and clients do not consider the connection dead.
+const streamHeartbeatInterval = 15 * time.Second
+
+// positionNotifier wakes up everyone waiting for new positions.
+type positionNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newPositionNotifier() *positionNotifier {
+	return &positionNotifier{ch: make(chan struct{})}
+}
+
+// Wait returns a channel that is closed with the next call of Notify.
+func (n *positionNotifier) Wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+// Notify wakes up all waiters.
+func (n *positionNotifier) Notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// StreamPositions streams new positions as server-sent events. Every event
+// carries a position as JSON and its ID as event ID. The stream starts after
+// the position given by the Last-Event-ID header or the cursor query
+// parameter, so a client can resume where it stopped. The boat query
+// parameter restricts the stream to one boat.
+func (s *regattaService) StreamPositions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.LogError(ctx, errors.New("stream positions: response writer does not support flushing"))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	cursorRaw := r.Header.Get("Last-Event-ID")
+	if cursorRaw == "" {
+		cursorRaw = r.URL.Query().Get("cursor")
+	}
+	var cursor int64
+	if cursorRaw != "" {
+		var err error
+		cursor, err = strconv.ParseInt(cursorRaw, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("stream positions: parse cursor: %w", err)
+			s.LogError(ctx, err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+	boat := r.URL.Query().Get("boat")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// get the channel before reading, so no insert in between is missed
+		newPositions := s.notifier.Wait()
+
+		positions, err := s.positionStorage.GetPositionPage(ctx, cursor, maxPositionPageLimit, boat)
+		if err != nil {
+			s.LogError(ctx, fmt.Errorf("stream positions: extract from database: %w", err), "boat", boat, "cursor", cursor)
+			return
+		}
+
+		for _, position := range positions {
+			data, err := json.Marshal(position)
+			if err != nil {
+				s.LogError(ctx, fmt.Errorf("stream positions: marshal position: %w", err), "boat", boat, "cursor", cursor)
+				return
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: position\ndata: %s\n\n", position.ID, data); err != nil {
+				s.LogError(ctx, fmt.Errorf("stream positions: write to http writer: %w", err), "boat", boat, "cursor", cursor)
+				return
+			}
+			cursor = position.ID
+		}
+		flusher.Flush()
+
+		if len(positions) == maxPositionPageLimit {
+			// there are more positions to catch up with
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-newPositions:
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
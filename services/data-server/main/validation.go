@@ -0,0 +1,196 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// validationConfig configures the plausibility checks of fixes on ingest.
+// Implausible fixes are stored with a reject reason and left out of the read
+// endpoints.
+type validationConfig struct {
+	MinLatitude  float64
+	MaxLatitude  float64
+	MinLongitude float64
+	MaxLongitude float64
+	MaxAge       time.Duration // how long before it is received a fix may be measured
+	MaxFuture    time.Duration // how long after it is received a fix may be measured
+	MaxSpeed     float64       // in m/s between two fixes of a boat
+	MaxAccuracy  float64       // in meters
+}
+
+func defaultValidationConfig() validationConfig {
+	return validationConfig{
+		MinLatitude:  -90,
+		MaxLatitude:  90,
+		MinLongitude: -180,
+		MaxLongitude: 180,
+		MaxAge:       7 * 24 * time.Hour,
+		MaxFuture:    5 * time.Minute,
+		MaxSpeed:     15, // about 29 knots
+		MaxAccuracy:  100,
+	}
+}
+
+// maxSpeedCheckGap is the longest time between two fixes that are checked for
+// their speed. Over longer gaps a boat may have been moved on a trailer, and
+// all following fixes would be rejected.
+const maxSpeedCheckGap = 10 * time.Minute
+
+// rejectReason returns why a fix is implausible on its own, or "" if it is
+// not.
+func (c validationConfig) rejectReason(p *Position, receiveTime time.Time) string {
+	switch {
+	case p.Latitude == 0 && p.Longitude == 0:
+		return "zero coordinates"
+	case p.Latitude < c.MinLatitude || p.Latitude > c.MaxLatitude ||
+		p.Longitude < c.MinLongitude || p.Longitude > c.MaxLongitude:
+		return "coordinates out of bounds"
+	case receiveTime.Sub(p.MeasureTime) > c.MaxAge:
+		return "measure time too old"
+	case p.MeasureTime.Sub(receiveTime) > c.MaxFuture:
+		return "measure time in the future"
+	case p.Accuracy != nil && *p.Accuracy > c.MaxAccuracy:
+		return fmt.Sprintf("accuracy of %.0f m too low", *p.Accuracy)
+	}
+	return ""
+}
+
+// speedRejectReason returns why a fix is implausible after the previous fix
+// of the boat, or "" if it is not.
+func (c validationConfig) speedRejectReason(previous, p *Position) string {
+	elapsed := p.MeasureTime.Sub(previous.MeasureTime).Abs()
+	if elapsed == 0 || elapsed > maxSpeedCheckGap {
+		return ""
+	}
+
+	speed := distance(previous.Latitude, previous.Longitude, p.Latitude, p.Longitude) / elapsed.Seconds()
+	if speed > c.MaxSpeed {
+		return fmt.Sprintf("speed of %.0f m/s since the previous fix", speed)
+	}
+	return ""
+}
+
+// speedReanchorFixes is the number of consecutive fixes that are rejected for
+// their speed after which the boat is assumed to really be where they are.
+// Otherwise a single implausible fix that passed the checks would make all
+// following fixes look implausible.
+const speedReanchorFixes = 3
+
+// isSpeedReject reports whether a reject reason is one of speedRejectReason.
+func isSpeedReject(reason string) bool {
+	return strings.HasPrefix(reason, "speed of ")
+}
+
+// speedTrack is what the speed check of a boat compares a fix with.
+type speedTrack struct {
+	anchor   *Position  // the last accepted fix, nil if there is none
+	rejected []Position // the fixes rejected for their speed since the anchor
+	loaded   bool       // whether rejected contains the stored fixes
+}
+
+// reanchors reports whether p together with the last fixes that were rejected
+// for their speed forms a plausible track of speedReanchorFixes fixes.
+func (c validationConfig) reanchors(rejected []Position, p *Position) bool {
+	if len(rejected) < speedReanchorFixes-1 {
+		return false
+	}
+	track := append(slices.Clone(rejected[len(rejected)-(speedReanchorFixes-1):]), *p)
+	for i := 1; i < len(track); i++ {
+		if c.speedRejectReason(&track[i-1], &track[i]) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePositions sets the reject reason of implausible positions. The
+// speed is checked against the previous accepted position of the boat in the
+// request or, for the first one, in the database. A fix that is too fast is
+// accepted anyway if it continues the track of the fixes that were rejected
+// before it, see speedReanchorFixes.
+func (s *regattaService) validatePositions(ctx context.Context, pmr *PushMessageRequest, receiveTime time.Time) error {
+	// check the positions of a boat in the order they were measured
+	order := make([]int, len(pmr.Positions))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Or(
+			cmp.Compare(pmr.Positions[a].Boat, pmr.Positions[b].Boat),
+			pmr.Positions[a].MeasureTime.Compare(pmr.Positions[b].MeasureTime),
+		)
+	})
+
+	tracks := map[string]*speedTrack{}
+	for _, i := range order {
+		p := &pmr.Positions[i]
+
+		p.RejectReason = s.validation.rejectReason(p, receiveTime)
+		if p.RejectReason != "" {
+			continue
+		}
+
+		track, ok := tracks[p.Boat]
+		if !ok {
+			stored, err := s.storageClient.GetPreviousPosition(ctx, p.Boat, p.MeasureTime)
+			if err != nil {
+				return fmt.Errorf("get previous position: %w", err)
+			}
+			track = &speedTrack{anchor: stored}
+			tracks[p.Boat] = track
+		}
+
+		if track.anchor != nil {
+			p.RejectReason = s.validation.speedRejectReason(track.anchor, p)
+		}
+		if p.RejectReason != "" && !track.loaded {
+			stored, err := s.storageClient.GetRejectedPositions(ctx, p.Boat, track.anchor.MeasureTime, p.MeasureTime)
+			if err != nil {
+				return fmt.Errorf("get rejected positions: %w", err)
+			}
+			for _, r := range stored {
+				if isSpeedReject(r.RejectReason) {
+					track.rejected = append(track.rejected, Position{
+						Boat:        p.Boat,
+						DeviceID:    r.DeviceID,
+						Longitude:   r.Longitude,
+						Latitude:    r.Latitude,
+						MeasureTime: r.MeasureTime,
+					})
+				}
+			}
+			track.loaded = true
+		}
+		if p.RejectReason != "" && !s.validation.reanchors(track.rejected, p) {
+			track.rejected = append(track.rejected, *p)
+			continue
+		}
+
+		p.RejectReason = ""
+		*track = speedTrack{anchor: p, loaded: true}
+	}
+
+	return nil
+}
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371000
+
+// distance returns the great-circle distance between two coordinates in
+// meters.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaPhi := (lat2 - lat1) * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRejectReason(t *testing.T) {
+	receiveTime := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	accuracy := func(meters float64) *float64 { return &meters }
+
+	config := defaultValidationConfig()
+	config.MinLatitude, config.MinLongitude = 53, 9
+	config.MaxLatitude, config.MaxLongitude = 54, 11
+
+	tests := []struct {
+		name     string
+		position Position
+		want     string
+	}{
+		{
+			name:     "valid",
+			position: Position{Latitude: 53.5655, Longitude: 10.0091, MeasureTime: receiveTime.Add(-time.Second), Accuracy: accuracy(5)},
+		},
+		{
+			name:     "zero coordinates",
+			position: Position{MeasureTime: receiveTime},
+			want:     "zero coordinates",
+		},
+		{
+			name:     "out of bounds",
+			position: Position{Latitude: 48.1173, Longitude: 11.5167, MeasureTime: receiveTime},
+			want:     "coordinates out of bounds",
+		},
+		{
+			name:     "from 1970",
+			position: Position{Latitude: 53.5655, Longitude: 10.0091, MeasureTime: time.Unix(0, 0)},
+			want:     "measure time too old",
+		},
+		{
+			name:     "from the future",
+			position: Position{Latitude: 53.5655, Longitude: 10.0091, MeasureTime: receiveTime.Add(time.Hour)},
+			want:     "measure time in the future",
+		},
+		{
+			name:     "inaccurate",
+			position: Position{Latitude: 53.5655, Longitude: 10.0091, MeasureTime: receiveTime, Accuracy: accuracy(250)},
+			want:     "accuracy of 250 m too low",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.rejectReason(&tt.position, receiveTime); got != tt.want {
+				t.Errorf("rejectReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedRejectReason(t *testing.T) {
+	config := defaultValidationConfig()
+	start := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	previous := &Position{Latitude: 53.5655, Longitude: 10.0091, MeasureTime: start}
+
+	// about 11 m north per second is 5.5 m/s after two seconds
+	sailing := &Position{Latitude: 53.5656, Longitude: 10.0091, MeasureTime: start.Add(2 * time.Second)}
+	if got := config.speedRejectReason(previous, sailing); got != "" {
+		t.Errorf("speedRejectReason() = %q for a sailing boat", got)
+	}
+
+	// a jump of about 2 km within a second
+	jump := &Position{Latitude: 53.5835, Longitude: 10.0091, MeasureTime: start.Add(time.Second)}
+	if got := config.speedRejectReason(previous, jump); got != "speed of 2002 m/s since the previous fix" {
+		t.Errorf("speedRejectReason() = %q for a jump", got)
+	}
+
+	// after a long gap the boat may have been moved
+	jump.MeasureTime = start.Add(time.Hour)
+	if got := config.speedRejectReason(previous, jump); got != "" {
+		t.Errorf("speedRejectReason() = %q after a long gap", got)
+	}
+}
+
+func TestValidatePositionsReanchor(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemoryStorage()
+	s := newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+	receiveTime := time.Now().Truncate(time.Second)
+
+	// after a long gap an outlier about 2 km north passes the checks, then
+	// the boat sails on where it was before
+	fixes := []struct {
+		latitude float64
+		measured time.Duration
+		rejected bool
+	}{
+		{latitude: 53.5655, measured: -time.Hour},
+		{latitude: 53.5835, measured: -10 * time.Second},
+		{latitude: 53.5655, measured: -9 * time.Second, rejected: true},
+		{latitude: 53.5656, measured: -8 * time.Second, rejected: true},
+		{latitude: 53.5657, measured: -7 * time.Second},
+		{latitude: 53.5658, measured: -6 * time.Second},
+	}
+	for i, fix := range fixes {
+		pmr := &PushMessageRequest{
+			SendTime:  receiveTime,
+			Positions: []Position{{Boat: "Bluebird", Latitude: fix.latitude, Longitude: 10.0091, MeasureTime: receiveTime.Add(fix.measured)}},
+		}
+		if err := s.validatePositions(ctx, pmr, receiveTime); err != nil {
+			t.Fatal(err)
+		}
+		if rejected := pmr.Positions[0].RejectReason != ""; rejected != fix.rejected {
+			t.Errorf("fix %d: reject reason %q, want rejected %t", i, pmr.Positions[0].RejectReason, fix.rejected)
+		}
+		if _, err := storage.InsertPositions(ctx, pmr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the same within one request
+	storage = newMemoryStorage()
+	s = newRegattaService(storage, defaultValidationConfig(), 0, defaultLimitConfig(), "")
+	pmr := &PushMessageRequest{SendTime: receiveTime}
+	for _, fix := range fixes {
+		pmr.Positions = append(pmr.Positions, Position{Boat: "Bluebird", Latitude: fix.latitude, Longitude: 10.0091, MeasureTime: receiveTime.Add(fix.measured)})
+	}
+	if err := s.validatePositions(ctx, pmr, receiveTime); err != nil {
+		t.Fatal(err)
+	}
+	for i, fix := range fixes {
+		if rejected := pmr.Positions[i].RejectReason != ""; rejected != fix.rejected {
+			t.Errorf("fix %d in one request: reject reason %q, want rejected %t", i, pmr.Positions[i].RejectReason, fix.rejected)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// one degree of latitude is about 111.2 km
+	if got := distance(53, 10, 54, 10); math.Abs(got-111195) > 1 {
+		t.Errorf("distance() = %f, want about 111195", got)
+	}
+}
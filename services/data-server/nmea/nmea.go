@@ -0,0 +1,306 @@
+// Package nmea parses the NMEA 0183 sentences of GPS receivers that carry a
+// position or movement: RMC, GGA and VTG of any talker, e.g. $GPRMC or
+// $GNRMC.
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrChecksum is returned for sentences without a valid checksum.
+	ErrChecksum = errors.New("nmea: invalid checksum")
+	// ErrUnsupported is returned for well-formed sentences of other types.
+	ErrUnsupported = errors.New("nmea: unsupported sentence type")
+)
+
+// knotsToKmh converts knots to km/h.
+const knotsToKmh = 1.852
+
+// Sentence is one of RMC, GGA or VTG.
+type Sentence interface {
+	sentence()
+}
+
+// RMC is the recommended minimum data of a fix.
+type RMC struct {
+	Talker     string
+	Time       time.Time // UTC
+	Valid      bool      // false if the receiver has no fix, the other fields may be zero then
+	Latitude   float64
+	Longitude  float64
+	SpeedKnots float64
+	Course     float64 // true course over ground in degrees
+}
+
+// GGA is the fix data. It only carries the time of day, see TimeOn.
+type GGA struct {
+	Talker     string
+	TimeOfDay  time.Duration // since midnight UTC
+	Latitude   float64
+	Longitude  float64
+	FixQuality int // 0 if the receiver has no fix
+	Satellites int
+	HDOP       float64
+	Altitude   float64 // in meters above mean sea level
+}
+
+// VTG is the course and speed over ground.
+type VTG struct {
+	Talker     string
+	Course     float64 // true course over ground in degrees
+	SpeedKnots float64
+	SpeedKmh   float64
+}
+
+func (RMC) sentence() {}
+func (GGA) sentence() {}
+func (VTG) sentence() {}
+
+// SpeedKmh returns the speed over ground in km/h.
+func (r RMC) SpeedKmh() float64 {
+	return r.SpeedKnots * knotsToKmh
+}
+
+// TimeOn returns the time of the fix on the day closest to t, so a fix shortly
+// before midnight is not placed on the next day.
+func (g GGA) TimeOn(t time.Time) time.Time {
+	t = t.UTC()
+	fixTime := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(g.TimeOfDay)
+	switch {
+	case fixTime.Sub(t) > 12*time.Hour:
+		fixTime = fixTime.AddDate(0, 0, -1)
+	case t.Sub(fixTime) > 12*time.Hour:
+		fixTime = fixTime.AddDate(0, 0, 1)
+	}
+	return fixTime
+}
+
+// Parse parses a single sentence like
+// "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A".
+// The checksum is required. Sentences of other types return ErrUnsupported.
+func Parse(line string) (Sentence, error) {
+	line = strings.TrimSpace(line)
+
+	fields, err := splitSentence(line)
+	if err != nil {
+		return nil, err
+	}
+
+	address := fields[0]
+	if len(address) != 5 {
+		return nil, fmt.Errorf("nmea: invalid address %q", address)
+	}
+	talker, sentenceType := address[:2], address[2:]
+
+	switch sentenceType {
+	case "RMC":
+		return parseRMC(talker, fields[1:])
+	case "GGA":
+		return parseGGA(talker, fields[1:])
+	case "VTG":
+		return parseVTG(talker, fields[1:])
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, address)
+	}
+}
+
+// splitSentence validates the checksum of a sentence and returns its fields,
+// starting with the address.
+func splitSentence(line string) ([]string, error) {
+	if !strings.HasPrefix(line, "$") {
+		return nil, fmt.Errorf("nmea: sentence does not start with '$': %q", line)
+	}
+
+	data, checksum, ok := strings.Cut(line[1:], "*")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing", ErrChecksum)
+	}
+
+	want, err := strconv.ParseUint(checksum, 16, 8)
+	if err != nil || len(checksum) != 2 {
+		return nil, fmt.Errorf("%w: %q", ErrChecksum, checksum)
+	}
+
+	var got byte
+	for i := 0; i < len(data); i++ {
+		got ^= data[i]
+	}
+	if got != byte(want) {
+		return nil, fmt.Errorf("%w: got %02X, want %02X", ErrChecksum, got, want)
+	}
+
+	return strings.Split(data, ","), nil
+}
+
+func parseRMC(talker string, fields []string) (RMC, error) {
+	// time, status, lat, N/S, lon, E/W, speed, course, date, magnetic variation, E/W[, mode]
+	if len(fields) < 11 {
+		return RMC{}, fmt.Errorf("nmea: RMC has %d fields, want at least 11", len(fields))
+	}
+
+	rmc := RMC{Talker: talker, Valid: fields[1] == "A"}
+	if !rmc.Valid {
+		return rmc, nil
+	}
+
+	timeOfDay, err := parseTimeOfDay(fields[0])
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC time: %w", err)
+	}
+	date, err := time.Parse("020106", fields[8])
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC date: %w", err)
+	}
+	rmc.Time = date.Add(timeOfDay)
+
+	rmc.Latitude, err = parseCoordinate(fields[2], fields[3], 2, "N", "S")
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC latitude: %w", err)
+	}
+	rmc.Longitude, err = parseCoordinate(fields[4], fields[5], 3, "E", "W")
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC longitude: %w", err)
+	}
+
+	rmc.SpeedKnots, err = parseOptionalFloat(fields[6])
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC speed: %w", err)
+	}
+	rmc.Course, err = parseOptionalFloat(fields[7])
+	if err != nil {
+		return RMC{}, fmt.Errorf("nmea: RMC course: %w", err)
+	}
+
+	return rmc, nil
+}
+
+func parseGGA(talker string, fields []string) (GGA, error) {
+	// time, lat, N/S, lon, E/W, quality, satellites, HDOP, altitude, M, geoid separation, M, age, station
+	if len(fields) < 14 {
+		return GGA{}, fmt.Errorf("nmea: GGA has %d fields, want at least 14", len(fields))
+	}
+
+	gga := GGA{Talker: talker}
+
+	var err error
+	gga.FixQuality, err = strconv.Atoi(fields[5])
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA fix quality: %w", err)
+	}
+	if gga.FixQuality == 0 {
+		return gga, nil
+	}
+
+	gga.TimeOfDay, err = parseTimeOfDay(fields[0])
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA time: %w", err)
+	}
+	gga.Latitude, err = parseCoordinate(fields[1], fields[2], 2, "N", "S")
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA latitude: %w", err)
+	}
+	gga.Longitude, err = parseCoordinate(fields[3], fields[4], 3, "E", "W")
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA longitude: %w", err)
+	}
+
+	if fields[6] != "" {
+		gga.Satellites, err = strconv.Atoi(fields[6])
+		if err != nil {
+			return GGA{}, fmt.Errorf("nmea: GGA satellites: %w", err)
+		}
+	}
+	gga.HDOP, err = parseOptionalFloat(fields[7])
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA HDOP: %w", err)
+	}
+	gga.Altitude, err = parseOptionalFloat(fields[8])
+	if err != nil {
+		return GGA{}, fmt.Errorf("nmea: GGA altitude: %w", err)
+	}
+
+	return gga, nil
+}
+
+func parseVTG(talker string, fields []string) (VTG, error) {
+	// true course, T, magnetic course, M, speed, N, speed, K[, mode]
+	if len(fields) < 8 {
+		return VTG{}, fmt.Errorf("nmea: VTG has %d fields, want at least 8", len(fields))
+	}
+
+	vtg := VTG{Talker: talker}
+
+	var err error
+	vtg.Course, err = parseOptionalFloat(fields[0])
+	if err != nil {
+		return VTG{}, fmt.Errorf("nmea: VTG course: %w", err)
+	}
+	vtg.SpeedKnots, err = parseOptionalFloat(fields[4])
+	if err != nil {
+		return VTG{}, fmt.Errorf("nmea: VTG speed: %w", err)
+	}
+	vtg.SpeedKmh, err = parseOptionalFloat(fields[6])
+	if err != nil {
+		return VTG{}, fmt.Errorf("nmea: VTG speed: %w", err)
+	}
+
+	return vtg, nil
+}
+
+// parseTimeOfDay parses a time like "123519" or "123519.25".
+func parseTimeOfDay(s string) (time.Duration, error) {
+	if len(s) < 6 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	hours, errHours := strconv.Atoi(s[0:2])
+	minutes, errMinutes := strconv.Atoi(s[2:4])
+	seconds, errSeconds := strconv.ParseFloat(s[4:], 64)
+	if errHours != nil || errMinutes != nil || errSeconds != nil ||
+		hours > 23 || minutes > 59 || seconds >= 61 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)).Round(time.Millisecond), nil
+}
+
+// parseCoordinate parses a coordinate like "4807.038" with the given number of
+// degree digits and its hemisphere into decimal degrees.
+func parseCoordinate(value, hemisphere string, degreeDigits int, positive, negative string) (float64, error) {
+	if len(value) < degreeDigits+2 {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+
+	degrees, err := strconv.Atoi(value[:degreeDigits])
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+	minutes, err := strconv.ParseFloat(value[degreeDigits:], 64)
+	if err != nil || minutes >= 60 {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+
+	coordinate := float64(degrees) + minutes/60
+	switch hemisphere {
+	case positive:
+		return coordinate, nil
+	case negative:
+		return -coordinate, nil
+	default:
+		return 0, fmt.Errorf("invalid hemisphere %q", hemisphere)
+	}
+}
+
+func parseOptionalFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
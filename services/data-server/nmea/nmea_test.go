@@ -0,0 +1,164 @@
+package nmea
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Sentence
+	}{
+		{
+			name: "RMC",
+			line: "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A",
+			want: RMC{
+				Talker:     "GP",
+				Time:       time.Date(1994, time.March, 23, 12, 35, 19, 0, time.UTC),
+				Valid:      true,
+				Latitude:   48.1173,
+				Longitude:  11.516667,
+				SpeedKnots: 22.4,
+				Course:     84.4,
+			},
+		},
+		{
+			name: "RMC of a multi-constellation receiver",
+			line: "$GNRMC,235959.50,A,5334.5940,N,01000.5460,E,0.5,271.3,311224,,,A*4E\r\n",
+			want: RMC{
+				Talker:     "GN",
+				Time:       time.Date(2024, time.December, 31, 23, 59, 59, 500_000_000, time.UTC),
+				Valid:      true,
+				Latitude:   53.5765667,
+				Longitude:  10.0091,
+				SpeedKnots: 0.5,
+				Course:     271.3,
+			},
+		},
+		{
+			name: "RMC without fix",
+			line: "$GPRMC,,V,,,,,,,,,,N*53",
+			want: RMC{Talker: "GP"},
+		},
+		{
+			name: "GGA",
+			line: "$GPGGA,123519,4807.038,N,01131.000,W,1,08,0.9,545.4,M,46.9,M,,*55",
+			want: GGA{
+				Talker:     "GP",
+				TimeOfDay:  12*time.Hour + 35*time.Minute + 19*time.Second,
+				Latitude:   48.1173,
+				Longitude:  -11.516667,
+				FixQuality: 1,
+				Satellites: 8,
+				HDOP:       0.9,
+				Altitude:   545.4,
+			},
+		},
+		{
+			name: "GGA without fix",
+			line: "$GPGGA,,,,,,0,00,99.99,,,,,,*48",
+			want: GGA{Talker: "GP"},
+		},
+		{
+			name: "VTG",
+			line: "$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48",
+			want: VTG{Talker: "GP", Course: 54.7, SpeedKnots: 5.5, SpeedKmh: 10.2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !equalSentences(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr error
+	}{
+		{
+			name:    "wrong checksum",
+			line:    "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6B",
+			wantErr: ErrChecksum,
+		},
+		{
+			name:    "missing checksum",
+			line:    "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W",
+			wantErr: ErrChecksum,
+		},
+		{
+			name:    "unsupported type",
+			line:    "$GPGSV,3,1,11,03,03,111,00,04,15,270,00,06,01,010,00,13,06,292,00*74",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name: "no sentence",
+			line: "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.line)
+			if err == nil {
+				t.Fatal("Parse() error = nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGGATimeOn(t *testing.T) {
+	gga := GGA{TimeOfDay: 23*time.Hour + 59*time.Minute + 59*time.Second}
+
+	// received shortly after midnight
+	received := time.Date(2025, time.June, 2, 0, 0, 1, 0, time.UTC)
+	want := time.Date(2025, time.June, 1, 23, 59, 59, 0, time.UTC)
+	if got := gga.TimeOn(received); !got.Equal(want) {
+		t.Errorf("TimeOn() = %s, want %s", got, want)
+	}
+
+	gga = GGA{TimeOfDay: time.Second}
+	received = time.Date(2025, time.June, 1, 23, 59, 59, 0, time.UTC)
+	want = time.Date(2025, time.June, 2, 0, 0, 1, 0, time.UTC)
+	if got := gga.TimeOn(received); !got.Equal(want) {
+		t.Errorf("TimeOn() = %s, want %s", got, want)
+	}
+}
+
+// equalSentences compares sentences with coordinates rounded to about 10 cm.
+func equalSentences(a, b Sentence) bool {
+	round := func(f float64) float64 { return math.Round(f * 1e6) }
+
+	switch a := a.(type) {
+	case RMC:
+		b, ok := b.(RMC)
+		a.Latitude, a.Longitude = round(a.Latitude), round(a.Longitude)
+		b.Latitude, b.Longitude = round(b.Latitude), round(b.Longitude)
+		return ok && a.Time.Equal(b.Time) && a.Talker == b.Talker && a.Valid == b.Valid &&
+			a.Latitude == b.Latitude && a.Longitude == b.Longitude &&
+			a.SpeedKnots == b.SpeedKnots && a.Course == b.Course
+	case GGA:
+		b, ok := b.(GGA)
+		a.Latitude, a.Longitude = round(a.Latitude), round(a.Longitude)
+		b.Latitude, b.Longitude = round(b.Latitude), round(b.Longitude)
+		return ok && a == b
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,54 @@
+package track
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// gpxPoint is a track point of a GPX 1.0 or 1.1 file.
+type gpxPoint struct {
+	Latitude  float64 `xml:"lat,attr"`
+	Longitude float64 `xml:"lon,attr"`
+	Time      string  `xml:"time"`
+}
+
+// ReadGPX calls fn for every track point of a GPX file in the order of the
+// file. Points without time have a zero Time. The file is decoded point by
+// point, so it can be of any size.
+func ReadGPX(r io.Reader, fn func(p Point) error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode gpx: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "trkpt" {
+			continue
+		}
+
+		var gpxPoint gpxPoint
+		if err = decoder.DecodeElement(&gpxPoint, &start); err != nil {
+			return fmt.Errorf("decode gpx track point: %w", err)
+		}
+
+		p := Point{Latitude: gpxPoint.Latitude, Longitude: gpxPoint.Longitude}
+		if gpxPoint.Time != "" {
+			p.Time, err = time.Parse(time.RFC3339Nano, gpxPoint.Time)
+			if err != nil {
+				return fmt.Errorf("decode gpx track point: %w", err)
+			}
+		}
+
+		if err = fn(p); err != nil {
+			return err
+		}
+	}
+}
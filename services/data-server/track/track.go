@@ -0,0 +1,224 @@
+// Package track writes the track of a boat as GPX 1.1, KML or GeoJSON and
+// reads tracks from GPX. Points are streamed, so tracks of any length can be
+// handled without holding them in memory.
+package track
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Formats of a track.
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// Point is a position of a track.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Time      time.Time
+}
+
+// Writer writes the points of a track. Close has to be called after the last
+// point to complete the document, it does not close the underlying writer.
+type Writer interface {
+	WritePoint(p Point) error
+	Close() error
+}
+
+// NewWriter returns a writer of the given format for a track with the given
+// name.
+func NewWriter(format string, w io.Writer, name string) (Writer, error) {
+	switch format {
+	case FormatGPX:
+		return newGPXWriter(w, name), nil
+	case FormatKML:
+		return newKMLWriter(w, name), nil
+	case FormatGeoJSON:
+		return newGeoJSONWriter(w, name), nil
+	default:
+		return nil, fmt.Errorf("unknown track format %q", format)
+	}
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	case FormatGeoJSON:
+		return "application/geo+json"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// documentWriter writes a document piece by piece and keeps the first error,
+// so the format writers only need to check it once per point.
+type documentWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (d *documentWriter) writeString(s string) {
+	if d.err == nil {
+		_, d.err = d.w.WriteString(s)
+	}
+}
+
+func (d *documentWriter) writeEscaped(s string) {
+	if d.err == nil {
+		d.err = xml.EscapeText(d.w, []byte(s))
+	}
+}
+
+func (d *documentWriter) writeFloat(f float64) {
+	d.writeString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func (d *documentWriter) flush() error {
+	if d.err == nil {
+		d.err = d.w.Flush()
+	}
+	return d.err
+}
+
+type gpxWriter struct {
+	documentWriter
+}
+
+func newGPXWriter(w io.Writer, name string) *gpxWriter {
+	g := &gpxWriter{documentWriter{w: bufio.NewWriter(w)}}
+	g.writeString(xml.Header)
+	g.writeString(`<gpx version="1.1" creator="regatta-watch" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+	g.writeString("  <trk>\n    <name>")
+	g.writeEscaped(name)
+	g.writeString("</name>\n    <trkseg>\n")
+	return g
+}
+
+func (g *gpxWriter) WritePoint(p Point) error {
+	g.writeString(`      <trkpt lat="`)
+	g.writeFloat(p.Latitude)
+	g.writeString(`" lon="`)
+	g.writeFloat(p.Longitude)
+	g.writeString(`"><time>`)
+	g.writeString(p.Time.UTC().Format(time.RFC3339Nano))
+	g.writeString("</time></trkpt>\n")
+	return g.err
+}
+
+func (g *gpxWriter) Close() error {
+	g.writeString("    </trkseg>\n  </trk>\n</gpx>\n")
+	return g.flush()
+}
+
+// kmlWriter writes the track as a LineString. KML has no time per coordinate
+// in a LineString, the time span of the track is written instead.
+type kmlWriter struct {
+	documentWriter
+	start, end time.Time
+}
+
+func newKMLWriter(w io.Writer, name string) *kmlWriter {
+	k := &kmlWriter{documentWriter: documentWriter{w: bufio.NewWriter(w)}}
+	k.writeString(xml.Header)
+	k.writeString(`<kml xmlns="http://www.opengis.net/kml/2.2">` + "\n")
+	k.writeString("  <Document>\n    <name>")
+	k.writeEscaped(name)
+	k.writeString("</name>\n    <Placemark>\n      <name>")
+	k.writeEscaped(name)
+	k.writeString("</name>\n      <LineString>\n        <tessellate>1</tessellate>\n        <coordinates>\n")
+	return k
+}
+
+func (k *kmlWriter) WritePoint(p Point) error {
+	if k.start.IsZero() {
+		k.start = p.Time
+	}
+	k.end = p.Time
+
+	k.writeString("          ")
+	k.writeFloat(p.Longitude)
+	k.writeString(",")
+	k.writeFloat(p.Latitude)
+	k.writeString("\n")
+	return k.err
+}
+
+func (k *kmlWriter) Close() error {
+	k.writeString("        </coordinates>\n      </LineString>\n")
+	if !k.start.IsZero() {
+		k.writeString("      <TimeSpan><begin>")
+		k.writeString(k.start.UTC().Format(time.RFC3339Nano))
+		k.writeString("</begin><end>")
+		k.writeString(k.end.UTC().Format(time.RFC3339Nano))
+		k.writeString("</end></TimeSpan>\n")
+	}
+	k.writeString("    </Placemark>\n  </Document>\n</kml>\n")
+	return k.flush()
+}
+
+// geoJSONWriter writes the track as a FeatureCollection with a single
+// LineString feature. The properties follow the geometry, so the time span of
+// the track is known when they are written.
+type geoJSONWriter struct {
+	documentWriter
+	name       string
+	points     int
+	start, end time.Time
+}
+
+func newGeoJSONWriter(w io.Writer, name string) *geoJSONWriter {
+	g := &geoJSONWriter{documentWriter: documentWriter{w: bufio.NewWriter(w)}, name: name}
+	g.writeString(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[`)
+	return g
+}
+
+func (g *geoJSONWriter) WritePoint(p Point) error {
+	if g.points > 0 {
+		g.writeString(",")
+	} else {
+		g.start = p.Time
+	}
+	g.points++
+	g.end = p.Time
+
+	g.writeString("\n[")
+	g.writeFloat(p.Longitude)
+	g.writeString(",")
+	g.writeFloat(p.Latitude)
+	g.writeString("]")
+	return g.err
+}
+
+func (g *geoJSONWriter) Close() error {
+	properties := struct {
+		Name      string     `json:"name"`
+		StartTime *time.Time `json:"start_time"`
+		EndTime   *time.Time `json:"end_time"`
+	}{Name: g.name}
+	if g.points > 0 {
+		properties.StartTime, properties.EndTime = &g.start, &g.end
+	}
+
+	raw, err := json.Marshal(properties)
+	if err != nil {
+		return fmt.Errorf("marshal properties: %w", err)
+	}
+
+	g.writeString("\n]},\"properties\":")
+	g.writeString(string(raw))
+	g.writeString("}]}\n")
+	return g.flush()
+}
@@ -0,0 +1,160 @@
+package track
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+var testPoints = []Point{
+	{Latitude: 53.5655, Longitude: 10.0091, Time: time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)},
+	{Latitude: 53.5661, Longitude: 10.0102, Time: time.Date(2025, time.June, 1, 12, 0, 1, 0, time.UTC)},
+}
+
+func writeTrack(t *testing.T, format string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	w, err := NewWriter(format, &b, "Bluebird & Co")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range testPoints {
+		if err = w.WritePoint(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestGPX(t *testing.T) {
+	var gpx struct {
+		Version string `xml:"version,attr"`
+		Track   struct {
+			Name   string `xml:"name"`
+			Points []struct {
+				Latitude  float64   `xml:"lat,attr"`
+				Longitude float64   `xml:"lon,attr"`
+				Time      time.Time `xml:"time"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(writeTrack(t, FormatGPX), &gpx); err != nil {
+		t.Fatal(err)
+	}
+
+	if gpx.Version != "1.1" || gpx.Track.Name != "Bluebird & Co" {
+		t.Errorf("version %q and name %q, want 1.1 and %q", gpx.Version, gpx.Track.Name, "Bluebird & Co")
+	}
+	if len(gpx.Track.Points) != len(testPoints) {
+		t.Fatalf("%d track points, want %d", len(gpx.Track.Points), len(testPoints))
+	}
+	for i, p := range gpx.Track.Points {
+		if p.Latitude != testPoints[i].Latitude || p.Longitude != testPoints[i].Longitude || !p.Time.Equal(testPoints[i].Time) {
+			t.Errorf("track point %d = %+v, want %+v", i, p, testPoints[i])
+		}
+	}
+}
+
+func TestKML(t *testing.T) {
+	var kml struct {
+		Placemark struct {
+			Name        string `xml:"name"`
+			Coordinates string `xml:"LineString>coordinates"`
+			Begin       string `xml:"TimeSpan>begin"`
+			End         string `xml:"TimeSpan>end"`
+		} `xml:"Document>Placemark"`
+	}
+	if err := xml.Unmarshal(writeTrack(t, FormatKML), &kml); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\n          10.0091,53.5655\n          10.0102,53.5661\n        "
+	if kml.Placemark.Coordinates != want {
+		t.Errorf("coordinates = %q, want %q", kml.Placemark.Coordinates, want)
+	}
+	if kml.Placemark.Begin != "2025-06-01T12:00:00Z" || kml.Placemark.End != "2025-06-01T12:00:01Z" {
+		t.Errorf("time span = %s - %s", kml.Placemark.Begin, kml.Placemark.End)
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string       `json:"type"`
+				Coordinates [][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Name      string    `json:"name"`
+				StartTime time.Time `json:"start_time"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(writeTrack(t, FormatGeoJSON), &collection); err != nil {
+		t.Fatal(err)
+	}
+
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 1 {
+		t.Fatalf("got %s with %d features, want FeatureCollection with 1 feature", collection.Type, len(collection.Features))
+	}
+	feature := collection.Features[0]
+	if feature.Geometry.Type != "LineString" || len(feature.Geometry.Coordinates) != len(testPoints) {
+		t.Fatalf("got %s with %d coordinates", feature.Geometry.Type, len(feature.Geometry.Coordinates))
+	}
+	if got := feature.Geometry.Coordinates[1]; got != [2]float64{10.0102, 53.5661} {
+		t.Errorf("second coordinate = %v, want longitude before latitude", got)
+	}
+	if !feature.Properties.StartTime.Equal(testPoints[0].Time) {
+		t.Errorf("start time = %s, want %s", feature.Properties.StartTime, testPoints[0].Time)
+	}
+}
+
+func TestEmptyTrack(t *testing.T) {
+	for _, format := range []string{FormatGPX, FormatKML, FormatGeoJSON} {
+		var b bytes.Buffer
+		w, err := NewWriter(format, &b, "Bluebird")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var v struct{}
+		if format == FormatGeoJSON {
+			err = json.Unmarshal(b.Bytes(), &v)
+		} else {
+			err = xml.Unmarshal(b.Bytes(), &v)
+		}
+		if err != nil {
+			t.Errorf("%s: empty track is not a valid document: %v", format, err)
+		}
+	}
+}
+
+func TestReadGPX(t *testing.T) {
+	var got []Point
+	err := ReadGPX(bytes.NewReader(writeTrack(t, FormatGPX)), func(p Point) error {
+		got = append(got, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(testPoints) {
+		t.Fatalf("read %d points, want %d", len(got), len(testPoints))
+	}
+	for i := range got {
+		if got[i].Latitude != testPoints[i].Latitude || got[i].Longitude != testPoints[i].Longitude || !got[i].Time.Equal(testPoints[i].Time) {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], testPoints[i])
+		}
+	}
+}
@@ -1,34 +1,90 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
-	"os"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
-	"github.com/joho/godotenv"
+	"regatta-watch/internal/configsource"
+	"regatta-watch/internal/logging"
 )
 
 type config struct {
-	DBConfig          databaseConfig
-	DataServerURL     string
-	RegattaStartTime  time.Time
-	RegattaEndTime    time.Time
-	GetDataFromServer bool
+	Server        serverConfig
+	Logging       logging.Config
+	DBConfig      databaseConfig
+	DataServerURL string
+	// DataServerTimeout limits the requests to DataServerURL.
+	DataServerTimeout time.Duration
+	// DataServerStreamURL is the URL of the position stream of the data
+	// server. If set, positions are received from the stream instead of
+	// polling DataServerURL.
+	DataServerStreamURL string
+	RegattaStartTime    time.Time
+	RegattaEndTime      time.Time
+	GetDataFromServer   bool
+	// MaxSyncAge is how long the last successful sync with the data server
+	// may be ago for the service to be ready.
+	MaxSyncAge time.Duration
 }
 
-func loadConfig() (*config, error) {
-	err := godotenv.Load("../.env")
+// settings lists everything loadConfig reads.
+var settings = []configsource.Setting{
+	{Name: "LISTEN_ADDRESS", Usage: "address of the HTTP server (default :8091)"},
+	{Name: "TLS_CERT_FILE", Usage: "certificate file, serves HTTPS together with TLS_KEY_FILE"},
+	{Name: "TLS_KEY_FILE", Usage: "private key file of TLS_CERT_FILE"},
+	{Name: "HTTP_READ_HEADER_TIMEOUT", Usage: "time to read the request headers (default 10s)"},
+	{Name: "HTTP_READ_TIMEOUT", Usage: "time to read a request, 0 for none (default 0)"},
+	{Name: "HTTP_WRITE_TIMEOUT", Usage: "time to write a response, 0 for none (default 0)"},
+	{Name: "HTTP_IDLE_TIMEOUT", Usage: "time to keep idle connections (default 2m)"},
+	{Name: "HOST", Usage: "host of Postgres"},
+	{Name: "PORT", Usage: "port of Postgres"},
+	{Name: "DB_NAME", Usage: "name of the Postgres database"},
+	{Name: "DB_USER_NAME", Usage: "user of the Postgres database"},
+	{Name: "DB_USER_PASSWORD", Usage: "password of DB_USER_NAME"},
+	{Name: "DB_MAX_OPEN_CONNS", Usage: "maximum open database connections, 0 for no limit (default 0)"},
+	{Name: "DB_MAX_IDLE_CONNS", Usage: "maximum idle database connections (default 2)"},
+	{Name: "DB_CONN_MAX_LIFETIME", Usage: "maximum age of a database connection, 0 for none (default 0)"},
+	{Name: "DB_TIMEOUT", Usage: "timeout of a database query (default 1m)"},
+	{Name: "DATA_SERVER_URL", Usage: "/readposition endpoint of the data server"},
+	{Name: "DATA_SERVER_STREAM_URL", Usage: "/streamposition endpoint of the data server, replaces polling"},
+	{Name: "DATA_SERVER_TIMEOUT", Usage: "timeout of a request to DATA_SERVER_URL (default 5s)"},
+	{Name: "GET_DATA_FROM_SERVER", Usage: "receive positions from the data server, true or false"},
+	{Name: "REGATTA_START_TIME", Usage: "start of the regatta, RFC 3339"},
+	{Name: "REGATTA_END_TIME", Usage: "end of the regatta, RFC 3339"},
+	{Name: "READY_MAX_SYNC_AGE", Usage: "maximum age of the last sync for /readyz (default 1m)"},
+	{Name: "LOG_LEVEL", Usage: "debug, info, warn or error (default info)"},
+	{Name: "LOG_OUTPUT", Usage: "stdout, stderr or a file (default logs.txt)"},
+}
+
+// loadConfig reads the settings from the command line arguments, the
+// environment and the config file.
+func loadConfig(args []string) (*config, error) {
+	src, args, err := configsource.New("website-backend", settings, args)
 	if err != nil {
-		return nil, errors.New("error loading .env file")
+		return nil, err
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", args[0])
 	}
 
-	host, ok := os.LookupEnv("HOST")
+	server, err := loadServerConfig(src, ":8091")
+	if err != nil {
+		return nil, err
+	}
+
+	host, ok := src.Lookup("HOST")
 	if !ok {
 		return nil, errors.New("HOST was not defined")
 	}
 
-	portStr, ok := os.LookupEnv("PORT")
+	portStr, ok := src.Lookup("PORT")
 	if !ok {
 		return nil, errors.New("PORT was not defined")
 	}
@@ -37,27 +93,42 @@ func loadConfig() (*config, error) {
 		return nil, err
 	}
 
-	dbName, ok := os.LookupEnv("DB_NAME")
+	dbName, ok := src.Lookup("DB_NAME")
 	if !ok {
 		return nil, errors.New("DB_NAME was not defined")
 	}
 
-	dbUserName, ok := os.LookupEnv("DB_USER_NAME")
+	dbUserName, ok := src.Lookup("DB_USER_NAME")
 	if !ok {
 		return nil, errors.New("DB_USER_NAME was not defined")
 	}
 
-	dbUserPassword, ok := os.LookupEnv("DB_USER_PASSWORD")
+	dbUserPassword, ok := src.Lookup("DB_USER_PASSWORD")
 	if !ok {
 		return nil, errors.New("DB_USER_PASSWORD was not defined")
 	}
 
-	dataServerURL, ok := os.LookupEnv("DATA_SERVER_URL")
+	dataServerURL, ok := src.Lookup("DATA_SERVER_URL")
 	if !ok {
 		return nil, errors.New("DATA_SERVER_URL was not defined")
 	}
+	if err = checkHTTPURL(dataServerURL); err != nil {
+		return nil, fmt.Errorf("parse DATA_SERVER_URL: %w", err)
+	}
+
+	dataServerStreamURL := src.Get("DATA_SERVER_STREAM_URL")
+	if dataServerStreamURL != "" {
+		if err = checkHTTPURL(dataServerStreamURL); err != nil {
+			return nil, fmt.Errorf("parse DATA_SERVER_STREAM_URL: %w", err)
+		}
+	}
+
+	dataServerTimeout := 5 * time.Second
+	if err = src.Duration("DATA_SERVER_TIMEOUT", &dataServerTimeout); err != nil {
+		return nil, err
+	}
 
-	regattaStartTimeRaw, ok := os.LookupEnv("REGATTA_START_TIME")
+	regattaStartTimeRaw, ok := src.Lookup("REGATTA_START_TIME")
 	if !ok {
 		return nil, errors.New("REGATTA_START_TIME was not defined")
 	}
@@ -66,7 +137,7 @@ func loadConfig() (*config, error) {
 		return nil, errors.New("error parsing REGATTA_START_TIME")
 	}
 
-	regattaEndTimeRaw, ok := os.LookupEnv("REGATTA_END_TIME")
+	regattaEndTimeRaw, ok := src.Lookup("REGATTA_END_TIME")
 	if !ok {
 		return nil, errors.New("REGATTA_END_TIME was not defined")
 	}
@@ -75,7 +146,7 @@ func loadConfig() (*config, error) {
 		return nil, errors.New("error parsing REGATTA_END_TIME")
 	}
 
-	getDataFromServer, ok := os.LookupEnv("GET_DATA_FROM_SERVER")
+	getDataFromServer, ok := src.Lookup("GET_DATA_FROM_SERVER")
 	if !ok {
 		return nil, errors.New("GET_DATA_FROM_SERVER was not defined")
 	}
@@ -84,19 +155,147 @@ func loadConfig() (*config, error) {
 	}
 	getDataFromServerBool := getDataFromServer == "true"
 
+	maxSyncAge := time.Minute
+	if maxSyncAgeStr, ok := src.Lookup("READY_MAX_SYNC_AGE"); ok {
+		maxSyncAge, err = time.ParseDuration(maxSyncAgeStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse READY_MAX_SYNC_AGE: %w", err)
+		}
+	}
+
+	logConfig := logging.Config{Level: slog.LevelInfo, Output: "logs.txt"}
+	if levelStr, ok := src.Lookup("LOG_LEVEL"); ok {
+		logConfig.Level, err = logging.ParseLevel(levelStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse LOG_LEVEL: %w", err)
+		}
+	}
+	if output, ok := src.Lookup("LOG_OUTPUT"); ok && output != "" {
+		logConfig.Output = output
+	}
+
 	dbConfig := databaseConfig{
 		Host:         host,
 		Port:         port,
 		DatabaseName: dbName,
 		UserName:     dbUserName,
 		UserPassword: dbUserPassword,
+		MaxIdleConns: 2,
+		Timeout:      time.Minute,
+	}
+	if err = src.Integer("DB_MAX_OPEN_CONNS", &dbConfig.MaxOpenConns); err != nil {
+		return nil, err
+	}
+	if err = src.Integer("DB_MAX_IDLE_CONNS", &dbConfig.MaxIdleConns); err != nil {
+		return nil, err
+	}
+	if err = src.Duration("DB_CONN_MAX_LIFETIME", &dbConfig.ConnMaxLifetime); err != nil {
+		return nil, err
+	}
+	if err = src.Duration("DB_TIMEOUT", &dbConfig.Timeout); err != nil {
+		return nil, err
+	}
+	if dbConfig.Timeout == 0 {
+		return nil, errors.New("DB_TIMEOUT must be greater than 0")
 	}
 
 	return &config{
-		DBConfig:          dbConfig,
-		DataServerURL:     dataServerURL,
-		RegattaStartTime:  regattaStartTime,
-		RegattaEndTime:    regattaEndTime,
-		GetDataFromServer: getDataFromServerBool,
+		Server:              server,
+		Logging:             logConfig,
+		DBConfig:            dbConfig,
+		DataServerURL:       dataServerURL,
+		DataServerTimeout:   dataServerTimeout,
+		DataServerStreamURL: dataServerStreamURL,
+		RegattaStartTime:    regattaStartTime,
+		RegattaEndTime:      regattaEndTime,
+		GetDataFromServer:   getDataFromServerBool,
+		MaxSyncAge:          maxSyncAge,
 	}, nil
 }
+
+type serverConfig struct {
+	ListenAddress string
+	// TLSCertFile and TLSKeyFile are empty to serve plain HTTP.
+	TLSCertFile       string
+	TLSKeyFile        string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// newServer returns a server of the handler, nil serves
+// http.DefaultServeMux.
+func (c serverConfig) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.ListenAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+	}
+}
+
+// listenAndServe serves with HTTPS if a certificate is configured, otherwise
+// with HTTP.
+func (c serverConfig) listenAndServe(server *http.Server) error {
+	if c.TLSCertFile != "" {
+		return server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+	}
+	return server.ListenAndServe()
+}
+
+// loadServerConfig reads the settings of the HTTP server, all of them are
+// optional. A TLS certificate is loaded once to report a broken pair on
+// startup.
+func loadServerConfig(src *configsource.Source, defaultAddress string) (serverConfig, error) {
+	server := serverConfig{
+		ListenAddress:     defaultAddress,
+		TLSCertFile:       src.Get("TLS_CERT_FILE"),
+		TLSKeyFile:        src.Get("TLS_KEY_FILE"),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if address, ok := src.Lookup("LISTEN_ADDRESS"); ok && address != "" {
+		server.ListenAddress = address
+	}
+	if _, _, err := net.SplitHostPort(server.ListenAddress); err != nil {
+		return server, fmt.Errorf("parse LISTEN_ADDRESS: %w", err)
+	}
+
+	if (server.TLSCertFile == "") != (server.TLSKeyFile == "") {
+		return server, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if server.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(server.TLSCertFile, server.TLSKeyFile); err != nil {
+			return server, fmt.Errorf("load TLS_CERT_FILE and TLS_KEY_FILE: %w", err)
+		}
+	}
+
+	for name, value := range map[string]*time.Duration{
+		"HTTP_READ_HEADER_TIMEOUT": &server.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":        &server.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":       &server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &server.IdleTimeout,
+	} {
+		if err := src.Duration(name, value); err != nil {
+			return server, err
+		}
+	}
+
+	return server, nil
+}
+
+// checkHTTPURL returns an error if rawURL is not an absolute HTTP or HTTPS
+// URL.
+func checkHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", rawURL)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"regatta-watch/internal/health"
+)
+
+// markSynced records a successful sync with the data server.
+func (s *regattaService) markSynced() {
+	s.lastSync.Store(s.clock.RealNow().UnixNano())
+}
+
+// checkSync returns an error if there was no successful sync with the data
+// server yet or the last one is older than maxSyncAge.
+func (s *regattaService) checkSync() error {
+	if s.lastSync.Load() == 0 {
+		return errors.New("not synced with the data server yet")
+	}
+	age := s.clock.RealNow().Sub(time.Unix(0, s.lastSync.Load()))
+	if age > s.maxSyncAge {
+		return fmt.Errorf("last sync with the data server %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Readyz reports if the service can handle requests: the database is
+// reachable, the tables exist and, if positions are received from the data
+// server, the last sync is recent.
+func (s *regattaService) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), health.ReadinessTimeout)
+	defer cancel()
+
+	components := map[string]error{
+		"database": s.storageClient.Ping(ctx),
+		"tables":   s.storageClient.CheckTables(ctx),
+	}
+	if s.receiving.Load() {
+		components["data_server_sync"] = s.checkSync()
+	}
+
+	health.Write(w, r, components)
+}
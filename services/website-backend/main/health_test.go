@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"regatta-watch/internal/health"
+)
+
+// healthStorage only implements the checks of the readiness endpoint.
+type healthStorage struct {
+	storageInterface
+	pingErr error
+}
+
+func (s healthStorage) Ping(context.Context) error        { return s.pingErr }
+func (s healthStorage) CheckTables(context.Context) error { return nil }
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		pingErr    error
+		receiving  bool          // whether positions are received
+		lastSync   time.Duration // ago, 0 if there was no sync yet
+		wantStatus int
+		wantFailed []string
+	}{
+		{name: "ready", wantStatus: http.StatusOK},
+		{name: "recent sync", receiving: true, lastSync: 10 * time.Second, wantStatus: http.StatusOK},
+		{name: "old sync", receiving: true, lastSync: 2 * time.Minute, wantStatus: http.StatusServiceUnavailable, wantFailed: []string{"data_server_sync"}},
+		{name: "never synced", receiving: true, wantStatus: http.StatusServiceUnavailable, wantFailed: []string{"data_server_sync"}},
+		{name: "database down", pingErr: errors.New("connection refused"), wantStatus: http.StatusServiceUnavailable, wantFailed: []string{"database"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRegattaService(healthStorage{pingErr: tt.pingErr}, "", "", time.Time{}, time.Time{}, time.Minute, http.DefaultClient)
+			s.receiving.Store(tt.receiving)
+			if tt.lastSync > 0 {
+				s.lastSync.Store(time.Now().Add(-tt.lastSync).UnixNano())
+			}
+
+			w := httptest.NewRecorder()
+			s.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var response health.Response
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			var failed []string
+			for name, component := range response.Components {
+				if component.Status != health.StatusOK {
+					failed = append(failed, name)
+				}
+			}
+			if len(failed) != len(tt.wantFailed) || len(failed) > 0 && failed[0] != tt.wantFailed[0] {
+				t.Errorf("failed components = %v, want %v", failed, tt.wantFailed)
+			}
+			if _, ok := response.Components["data_server_sync"]; ok != tt.receiving {
+				t.Errorf("sync checked = %v, want %v", ok, tt.receiving)
+			}
+		})
+	}
+}
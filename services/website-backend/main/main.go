@@ -3,32 +3,39 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"regatta-watch/internal/health"
+	"regatta-watch/internal/logging"
 )
 
 func main() {
-	// If the file doesn't exist, create it or append to the file
-	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	c, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("error loading config: ", err)
 	}
-	log.SetOutput(file)
 
-	c, err := loadConfig()
+	logger, logOutput, err := logging.NewLogger(c.Logging)
 	if err != nil {
-		log.Fatal("error loading config: ", err)
+		log.Fatal(err)
 	}
+	defer func() { _ = logOutput.Close() }()
+	slog.SetDefault(logger)
 
 	storageClient, err := newDatabaseClient(c.DBConfig)
 	if err != nil {
-		log.Fatal("error creating database client: ", err)
+		logging.Fatal("error creating database client", err)
 	}
 
 	/*
@@ -48,25 +55,30 @@ func main() {
 
 	client := &http.Client{
 		//Transport: transport,
-		Timeout: 5 * time.Second,
+		Timeout: c.DataServerTimeout,
 	}
 
 	regattaService := newRegattaService(
 		storageClient,
 		c.DataServerURL,
+		c.DataServerStreamURL,
 		c.RegattaStartTime,
 		c.RegattaEndTime,
+		c.MaxSyncAge,
 		client)
 
-	http.HandleFunc("/ping", regattaService.Ping)
-	http.HandleFunc("/fetchposition", regattaService.FetchPosition)
-	http.HandleFunc("/fetchpearlchain", regattaService.FetchPearlChain)
-	http.HandleFunc("/fetchroundtime", regattaService.FetchRoundTimes)
-	http.HandleFunc("/setclockconfiguration", regattaService.SetClockConfiguration)
-	http.HandleFunc("/resetclockconfiguration", regattaService.ResetClockConfiguration)
-	http.HandleFunc("/getclocktime", regattaService.GetClockTime)
-	http.HandleFunc("/fetchbuoys", regattaService.Fetchbuoys)
-	server := &http.Server{Addr: ":8091"}
+	handleRoute("/ping", regattaService.Ping)
+	handleRoute("/healthz", health.Healthz)
+	handleRoute("/readyz", regattaService.Readyz)
+	handleRoute("/fetchposition", regattaService.FetchPosition)
+	handleRoute("/fetchpearlchain", regattaService.FetchPearlChain)
+	handleRoute("/fetchroundtime", regattaService.FetchRoundTimes)
+	handleRoute("/setclockconfiguration", regattaService.SetClockConfiguration)
+	handleRoute("/resetclockconfiguration", regattaService.ResetClockConfiguration)
+	handleRoute("/getclocktime", regattaService.GetClockTime)
+	handleRoute("/fetchbuoys", regattaService.Fetchbuoys)
+	http.Handle("/metrics", promhttp.Handler())
+	server := c.Server.newServer(nil)
 
 	idleConnectionsClosed := make(chan struct{})
 	dataReceiverClosed := make(chan struct{})
@@ -74,23 +86,27 @@ func main() {
 		interruptChannel := make(chan os.Signal, 1)
 		signal.Notify(interruptChannel, os.Interrupt)
 		<-interruptChannel
-		fmt.Println("Server shutting down")
+		slog.Info("server shutting down")
 		if err = server.Shutdown(context.Background()); err != nil {
-			fmt.Printf("error shutting down: %v", err)
+			slog.Error("error shutting down", "error", err)
 		}
 		close(idleConnectionsClosed)
 	}()
 
 	boatList := []string{"Bluebird", "Vivace"}
 
-	fmt.Println("Service started and listening")
+	slog.Info("service started and listening", "address", server.Addr, "tls", c.Server.TLSCertFile != "")
 
 	if c.GetDataFromServer {
-		regattaService.ReceiveDataTicker(boatList, dataReceiverClosed)
+		if c.DataServerStreamURL != "" {
+			regattaService.ReceiveDataStream(boatList, dataReceiverClosed)
+		} else {
+			regattaService.ReceiveDataTicker(boatList, dataReceiverClosed)
+		}
 	}
-	err = server.ListenAndServe()
+	err = c.Server.listenAndServe(server)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatal("error in http handler: ", err)
+		logging.Fatal("error in http handler", err)
 	}
 
 	<-idleConnectionsClosed
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"regatta-watch/internal/logging"
+)
+
+// The metrics are exposed on /metrics. Their names are part of the interface
+// of the service, see the README before renaming them.
+var (
+	positionsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "regatta_website_backend_positions_received_total",
+		Help: "Positions received from the data server and stored by boat.",
+	}, []string{"boat"})
+
+	positionsLate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "regatta_website_backend_positions_late_total",
+		Help: "Positions received from the data server and skipped, because they were measured before the last stored one, by boat.",
+	}, []string{"boat"})
+
+	syncLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "regatta_website_backend_sync_lag_seconds",
+		Help: "Time between now and the newest measure time received from the data server by boat.",
+	}, []string{"boat"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "regatta_website_backend_db_query_duration_seconds",
+		Help:    "Duration of the database calls by storage method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "regatta_website_backend_http_request_duration_seconds",
+		Help:    "Duration of the HTTP requests by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "code"})
+)
+
+// observeQuery starts timing a storage method. Defer the call of the
+// returned function to record the duration.
+func observeQuery(method string) func() {
+	timer := prometheus.NewTimer(dbQueryDuration.WithLabelValues(method))
+	return func() { timer.ObserveDuration() }
+}
+
+// observeSyncLag records how far the positions of a boat are behind.
+func (s *regattaService) observeSyncLag(boat string, newest time.Time) {
+	syncLag.WithLabelValues(boat).Set(s.clock.RealNow().Sub(newest).Seconds())
+}
+
+// handleRoute registers a handler with a request ID and records the duration
+// of its requests.
+func handleRoute(route string, handler http.HandlerFunc) {
+	http.Handle(route, logging.WithRequestID(promhttp.InstrumentHandlerDuration(
+		httpRequestDuration.MustCurryWith(prometheus.Labels{"route": route}),
+		handler,
+	)))
+}
@@ -69,6 +69,14 @@ type DataServerReadMessageResponse struct {
 	PositionsAtTime []PositionAtTime `json:"positions_at_time"`
 }
 
+// DataServerPosition is a position of the position stream of the data
+// server.
+type DataServerPosition struct {
+	ID   int64  `json:"id"`
+	Boat string `json:"boat"`
+	PositionAtTime
+}
+
 type ReadMessageRequest struct {
 	Boat      string    `json:"boat"`
 	StartTime time.Time `json:"start_time"`
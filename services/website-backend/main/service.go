@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"time"
+
+	"regatta-watch/internal/logging"
 )
 
 const (
@@ -20,12 +23,22 @@ const (
 )
 
 type regattaService struct {
-	storageClient    storageInterface
-	httpClient       *http.Client
-	dataServerURL    string
-	regattaStartTime time.Time
-	regattaEndTime   time.Time
-	clock            clockInterface
+	storageClient       storageInterface
+	httpClient          *http.Client
+	dataServerURL       string
+	dataServerStreamURL string
+	regattaStartTime    time.Time
+	regattaEndTime      time.Time
+	clock               clockInterface
+	// maxSyncAge is how long the last successful sync with the data server
+	// may be ago for the service to be ready.
+	maxSyncAge time.Duration
+	// receiving is set when the ticker or the stream receiver starts to
+	// receive positions from the data server.
+	receiving atomic.Bool
+	// lastSync is the Unix time in nanoseconds of the last successful sync,
+	// 0 before the first one.
+	lastSync atomic.Int64
 }
 
 type clockInterface interface {
@@ -37,11 +50,16 @@ type clockInterface interface {
 }
 
 type storageInterface interface {
-	InsertPositions(ctx context.Context, position []StoragePosition) error
+	Ping(ctx context.Context) error
+	// CheckTables returns an error if a table of the service does not exist.
+	CheckTables(ctx context.Context) error
+	// InsertPositionBatch inserts all positions or none of them.
+	InsertPositionBatch(ctx context.Context, positions []StoragePosition) error
 	GetLastPosition(ctx context.Context, boat string, lowerBound, upperBound time.Time) (*StoragePosition, error)
 	GetPositions(ctx context.Context, boat string, startTime, endTime time.Time) ([]Position, error)
 	GetRegattaAtTime(ctx context.Context, time time.Time) (*string, error)
-	GetBuoysAtTime(ctx context.Context, time time.Time) ([]buoy, error)
+	GetNearestRegatta(ctx context.Context, at time.Time) (*string, time.Time, error)
+	GetCourseMarksAtTime(ctx context.Context, regattaID string, time time.Time) ([]buoy, error)
 	GetCurrentRound(ctx context.Context, regattaID, boatID string) (int, error)
 	GetCurrentSection(ctx context.Context, roundID int, regattaID, boatID string) (int, error)
 	GetLastCompletedRound(ctx context.Context, regattaID, boatID string) (int, error)
@@ -52,47 +70,58 @@ type storageInterface interface {
 	EndSection(ctx context.Context, sectionID, roundID int, regattaID, boatID string, endTime time.Time) error
 	GetRoundsToTime(ctx context.Context, regattaID, boatID string, time time.Time) ([]Round, error)
 	GetSectionsToTime(ctx context.Context, regattaID, boatID string, time time.Time) ([]Section, error)
+	GetDataServerCursor(ctx context.Context, name string) (int64, error)
+	SetDataServerCursor(ctx context.Context, name string, cursor int64) error
 }
 
 func newRegattaService(
 	storageClient storageInterface,
 	dataServerURL string,
+	dataServerStreamURL string,
 	regattaStartTime time.Time,
 	regattaEndTime time.Time,
+	maxSyncAge time.Duration,
 	httpClient *http.Client) *regattaService {
 	return &regattaService{
-		storageClient:    storageClient,
-		dataServerURL:    dataServerURL,
-		httpClient:       httpClient,
-		regattaStartTime: regattaStartTime,
-		regattaEndTime:   regattaEndTime,
-		clock:            newClock(),
+		storageClient:       storageClient,
+		dataServerURL:       dataServerURL,
+		dataServerStreamURL: dataServerStreamURL,
+		httpClient:          httpClient,
+		regattaStartTime:    regattaStartTime,
+		regattaEndTime:      regattaEndTime,
+		clock:               newClock(),
+		maxSyncAge:          maxSyncAge,
 	}
 }
 
-func (s *regattaService) LogError(err error) {
-	log.Println(err.Error())
+// LogError logs an error with the request ID of the context. args are
+// key-value pairs like boat and regatta, as for slog.
+func (s *regattaService) LogError(ctx context.Context, err error, args ...any) {
+	slog.ErrorContext(ctx, err.Error(), args...)
+}
+
+func (s *regattaService) LogWarn(ctx context.Context, message string, args ...any) {
+	slog.WarnContext(ctx, message, args...)
 }
 
-func (s *regattaService) LogDebug(message string) {
-	log.Println(message)
+func (s *regattaService) LogDebug(ctx context.Context, message string, args ...any) {
+	slog.DebugContext(ctx, message, args...)
 }
 
-func (s *regattaService) Ping(w http.ResponseWriter, _ *http.Request) {
+func (s *regattaService) Ping(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 
-	// fmt.Println("/ping called")
+	ctx := r.Context()
+
 	if _, err := w.Write([]byte("pong")); err != nil {
 		err = fmt.Errorf("ping: write to http response writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 }
 
 func (s *regattaService) FetchPosition(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("FetchPositions called")
-
 	enableCors(&w)
 
 	ctx := r.Context()
@@ -109,20 +138,20 @@ func (s *regattaService) FetchPosition(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		err = fmt.Errorf("read position: read http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("read position: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
 	position, err := s.storageClient.GetLastPosition(ctx, m.Boat, s.regattaStartTime, now)
 	if err != nil {
-		s.LogError(fmt.Errorf("get positions: %v", err))
+		s.LogError(ctx, fmt.Errorf("get positions: %w", err), "boat", m.Boat)
 		return
 	}
 
@@ -135,12 +164,12 @@ func (s *regattaService) FetchPosition(w http.ResponseWriter, r *http.Request) {
 	if position.RegattaID != nil {
 		round, err = s.storageClient.GetCurrentRound(ctx, *position.RegattaID, m.Boat)
 		if err != nil {
-			s.LogError(fmt.Errorf("get current round: %v", err))
+			s.LogError(ctx, fmt.Errorf("get current round: %w", err), "boat", m.Boat, "regatta", position.RegattaID)
 			return
 		}
 		section, err = s.storageClient.GetCurrentSection(ctx, round, *position.RegattaID, m.Boat)
 		if err != nil {
-			s.LogError(fmt.Errorf("get current section: %v", err))
+			s.LogError(ctx, fmt.Errorf("get current section: %w", err), "boat", m.Boat, "regatta", position.RegattaID, "round", round)
 			return
 		}
 	}
@@ -180,7 +209,7 @@ func (s *regattaService) FetchPosition(w http.ResponseWriter, r *http.Request) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("read position: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -188,15 +217,13 @@ func (s *regattaService) FetchPosition(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(responseBytes)
 	if err != nil {
 		err = fmt.Errorf("read position: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 }
 
 func (s *regattaService) FetchPearlChain(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("FetchPearlChain called")
-
 	enableCors(&w)
 
 	ctx := r.Context()
@@ -206,13 +233,13 @@ func (s *regattaService) FetchPearlChain(w http.ResponseWriter, r *http.Request)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		err = fmt.Errorf("read pearl chain: read http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("read position: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -229,7 +256,7 @@ func (s *regattaService) FetchPearlChain(w http.ResponseWriter, r *http.Request)
 	// positions sorted in descending order
 	positions, err := s.storageClient.GetPositions(ctx, m.Boat, startTime, endTime)
 	if err != nil {
-		fmt.Printf("/fetchposition get positions: %v", err)
+		s.LogError(ctx, fmt.Errorf("get positions: %w", err), "boat", m.Boat)
 		return
 	}
 
@@ -265,7 +292,7 @@ func (s *regattaService) FetchPearlChain(w http.ResponseWriter, r *http.Request)
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("read position: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -273,15 +300,13 @@ func (s *regattaService) FetchPearlChain(w http.ResponseWriter, r *http.Request)
 	_, err = w.Write(responseBytes)
 	if err != nil {
 		err = fmt.Errorf("read position: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 }
 
 func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("FetchRoundTimes called")
-
 	enableCors(&w)
 
 	ctx := r.Context()
@@ -290,13 +315,13 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		err = fmt.Errorf("fetch round now: read http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 	if err = json.Unmarshal(body, &m); err != nil {
 		err = fmt.Errorf("fetch round now: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -315,7 +340,7 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 		rounds, err := s.storageClient.GetRoundsToTime(ctx, *regattaID, m.Boat, now)
 		if err != nil {
 			err = fmt.Errorf("fetch round times: get rounds to now: %w", err)
-			s.LogError(err)
+			s.LogError(ctx, err, "boat", m.Boat, "regatta", regattaID)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -323,7 +348,7 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 		sections, err := s.storageClient.GetSectionsToTime(ctx, *regattaID, m.Boat, now)
 		if err != nil {
 			err = fmt.Errorf("fetch round times: get rounds to now: %w", err)
-			s.LogError(err)
+			s.LogError(ctx, err, "boat", m.Boat, "regatta", regattaID)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -353,7 +378,7 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("read round times: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat, "regatta", regattaID)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -361,7 +386,7 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 	_, err = w.Write(responseBytes)
 	if err != nil {
 		err = fmt.Errorf("read round times: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", m.Boat, "regatta", regattaID)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -369,22 +394,22 @@ func (s *regattaService) FetchRoundTimes(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *regattaService) SetClockConfiguration(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("SetClockConfiguration called")
-
 	enableCors(&w)
 
+	ctx := r.Context()
+
 	// parse data from request
 	var c SetClockConfigurationRequest
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		err = fmt.Errorf("set clock configuration: read http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 	if err = json.Unmarshal(body, &c); err != nil {
 		err = fmt.Errorf("set clock configuration: unmarshal http body: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
@@ -396,8 +421,6 @@ func (s *regattaService) SetClockConfiguration(w http.ResponseWriter, r *http.Re
 }
 
 func (s *regattaService) ResetClockConfiguration(w http.ResponseWriter, _ *http.Request) {
-	fmt.Println("ResetClockConfiguration called")
-
 	enableCors(&w)
 
 	s.clock.Reset()
@@ -405,11 +428,11 @@ func (s *regattaService) ResetClockConfiguration(w http.ResponseWriter, _ *http.
 	return
 }
 
-func (s *regattaService) GetClockTime(w http.ResponseWriter, _ *http.Request) {
-	fmt.Println("GetTime called")
-
+func (s *regattaService) GetClockTime(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 
+	ctx := r.Context()
+
 	currentTime := s.clock.Now()
 
 	response := GetClockTimeResponse{
@@ -420,7 +443,7 @@ func (s *regattaService) GetClockTime(w http.ResponseWriter, _ *http.Request) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("get time: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -428,27 +451,50 @@ func (s *regattaService) GetClockTime(w http.ResponseWriter, _ *http.Request) {
 	// Write response
 	if _, err = w.Write(responseBytes); err != nil {
 		err = fmt.Errorf("get time: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 }
 
 func (s *regattaService) Fetchbuoys(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("FetchBuoys called")
-
 	enableCors(&w)
 
 	ctx := r.Context()
 
-	buoys, err := s.storageClient.GetBuoysAtTime(ctx, s.clock.Now())
+	now := s.clock.Now()
+	regattaID, err := s.storageClient.GetRegattaAtTime(ctx, now)
 	if err != nil {
-		err = fmt.Errorf("fetch buoys: get buoys at time: %w", err)
-		s.LogError(err)
+		err = fmt.Errorf("fetch buoys: get regatta at time: %w", err)
+		s.LogError(ctx, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// outside of regattas the course of the nearest one is shown, as it was
+	// when it ended or will be when it starts
+	courseTime := now
+	if regattaID == nil {
+		regattaID, courseTime, err = s.storageClient.GetNearestRegatta(ctx, now)
+		if err != nil {
+			err = fmt.Errorf("fetch buoys: get nearest regatta: %w", err)
+			s.LogError(ctx, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	buoys := []buoy{}
+	if regattaID != nil {
+		buoys, err = s.storageClient.GetCourseMarksAtTime(ctx, *regattaID, courseTime)
+		if err != nil {
+			err = fmt.Errorf("fetch buoys: get course marks at time: %w", err)
+			s.LogError(ctx, err, "regatta", *regattaID)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	response := FetchBuoysResponse{
 		Buoys: buoys,
 	}
@@ -456,21 +502,22 @@ func (s *regattaService) Fetchbuoys(w http.ResponseWriter, r *http.Request) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		err = fmt.Errorf("fetch buoys: marshal response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	if _, err = w.Write(responseBytes); err != nil {
 		err = fmt.Errorf("fetch buoys: write to http writer: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 }
 
 func (s *regattaService) ReceiveDataTicker(boatList []string, done chan struct{}) {
-	fmt.Println("Starting ticker")
+	slog.Info("starting ticker")
+	s.receiving.Store(true)
 
 	interruptChannel := make(chan os.Signal, 1)
 	signal.Notify(interruptChannel, os.Interrupt)
@@ -482,7 +529,7 @@ func (s *regattaService) ReceiveDataTicker(boatList []string, done chan struct{}
 		for {
 			select {
 			case <-interruptChannel:
-				fmt.Println("Stopping ticker")
+				slog.Info("stopping ticker")
 				ticker.Stop()
 				close(done)
 				return
@@ -496,14 +543,14 @@ func (s *regattaService) ReceiveDataTicker(boatList []string, done chan struct{}
 }
 
 func (s *regattaService) ReceiveData(boat string) {
-	fmt.Printf("ReceiveData called for boat %q\n", boat)
-
-	ctx := context.Background()
+	// every poll gets its own request ID, which is passed to the data server
+	ctx := logging.ContextWithRequestID(context.Background(), logging.NewRequestID())
+	s.LogDebug(ctx, "receive data", "boat", boat)
 
 	lastPosition, err := s.storageClient.GetLastPosition(ctx, boat, s.regattaStartTime, s.clock.RealNow())
 	if err != nil {
 		err = fmt.Errorf("get last position: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
@@ -524,36 +571,38 @@ func (s *regattaService) ReceiveData(boat string) {
 	httpBodyBytes, err := json.Marshal(httpBody)
 	if err != nil {
 		err = fmt.Errorf("marhsal http request: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
 	// Make HTTP GET request
-	req, err := http.NewRequest(http.MethodPost, s.dataServerURL, bytes.NewBuffer(httpBodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.dataServerURL, bytes.NewBuffer(httpBodyBytes))
 	if err != nil {
 		err = fmt.Errorf("create new HTTP request: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
+	logging.SetRequestID(ctx, req)
+
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		err = fmt.Errorf("receive data from data server: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("receive status code %d from data server", resp.StatusCode)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		err = fmt.Errorf("read body from data server: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
@@ -561,11 +610,15 @@ func (s *regattaService) ReceiveData(boat string) {
 	err = json.Unmarshal(bodyBytes, &positions)
 	if err != nil {
 		err = fmt.Errorf("decode HTTP response: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
 	if len(positions.PositionsAtTime) == 0 {
+		if lastPosition != nil {
+			s.observeSyncLag(boat, lastPosition.MeasureTime)
+		}
+		s.markSynced()
 		return
 	}
 
@@ -575,24 +628,26 @@ func (s *regattaService) ReceiveData(boat string) {
 		// TODO: Handle this case
 		// We have to recalculate the distances from positions.PositionsAtTime[0] again.
 		// Currently, we assume that the positions are always in ascending order and don't handle this case.
-		s.LogError(errors.New("positions at time is too old"))
-		s.LogDebug(fmt.Sprintf("%s, %s, %s", s.clock.RealNow(), lastPosition.MeasureTime.String(), positions.PositionsAtTime[0].MeasureTime.String()))
+		s.LogError(ctx, errors.New("positions at time is too old"), "boat", boat,
+			"last_measure_time", lastPosition.MeasureTime, "first_measure_time", positions.PositionsAtTime[0].MeasureTime)
 		return
 	}
 
 	err = s.insertPositions(ctx, lastPosition, boat, positions)
 	if err != nil {
 		err = fmt.Errorf("insert positions: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
 
 	err = s.updateRoundsAndSections(ctx, lastPosition, boat, positions)
 	if err != nil {
 		err = fmt.Errorf("update rounds and sections: %w", err)
-		s.LogError(err)
+		s.LogError(ctx, err, "boat", boat)
 		return
 	}
+
+	s.markSynced()
 }
 
 func (s *regattaService) insertPositions(ctx context.Context, lastPosition *StoragePosition, boat string, positions *DataServerReadMessageResponse) error {
@@ -683,12 +738,15 @@ func (s *regattaService) insertPositions(ctx context.Context, lastPosition *Stor
 		storagePositions = append(storagePositions, storagePosition)
 	}
 
-	err = s.storageClient.InsertPositions(ctx, storagePositions)
+	err = s.storageClient.InsertPositionBatch(ctx, storagePositions)
 	if err != nil {
 		err = fmt.Errorf("inserting positions: %w", err)
 		return err
 	}
 
+	positionsReceived.WithLabelValues(boat).Add(float64(len(storagePositions)))
+	s.observeSyncLag(boat, storagePositions[len(storagePositions)-1].MeasureTime)
+
 	return nil
 }
 
@@ -718,8 +776,7 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 		}
 
 		if regattaID != nil {
-			// buoy order: "Schwanenwik bridge", "Kennedy bridge", "Langer Zug", "Pier"
-			buoys, err := s.storageClient.GetBuoysAtTime(ctx, positions.PositionsAtTime[0].MeasureTime)
+			marks, err := s.getCourseMarks(ctx, *regattaID, positions.PositionsAtTime[0].MeasureTime)
 			if err != nil {
 				return err
 			}
@@ -727,23 +784,13 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 			err = s.storageClient.StartRound(ctx, 1, *regattaID, boat, positions.PositionsAtTime[0].MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("start first round: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
-			err = s.storageClient.StartSection(
-				ctx,
-				1,
-				1,
-				*regattaID,
-				boat,
-				positions.PositionsAtTime[0].MeasureTime,
-				buoys[3].ID,
-				buoys[3].Version,
-				buoys[0].ID,
-				buoys[0].Version)
+			err = s.startSection(ctx, 1, 1, *regattaID, boat, positions.PositionsAtTime[0].MeasureTime, marks)
 			if err != nil {
 				err = fmt.Errorf("start first section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 		}
@@ -758,18 +805,21 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 			continue
 		}
 
-		// buoy order: "Schwanenwik bridge", "Kennedy bridge", "Langer Zug", "Pier"
-		buoys, err := s.storageClient.GetBuoysAtTime(ctx, position.MeasureTime)
-		if err != nil {
-			return err
-		}
-
 		regattaID, err := s.storageClient.GetRegattaAtTime(ctx, position.MeasureTime)
 		if err != nil {
 			err = fmt.Errorf("get regatta time: %w", err)
-			s.LogError(err)
+			s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 			return err
 		}
+
+		var marks []buoy
+		if regattaID != nil {
+			marks, err = s.getCourseMarks(ctx, *regattaID, position.MeasureTime)
+			if err != nil {
+				return err
+			}
+		}
+
 		if oldRegattaID == nil && regattaID == nil {
 			// No regatta ID available
 			// -> skip entry
@@ -783,19 +833,10 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 				return err
 			}
 
-			err = s.storageClient.StartSection(
-				ctx,
-				1,
-				1,
-				*regattaID,
-				boat,
-				position.MeasureTime, buoys[3].ID,
-				buoys[3].Version,
-				buoys[0].ID,
-				buoys[0].Version)
+			err = s.startSection(ctx, 1, 1, *regattaID, boat, position.MeasureTime, marks)
 			if err != nil {
 				err = fmt.Errorf("start first section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 
@@ -805,35 +846,35 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 			round, err := s.storageClient.GetCurrentRound(ctx, *oldRegattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current round: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			section, err := s.storageClient.GetCurrentSection(ctx, round, *oldRegattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			if round == 0 || section == 0 {
 				// No round or section available, so we cannot end it
 				err = fmt.Errorf("no round or section available to end for boat %q in regatta %q", boat, *oldRegattaID)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			err = s.storageClient.EndSection(ctx, section, round, *oldRegattaID, boat, position.MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("end section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			err = s.storageClient.EndRound(ctx, round, *oldRegattaID, boat, position.MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("end round: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
@@ -844,35 +885,35 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 			round, err := s.storageClient.GetCurrentRound(ctx, *oldRegattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current round: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			section, err := s.storageClient.GetCurrentSection(ctx, round, *oldRegattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			if round == 0 || section == 0 {
 				// No round or section available, so we cannot end it
 				err = fmt.Errorf("no round or section available to end for boat %q in regatta %q", boat, *oldRegattaID)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			err = s.storageClient.EndSection(ctx, section, round, *oldRegattaID, boat, position.MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("end section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
 			err = s.storageClient.EndRound(ctx, round, *oldRegattaID, boat, position.MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("end round: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", oldRegattaID)
 				return err
 			}
 
@@ -882,20 +923,10 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 				return err
 			}
 
-			err = s.storageClient.StartSection(
-				ctx,
-				1,
-				1,
-				*regattaID,
-				boat,
-				position.MeasureTime,
-				buoys[3].ID,
-				buoys[3].Version,
-				buoys[0].ID,
-				buoys[0].Version)
+			err = s.startSection(ctx, 1, 1, *regattaID, boat, position.MeasureTime, marks)
 			if err != nil {
 				err = fmt.Errorf("start first section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 		} else {
@@ -906,8 +937,7 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 			round, err := s.storageClient.GetCurrentRound(ctx, *regattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current round: %w", err)
-				s.LogError(err)
-				s.LogDebug(fmt.Sprintf("hit! %s, %s", *regattaID, boat))
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 
@@ -923,29 +953,23 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 				err = s.storageClient.StartRound(ctx, round, *regattaID, boat, position.MeasureTime)
 				if err != nil {
 					err = fmt.Errorf("start round: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 
-				err = s.storageClient.StartSection(
-					ctx,
-					1,
-					round,
-					*regattaID,
-					boat,
-					position.MeasureTime,
-					buoys[3].ID,
-					buoys[3].Version,
-					buoys[0].ID,
-					buoys[0].Version,
-				)
+				err = s.startSection(ctx, 1, round, *regattaID, boat, position.MeasureTime, marks)
+				if err != nil {
+					err = fmt.Errorf("start section: %w", err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
+					return err
+				}
 			}
 
 			// check if we have an open section, start new one if not
 			section, err := s.storageClient.GetCurrentSection(ctx, round, *regattaID, boat)
 			if err != nil {
 				err = fmt.Errorf("get current section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 
@@ -956,26 +980,13 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 					return err
 				}
 
-				section %= 4
+				section %= len(marks)
 				section += 1
 
-				buoyStart := (section + 2) % 4
-				buoyEnd := (section + 3) % 4
-
-				err = s.storageClient.StartSection(
-					ctx,
-					section,
-					round,
-					*regattaID,
-					boat,
-					position.MeasureTime,
-					buoys[buoyStart].ID,
-					buoys[buoyStart].Version,
-					buoys[buoyEnd].ID,
-					buoys[buoyEnd].Version)
+				err = s.startSection(ctx, section, round, *regattaID, boat, position.MeasureTime, marks)
 				if err != nil {
 					err = fmt.Errorf("start section: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 			}
@@ -998,49 +1009,35 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 				Time:      position.MeasureTime,
 			}
 
-			passed, err := calculateIfBuoysPassed(buoys, oldPosition2, position2)
+			passed, err := calculateIfBuoysPassed(marks, oldPosition2, position2)
 			if err != nil {
 				return err
 			}
 
-			if !passed[section-1] {
-				// skip if relevant buoy was not passed
+			if section > len(marks) || !passed[section-1] {
+				// skip if the mark at the end of the section was not passed
 				continue
 			}
 
 			err = s.storageClient.EndSection(ctx, section, round, *oldRegattaID, boat, position.MeasureTime)
 			if err != nil {
 				err = fmt.Errorf("end section: %w", err)
-				s.LogError(err)
+				s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 				return err
 			}
 
-			if section < 4 {
-				nextSection := section + 1
-				buoyStart := (nextSection + 2) % 4
-				buoyEnd := (nextSection + 3) % 4
-
-				err = s.storageClient.StartSection(
-					ctx,
-					nextSection,
-					round,
-					*oldRegattaID,
-					boat,
-					position.MeasureTime,
-					buoys[buoyStart].ID,
-					buoys[buoyStart].Version,
-					buoys[buoyEnd].ID,
-					buoys[buoyEnd].Version)
+			if section < len(marks) {
+				err = s.startSection(ctx, section+1, round, *oldRegattaID, boat, position.MeasureTime, marks)
 				if err != nil {
 					err = fmt.Errorf("start section: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 			} else {
 				err = s.storageClient.EndRound(ctx, round, *oldRegattaID, boat, position.MeasureTime)
 				if err != nil {
 					err = fmt.Errorf("end round: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 
@@ -1048,24 +1045,14 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 				err = s.storageClient.StartRound(ctx, nextRound, *oldRegattaID, boat, position.MeasureTime)
 				if err != nil {
 					err = fmt.Errorf("start round: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 
-				err = s.storageClient.StartSection(
-					ctx,
-					1,
-					nextRound,
-					*oldRegattaID,
-					boat,
-					position.MeasureTime,
-					buoys[3].ID,
-					buoys[3].Version,
-					buoys[0].ID,
-					buoys[0].Version)
+				err = s.startSection(ctx, 1, nextRound, *oldRegattaID, boat, position.MeasureTime, marks)
 				if err != nil {
 					err = fmt.Errorf("start section: %w", err)
-					s.LogError(err)
+					s.LogError(ctx, err, "boat", boat, "regatta", regattaID)
 					return err
 				}
 			}
@@ -1077,6 +1064,34 @@ func (s *regattaService) updateRoundsAndSections(ctx context.Context, lastPositi
 	return nil
 }
 
+// getCourseMarks returns the marks of the course of a regatta, a course needs
+// at least one mark.
+func (s *regattaService) getCourseMarks(ctx context.Context, regattaID string, time time.Time) ([]buoy, error) {
+	marks, err := s.storageClient.GetCourseMarksAtTime(ctx, regattaID, time)
+	if err != nil {
+		return nil, fmt.Errorf("get course marks: %w", err)
+	}
+	if len(marks) == 0 {
+		return nil, fmt.Errorf("regatta %q has no course marks", regattaID)
+	}
+	return marks, nil
+}
+
+// sectionMarks returns the marks a section of a course starts and ends at.
+// The marks are rounded in their order and the last one is the start and
+// finish line, so section 1 leads from the last mark to the first one and the
+// last section ends the round at the last mark.
+func sectionMarks(marks []buoy, section int) (start, end buoy) {
+	n := len(marks)
+	return marks[(section+n-2)%n], marks[section-1]
+}
+
+// startSection starts a section of a round between its marks.
+func (s *regattaService) startSection(ctx context.Context, section, round int, regattaID, boat string, startTime time.Time, marks []buoy) error {
+	start, end := sectionMarks(marks, section)
+	return s.storageClient.StartSection(ctx, section, round, regattaID, boat, startTime, start.ID, start.Version, end.ID, end.Version)
+}
+
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
 }
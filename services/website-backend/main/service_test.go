@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSectionMarks(t *testing.T) {
+	for _, n := range []int{1, 3, 4, 6} {
+		marks := make([]buoy, n)
+		for i := range marks {
+			marks[i] = buoy{ID: fmt.Sprintf("mark %d", i+1)}
+		}
+
+		// a round leads from the last mark around all marks back to it
+		previous := marks[n-1]
+		for section := 1; section <= n; section++ {
+			start, end := sectionMarks(marks, section)
+			if start.ID != previous.ID || end.ID != marks[section-1].ID {
+				t.Errorf("%d marks, section %d: %s to %s, want %s to %s", n, section, start.ID, end.ID, previous.ID, marks[section-1].ID)
+			}
+			previous = end
+		}
+		if previous.ID != marks[n-1].ID {
+			t.Errorf("%d marks: round ends at %s, want the last mark", n, previous.ID)
+		}
+	}
+}
@@ -5,18 +5,21 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
 type databaseClient struct {
-	database       *sql.DB
-	defaultTimeout time.Duration
-	gpsTable       string
-	regattaTable   string
-	buoyTable      string
-	roundTable     string
-	sectionTable   string
-	boatTable      string
+	database        *sql.DB
+	defaultTimeout  time.Duration
+	gpsTable        string
+	regattaTable    string
+	buoyTable       string
+	courseMarkTable string
+	roundTable      string
+	sectionTable    string
+	boatTable       string
+	cursorTable     string
 }
 
 type databaseConfig struct {
@@ -25,6 +28,13 @@ type databaseConfig struct {
 	DatabaseName string
 	UserName     string
 	UserPassword string
+	// MaxOpenConns limits the open connections, 0 means no limit.
+	MaxOpenConns int
+	// MaxIdleConns limits the idle connections, 0 keeps the default of 2.
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// Timeout limits every query, 0 means 1 minute.
+	Timeout time.Duration
 }
 
 type Position struct {
@@ -53,21 +63,86 @@ func newDatabaseClient(config databaseConfig) (*databaseClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("connect to database 'regatta': %w", err)
 	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
 	return &databaseClient{
-		database:       db,
-		defaultTimeout: time.Minute,
-		gpsTable:       "gps_data",
-		regattaTable:   "regattas",
-		buoyTable:      "buoys",
-		roundTable:     "rounds",
-		sectionTable:   "sections",
-		boatTable:      "boats",
+		database:        db,
+		defaultTimeout:  timeout,
+		gpsTable:        "gps_data",
+		regattaTable:    "regattas",
+		buoyTable:       "buoys",
+		courseMarkTable: "course_marks",
+		roundTable:      "rounds",
+		sectionTable:    "sections",
+		boatTable:       "boats",
+		cursorTable:     "data_server_cursors",
 	}, nil
 }
 
+// Ping checks that the database is reachable.
+func (c *databaseClient) Ping(ctx context.Context) error {
+	defer observeQuery("Ping")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	if err := c.database.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", err)
+	}
+	return nil
+}
+
+// CheckTables returns an error if a table of the service does not exist.
+func (c *databaseClient) CheckTables(ctx context.Context) error {
+	defer observeQuery("CheckTables")()
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	tables := []string{c.gpsTable, c.regattaTable, c.buoyTable, c.courseMarkTable, c.roundTable, c.sectionTable, c.boatTable, c.cursorTable}
+
+	query := `
+       SELECT name
+       FROM unnest($1::text[]) AS name
+       WHERE to_regclass(quote_ident(name)) IS NULL;
+       `
+
+	rows, err := c.database.QueryContext(ctx, query, tables)
+	if err != nil {
+		return fmt.Errorf("check tables: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var missing []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return fmt.Errorf("parse row: %w", err)
+		}
+		missing = append(missing, name)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("check tables: %w", err)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("tables %s do not exist", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // GetPositions returns all positions of a boat in the given time range in
 // ascending order.
 func (c *databaseClient) GetPositions(ctx context.Context, boat string, startTime, endTime time.Time) ([]Position, error) {
+	defer observeQuery("GetPositions")()
+
 	query := fmt.Sprintf(`
 		       SELECT latitude, longitude, measure_time, distance
 			   FROM %s
@@ -106,6 +181,8 @@ func (c *databaseClient) GetPositions(ctx context.Context, boat string, startTim
 // GetLastPosition returns the last position of a boat before or equal
 // to the upper bound time and after or equal to the lower bound time.
 func (c *databaseClient) GetLastPosition(ctx context.Context, boat string, lowerBound, upperBound time.Time) (*StoragePosition, error) {
+	defer observeQuery("GetLastPosition")()
+
 	query := fmt.Sprintf(`
 		       SELECT regatta_id, latitude, longitude, measure_time, send_time, distance, heading, velocity
 			   FROM %s
@@ -142,46 +219,61 @@ func (c *databaseClient) GetLastPosition(ctx context.Context, boat string, lower
 	return &position, nil
 }
 
-// InsertPositions inserts a list of positions of a boat into the database.
-func (c *databaseClient) InsertPositions(ctx context.Context, positions []StoragePosition) error {
-	if positions == nil {
-		return errors.New("position is set to nil")
+// maxRowsPerInsert limits the rows of a multi-row insert, so the number of
+// parameters stays well below the limit of 65535 of Postgres.
+const maxRowsPerInsert = 1000
+
+// valuesPlaceholders returns the placeholders of a multi-row VALUES list,
+// e.g. "($1, $2), ($3, $4)" for two rows with two columns.
+func valuesPlaceholders(rows, columns int) string {
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for column := 0; column < columns; column++ {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", row*columns+column+1)
+		}
+		b.WriteString(")")
 	}
+	return b.String()
+}
 
-	queryWithRegatta := fmt.Sprintf(`
-       INSERT INTO %s(regatta_id, boat_id, latitude, longitude, measure_time, send_time, distance, heading, velocity)
-       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
-       `, c.gpsTable)
+// InsertPositionBatch inserts a list of positions of a boat into the
+// database in a single transaction. Either all positions are inserted or
+// none.
+func (c *databaseClient) InsertPositionBatch(ctx context.Context, positions []StoragePosition) error {
+	defer observeQuery("InsertPositionBatch")()
 
-	queryWithoutRegatta := fmt.Sprintf(`
-       INSERT INTO %s(boat_id, latitude, longitude, measure_time, send_time, distance, heading, velocity)
-       VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
-       `, c.gpsTable)
+	if positions == nil {
+		return errors.New("position is set to nil")
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	var err error
-	for _, position := range positions {
+	tx, err := c.database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
 
-		if position.RegattaID == nil {
-			_, err = c.database.ExecContext(
-				ctx,
-				queryWithoutRegatta,
-				position.BoatID,
-				position.Latitude,
-				position.Longitude,
-				position.MeasureTime,
-				position.SendTime,
-				position.Distance,
-				position.Heading,
-				position.Velocity,
-			)
-		} else {
-			_, err = c.database.ExecContext(
-				ctx,
-				queryWithRegatta,
-				*position.RegattaID,
+	for start := 0; start < len(positions); start += maxRowsPerInsert {
+		chunk := positions[start:min(start+maxRowsPerInsert, len(positions))]
+
+		query := fmt.Sprintf(`
+       INSERT INTO %s(regatta_id, boat_id, latitude, longitude, measure_time, send_time, distance, heading, velocity)
+       VALUES %s;
+       `, c.gpsTable, valuesPlaceholders(len(chunk), 9))
+
+		args := make([]any, 0, 9*len(chunk))
+		for _, position := range chunk {
+			args = append(args,
+				position.RegattaID,
 				position.BoatID,
 				position.Latitude,
 				position.Longitude,
@@ -193,16 +285,23 @@ func (c *databaseClient) InsertPositions(ctx context.Context, positions []Storag
 			)
 		}
 
+		_, err = tx.ExecContext(ctx, query, args...)
 		if err != nil {
-			return fmt.Errorf("insert position: %w", err)
+			return fmt.Errorf("insert positions: %w", err)
 		}
 	}
 
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
 	return nil
 }
 
 // GetRegattaAtTime returns the ID of the regatta that is active at the given time.
 func (c *databaseClient) GetRegattaAtTime(ctx context.Context, time time.Time) (*string, error) {
+	defer observeQuery("GetRegattaAtTime")()
+
 	query := fmt.Sprintf(`
 		SELECT id
 		FROM %s
@@ -227,47 +326,100 @@ func (c *databaseClient) GetRegattaAtTime(ctx context.Context, time time.Time) (
 	return &regattaID, nil
 }
 
-func (c *databaseClient) GetBuoysAtTime(ctx context.Context, time time.Time) ([]buoy, error) {
+// GetNearestRegatta returns the regatta that is closest to the time at, together
+// with its start if it is yet to come or its end otherwise. It returns nil if
+// there are no regattas.
+func (c *databaseClient) GetNearestRegatta(ctx context.Context, at time.Time) (*string, time.Time, error) {
+	defer observeQuery("GetNearestRegatta")()
+
 	query := fmt.Sprintf(`
-		SELECT id, version, latitude, longitude, pass_angle, is_pass_direction_clockwise
+		SELECT id, CASE WHEN start_time > $1 THEN start_time ELSE end_time END
 		FROM %s
-        WHERE id = ANY($1)
-		AND start_time <= $2
-        AND (end_time >= $2 OR end_time IS NULL)
-		ORDER BY array_position($1, id);
-	`, c.buoyTable)
+		ORDER BY LEAST(ABS(EXTRACT(EPOCH FROM start_time - $1::timestamptz)), ABS(EXTRACT(EPOCH FROM end_time - $1::timestamptz)))
+		LIMIT 1;
+	`, c.regattaTable)
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	row := c.database.QueryRowContext(ctx, query, at)
+
+	var regattaID string
+	var courseTime time.Time
+	err := row.Scan(&regattaID, &courseTime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, courseTime, nil
+		}
+		return nil, courseTime, fmt.Errorf("scan regatta: %w", err)
+	}
+
+	return &regattaID, courseTime, nil
+}
+
+// GetCourseMarksAtTime returns the marks of the course of a regatta in the
+// order they are rounded, each in the version of the buoy valid at the time.
+func (c *databaseClient) GetCourseMarksAtTime(ctx context.Context, regattaID string, time time.Time) ([]buoy, error) {
+	defer observeQuery("GetCourseMarksAtTime")()
+
+	query := fmt.Sprintf(`
+		SELECT m.buoy_id, b.version, b.latitude, b.longitude, b.pass_angle, b.is_pass_direction_clockwise
+		FROM %s r
+		JOIN %s m ON m.course_id = r.course_id
+		LEFT JOIN %s b ON b.id = m.buoy_id
+			AND b.start_time <= $2
+			AND (b.end_time >= $2 OR b.end_time IS NULL)
+		WHERE r.id = $1
+		ORDER BY m.position;
+	`, c.regattaTable, c.courseMarkTable, c.buoyTable)
 
 	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
 	defer cancel()
 
-	buoyIDList := []string{"Schwanenwik bridge", "Kennedy bridge", "Langer Zug", "Pier"}
-	rows, err := c.database.QueryContext(ctx, query, buoyIDList, time)
+	rows, err := c.database.QueryContext(ctx, query, regattaID, time)
 	if err != nil {
-		return nil, fmt.Errorf("query buoys: %w", err)
+		return nil, fmt.Errorf("query course marks: %w", err)
 	}
+	defer func() { _ = rows.Close() }()
 
-	var buoys []buoy
+	var marks []buoy
 	for rows.Next() {
-		var buoy buoy
+		var mark buoy
+		var version sql.NullInt64
+		var latitude, longitude, passAngle sql.NullFloat64
+		var isPassDirectionClockwise sql.NullBool
 		err = rows.Scan(
-			&buoy.ID,
-			&buoy.Version,
-			&buoy.Latitude,
-			&buoy.Longitude,
-			&buoy.PassAngle,
-			&buoy.IsPassDirectionClockwise,
+			&mark.ID,
+			&version,
+			&latitude,
+			&longitude,
+			&passAngle,
+			&isPassDirectionClockwise,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("parse row: %w", err)
 		}
-		buoy.ToleranceInMeters = 100
-		buoys = append(buoys, buoy)
+		if !version.Valid {
+			return nil, fmt.Errorf("buoy %q of the course of regatta %q has no version at %s", mark.ID, regattaID, time)
+		}
+		mark.Version = int(version.Int64)
+		mark.Latitude = latitude.Float64
+		mark.Longitude = longitude.Float64
+		mark.PassAngle = passAngle.Float64
+		mark.IsPassDirectionClockwise = isPassDirectionClockwise.Bool
+		mark.ToleranceInMeters = 100
+		marks = append(marks, mark)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("read course marks: %w", err)
 	}
 
-	return buoys, nil
+	return marks, nil
 }
 
 func (c *databaseClient) GetCurrentRound(ctx context.Context, regattaID, boatID string) (int, error) {
+	defer observeQuery("GetCurrentRound")()
+
 	query := fmt.Sprintf(`
 		SELECT id
 		FROM %s
@@ -294,6 +446,8 @@ func (c *databaseClient) GetCurrentRound(ctx context.Context, regattaID, boatID
 }
 
 func (c *databaseClient) GetCurrentSection(ctx context.Context, roundID int, regattaID, boatID string) (int, error) {
+	defer observeQuery("GetCurrentSection")()
+
 	query := fmt.Sprintf(`
 		SELECT id
 		FROM %s
@@ -321,6 +475,8 @@ func (c *databaseClient) GetCurrentSection(ctx context.Context, roundID int, reg
 }
 
 func (c *databaseClient) GetLastCompletedRound(ctx context.Context, regattaID, boatID string) (int, error) {
+	defer observeQuery("GetLastCompletedRound")()
+
 	query := fmt.Sprintf(`
 		SELECT id
 		FROM %s
@@ -348,6 +504,8 @@ func (c *databaseClient) GetLastCompletedRound(ctx context.Context, regattaID, b
 }
 
 func (c *databaseClient) GetLastCompletedSection(ctx context.Context, roundID int, regattaID, boatID string) (int, error) {
+	defer observeQuery("GetLastCompletedSection")()
+
 	query := fmt.Sprintf(`
 		SELECT id
 		FROM %s
@@ -376,6 +534,8 @@ func (c *databaseClient) GetLastCompletedSection(ctx context.Context, roundID in
 }
 
 func (c *databaseClient) StartRound(ctx context.Context, roundID int, regattaID, boatID string, startTime time.Time) error {
+	defer observeQuery("StartRound")()
+
 	query := fmt.Sprintf(`
 		INSERT INTO %s(id, regatta_id, boat_id, start_time)
 		VALUES ($1, $2, $3, $4)
@@ -397,6 +557,8 @@ func (c *databaseClient) StartRound(ctx context.Context, roundID int, regattaID,
 }
 
 func (c *databaseClient) StartSection(ctx context.Context, sectionID, roundID int, regattaID, boatID string, startTime time.Time, buoyIdStart string, buoyVersionStart int, buoyIdEnd string, buoyVersionEnd int) error {
+	defer observeQuery("StartSection")()
+
 	query := fmt.Sprintf(`
 		INSERT INTO %s(id, round_id, regatta_id, boat_id, start_time, buoy_id_start, buoy_version_start, buoy_id_end, buoy_version_end)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
@@ -418,6 +580,8 @@ func (c *databaseClient) StartSection(ctx context.Context, sectionID, roundID in
 }
 
 func (c *databaseClient) EndRound(ctx context.Context, roundID int, regattaID, boatID string, endTime time.Time) error {
+	defer observeQuery("EndRound")()
+
 	query := fmt.Sprintf(`
 		UPDATE %s
 		SET end_time = $1
@@ -446,6 +610,8 @@ func (c *databaseClient) EndRound(ctx context.Context, roundID int, regattaID, b
 }
 
 func (c *databaseClient) EndSection(ctx context.Context, sectionID, roundID int, regattaID, boatID string, endTime time.Time) error {
+	defer observeQuery("EndSection")()
+
 	query := fmt.Sprintf(`
 		UPDATE %s
 		SET end_time = $1
@@ -475,6 +641,8 @@ func (c *databaseClient) EndSection(ctx context.Context, sectionID, roundID int,
 }
 
 func (c *databaseClient) GetRoundsToTime(ctx context.Context, regattaID, boatID string, time time.Time) ([]Round, error) {
+	defer observeQuery("GetRoundsToTime")()
+
 	query := fmt.Sprintf(`
 		SELECT id, start_time, end_time
 		FROM %s
@@ -506,6 +674,8 @@ func (c *databaseClient) GetRoundsToTime(ctx context.Context, regattaID, boatID
 }
 
 func (c *databaseClient) GetSectionsToTime(ctx context.Context, regattaID, boatID string, time time.Time) ([]Section, error) {
+	defer observeQuery("GetSectionsToTime")()
+
 	query := fmt.Sprintf(`
 		SELECT id, round_id, start_time, end_time
 		FROM %s
@@ -535,3 +705,50 @@ func (c *databaseClient) GetSectionsToTime(ctx context.Context, regattaID, boatI
 
 	return sections, nil
 }
+
+// GetDataServerCursor returns the cursor with the given name into the data of
+// the data server, or 0 if it was never set.
+func (c *databaseClient) GetDataServerCursor(ctx context.Context, name string) (int64, error) {
+	defer observeQuery("GetDataServerCursor")()
+
+	query := fmt.Sprintf(`
+		SELECT cursor
+		FROM %s
+		WHERE name = $1;
+	`, c.cursorTable)
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	row := c.database.QueryRowContext(ctx, query, name)
+	var cursor int64
+	err := row.Scan(&cursor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("scan cursor: %w", err)
+	}
+
+	return cursor, nil
+}
+
+func (c *databaseClient) SetDataServerCursor(ctx context.Context, name string, cursor int64) error {
+	defer observeQuery("SetDataServerCursor")()
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s(name, cursor)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET cursor = EXCLUDED.cursor;
+	`, c.cursorTable)
+
+	ctx, cancel := context.WithTimeout(ctx, c.defaultTimeout)
+	defer cancel()
+
+	_, err := c.database.ExecContext(ctx, query, name, cursor)
+	if err != nil {
+		return fmt.Errorf("set cursor: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestDatabaseClient connects to the database given by the DSN in
+// TEST_DATABASE_DSN, e.g. "host=localhost port=5432 user=regatta
+// password=1234 dbname=regatta_test", and skips if it is not set. The tables
+// have to exist.
+func newTestDatabaseClient(tb testing.TB) *databaseClient {
+	tb.Helper()
+
+	dsn, ok := os.LookupEnv("TEST_DATABASE_DSN")
+	if !ok {
+		tb.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = db.Close() })
+
+	return &databaseClient{
+		database:        db,
+		defaultTimeout:  time.Minute,
+		gpsTable:        "gps_data",
+		regattaTable:    "regattas",
+		buoyTable:       "buoys",
+		courseMarkTable: "course_marks",
+		roundTable:      "rounds",
+		sectionTable:    "sections",
+		boatTable:       "boats",
+		cursorTable:     "data_server_cursors",
+	}
+}
+
+func TestGetNearestRegatta(t *testing.T) {
+	c := newTestDatabaseClient(t)
+	ctx := context.Background()
+
+	// far in the future, so other regattas in the database are not closer
+	cleanUp := func() {
+		_, err := c.database.ExecContext(ctx, `DELETE FROM regattas WHERE id LIKE 'nearest.%'; DELETE FROM courses WHERE id = 'nearest';`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanUp()
+	t.Cleanup(cleanUp)
+
+	_, err := c.database.ExecContext(ctx, `
+		INSERT INTO courses (id) VALUES ('nearest');
+		INSERT INTO regattas (id, start_time, end_time, course_id) VALUES
+			('nearest.3000', '3000-08-02 13:00:00+00', '3000-08-03 14:00:00+00', 'nearest'),
+			('nearest.3001', '3001-08-02 13:00:00+00', '3001-08-03 14:00:00+00', 'nearest');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at             time.Time
+		wantID         string
+		wantCourseTime time.Time
+	}{
+		{at: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), wantID: "nearest.3000", wantCourseTime: time.Date(3000, 8, 2, 13, 0, 0, 0, time.UTC)},
+		{at: time.Date(3000, 9, 1, 0, 0, 0, 0, time.UTC), wantID: "nearest.3000", wantCourseTime: time.Date(3000, 8, 3, 14, 0, 0, 0, time.UTC)},
+		{at: time.Date(3001, 7, 1, 0, 0, 0, 0, time.UTC), wantID: "nearest.3001", wantCourseTime: time.Date(3001, 8, 2, 13, 0, 0, 0, time.UTC)},
+		{at: time.Date(3005, 1, 1, 0, 0, 0, 0, time.UTC), wantID: "nearest.3001", wantCourseTime: time.Date(3001, 8, 3, 14, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		regattaID, courseTime, err := c.GetNearestRegatta(ctx, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if regattaID == nil || *regattaID != tt.wantID || !courseTime.Equal(tt.wantCourseTime) {
+			t.Errorf("GetNearestRegatta(%s) = %v at %s, want %s at %s", tt.at, regattaID, courseTime, tt.wantID, tt.wantCourseTime)
+		}
+	}
+}
+
+func BenchmarkInsertPositionBatch(b *testing.B) {
+	const positionsPerBatch = 10000
+
+	c := newTestDatabaseClient(b)
+	ctx := context.Background()
+
+	cleanUp := func() {
+		_, err := c.database.ExecContext(ctx, `DELETE FROM gps_data WHERE boat_id = 'benchmark'; DELETE FROM boats WHERE id = 'benchmark';`)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	cleanUp()
+	b.Cleanup(cleanUp)
+
+	_, err := c.database.ExecContext(ctx, `INSERT INTO boats (id, class, yardstick) VALUES ('benchmark', 'benchmark', 100);`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := make([]StoragePosition, positionsPerBatch)
+	for i := range positions {
+		positions[i] = StoragePosition{
+			BoatID:      "benchmark",
+			Latitude:    53.5655 + float64(i)*1e-6,
+			Longitude:   10.0091 + float64(i)*1e-6,
+			Distance:    float64(i) * 1e-3,
+			MeasureTime: start.Add(time.Duration(i) * time.Second),
+			SendTime:    start.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = c.InsertPositionBatch(ctx, positions); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*positionsPerBatch)/b.Elapsed().Seconds(), "positions/s")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"regatta-watch/internal/logging"
+)
+
+// positionStreamCursor is the name of the cursor into the position stream of
+// the data server.
+const positionStreamCursor = "positions"
+
+// ReceiveDataStream receives positions from the position stream of the data
+// server instead of polling it. The stream is resumed at the cursor stored in
+// the database and reconnected with an increasing delay if it breaks.
+func (s *regattaService) ReceiveDataStream(boatList []string, done chan struct{}) {
+	slog.Info("starting stream receiver")
+	s.receiving.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interruptChannel := make(chan os.Signal, 1)
+	signal.Notify(interruptChannel, os.Interrupt)
+	go func() {
+		<-interruptChannel
+		slog.Info("stopping stream receiver")
+		cancel()
+	}()
+
+	go func() {
+		defer close(done)
+
+		backoff := time.Second
+		for {
+			// every connection gets its own request ID, which is passed to the data server
+			streamCtx := logging.ContextWithRequestID(ctx, logging.NewRequestID())
+			received, err := s.receiveStream(streamCtx, boatList)
+			if ctx.Err() != nil {
+				return
+			}
+			if received {
+				backoff = time.Second
+			}
+
+			err = fmt.Errorf("receive data stream: %w", err)
+			s.LogError(streamCtx, err, "backoff", backoff)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+		}
+	}()
+}
+
+// receiveStream reads the position stream until it breaks and reports if
+// any position was received.
+func (s *regattaService) receiveStream(ctx context.Context, boatList []string) (bool, error) {
+	cursor, err := s.storageClient.GetDataServerCursor(ctx, positionStreamCursor)
+	if err != nil {
+		return false, fmt.Errorf("get cursor: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.dataServerStreamURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("create new HTTP request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(cursor, 10))
+	logging.SetRequestID(ctx, req)
+
+	// the timeout of the default client would end the stream
+	client := &http.Client{Transport: s.httpClient.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("connect to data server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("receive status code %d from data server", resp.StatusCode)
+	}
+
+	received := false
+	reader := bufio.NewReader(resp.Body)
+	var batch []DataServerPosition
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("stream closed by data server")
+			}
+			return received, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// end of event
+			if data.Len() > 0 {
+				var position DataServerPosition
+				if err = json.Unmarshal([]byte(data.String()), &position); err != nil {
+					return received, fmt.Errorf("decode position: %w", err)
+				}
+				batch = append(batch, position)
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case strings.HasPrefix(line, ":") && len(batch) == 0:
+			// heartbeat, the data server has no new positions
+			s.markSynced()
+		default:
+			// the event ID is part of the data, other fields and comments are ignored
+		}
+
+		// process what we have once the data server waits for new positions
+		if len(batch) > 0 && reader.Buffered() == 0 {
+			if err = s.receiveBatch(ctx, boatList, batch); err != nil {
+				return received, err
+			}
+			received = true
+			s.markSynced()
+			batch = batch[:0]
+		}
+	}
+}
+
+// receiveBatch processes positions of the stream and stores the cursor
+// afterward.
+func (s *regattaService) receiveBatch(ctx context.Context, boatList []string, batch []DataServerPosition) error {
+	positionsByBoat := map[string][]PositionAtTime{}
+	for _, position := range batch {
+		if slices.Contains(boatList, position.Boat) {
+			positionsByBoat[position.Boat] = append(positionsByBoat[position.Boat], position.PositionAtTime)
+		}
+	}
+
+	for boat, positions := range positionsByBoat {
+		if err := s.receivePositions(ctx, boat, positions); err != nil {
+			return fmt.Errorf("receive positions of boat %q: %w", boat, err)
+		}
+	}
+
+	err := s.storageClient.SetDataServerCursor(ctx, positionStreamCursor, batch[len(batch)-1].ID)
+	if err != nil {
+		return fmt.Errorf("set cursor: %w", err)
+	}
+
+	return nil
+}
+
+// receivePositions processes new positions of a boat in any order. Positions
+// before the last processed position are skipped, because distances, rounds
+// and sections are only calculated forward in time. Positions that arrive
+// after a later one was stored are late, they are counted in
+// regatta_website_backend_positions_late_total and logged as warning.
+func (s *regattaService) receivePositions(ctx context.Context, boat string, positions []PositionAtTime) error {
+	s.LogDebug(ctx, "receive positions", "boat", boat, "positions", len(positions))
+
+	lastPosition, err := s.storageClient.GetLastPosition(ctx, boat, s.regattaStartTime, s.clock.RealNow())
+	if err != nil {
+		return fmt.Errorf("get last position: %w", err)
+	}
+
+	startTime := s.regattaStartTime
+	if lastPosition != nil {
+		startTime = lastPosition.MeasureTime
+	}
+
+	var newPositions []PositionAtTime
+	late, earliestLate := 0, startTime
+	for _, position := range positions {
+		switch {
+		case position.MeasureTime.After(startTime):
+			newPositions = append(newPositions, position)
+		case lastPosition != nil && position.MeasureTime.Before(startTime):
+			late++
+			if position.MeasureTime.Before(earliestLate) {
+				earliestLate = position.MeasureTime
+			}
+		}
+	}
+	if late > 0 {
+		positionsLate.WithLabelValues(boat).Add(float64(late))
+		s.LogWarn(ctx, "skip late positions measured before the last stored one", "boat", boat, "late", late,
+			"earliest_measure_time", earliestLate, "last_measure_time", startTime)
+	}
+	if skipped := len(positions) - len(newPositions) - late; skipped > 0 {
+		s.LogDebug(ctx, "skip positions before the regatta or stored before", "boat", boat, "skipped", skipped, "last_measure_time", startTime)
+	}
+	if len(newPositions) == 0 {
+		if lastPosition != nil {
+			s.observeSyncLag(boat, lastPosition.MeasureTime)
+		}
+		return nil
+	}
+
+	slices.SortFunc(newPositions, func(a, b PositionAtTime) int {
+		return a.MeasureTime.Compare(b.MeasureTime)
+	})
+
+	response := &DataServerReadMessageResponse{PositionsAtTime: newPositions}
+
+	err = s.insertPositions(ctx, lastPosition, boat, response)
+	if err != nil {
+		return fmt.Errorf("insert positions: %w", err)
+	}
+
+	err = s.updateRoundsAndSections(ctx, lastPosition, boat, response)
+	if err != nil {
+		return fmt.Errorf("update rounds and sections: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// lastPositionStorage only knows the last position of a boat.
+type lastPositionStorage struct {
+	storageInterface
+	last *StoragePosition
+}
+
+func (l lastPositionStorage) GetLastPosition(context.Context, string, time.Time, time.Time) (*StoragePosition, error) {
+	return l.last, nil
+}
+
+func TestReceivePositionsLate(t *testing.T) {
+	last := time.Date(2025, 8, 2, 14, 0, 0, 0, time.UTC)
+	s := &regattaService{
+		storageClient:    lastPositionStorage{last: &StoragePosition{BoatID: "Bluebird", MeasureTime: last}},
+		clock:            newClock(),
+		regattaStartTime: last.Add(-time.Hour),
+	}
+
+	before := testutil.ToFloat64(positionsLate.WithLabelValues("Bluebird"))
+	positions := []PositionAtTime{
+		{MeasureTime: last.Add(-time.Minute)},
+		{MeasureTime: last.Add(-time.Second)},
+		{MeasureTime: last}, // sent again
+	}
+	if err := s.receivePositions(context.Background(), "Bluebird", positions); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(positionsLate.WithLabelValues("Bluebird")) - before; got != 2 {
+		t.Errorf("counted %v late positions, want 2", got)
+	}
+}